@@ -6,6 +6,7 @@ It is designed to integrate seamlessly with Julien Schmidt's httprouter and leve
 package apirouter
 
 import (
+	"compress/gzip"
 	"net/http"
 	"runtime/debug"
 	"strings"
@@ -21,12 +22,12 @@ import (
 
 // Headers for CORs and Authentication
 const (
-	// connectionHeader       string = "Connection"
 	allowCredentialsHeader string = "Access-Control-Allow-Credentials"
 	allowHeadersHeader     string = "Access-Control-Allow-Headers"
 	allowMethodsHeader     string = "Access-Control-Allow-Methods"
 	allowOriginHeader      string = "Access-Control-Allow-Origin"
 	authenticateHeader     string = "WWW-Authenticate"
+	connectionHeader       string = "Connection"
 	contentTypeHeader      string = "Content-Type"
 	defaultHeaders         string = "Accept, Content-Type, Content-Length, Cache-Control, Pragma, Accept-Encoding, X-CSRF-Token, Authorization, X-Auth-Cookie"
 	defaultMethods         string = "POST, GET, OPTIONS, PUT, DELETE, HEAD"
@@ -39,18 +40,24 @@ const (
 
 // Log formats for the request
 const (
-	LogErrorFormat  string = "request_id=\"%s\" ip_address=\"%s\" type=\"%s\" internal_message=\"%s\" code=%d\n"
-	LogPanicFormat  string = "request_id=\"%s\" method=\"%s\" path=\"%s\" type=\"%s\" error_message=\"%s\" stack_trace=\"%s\"\n"
-	LogParamsFormat string = "request_id=\"%s\" method=\"%s\" path=\"%s\" ip_address=\"%s\" user_agent=\"%s\" params=\"%v\"\n"
-	LogTimeFormat   string = "request_id=\"%s\" method=\"%s\" path=\"%s\" ip_address=\"%s\" user_agent=\"%s\" service=%dms status=%d\n"
+	LogErrorFormat      string = "request_id=\"%s\" ip_address=\"%s\" type=\"%s\" internal_message=\"%s\" code=%d\n"
+	LogErrorStackFormat string = "request_id=\"%s\" ip_address=\"%s\" type=\"%s\" internal_message=\"%s\" code=%d stack_trace=\"%s\"\n"
+	LogPanicFormat      string = "request_id=\"%s\" method=\"%s\" path=\"%s\" type=\"%s\" error_message=\"%s\" stack_trace=\"%s\"\n"
+	LogParamsFormat     string = "request_id=\"%s\" method=\"%s\" path=\"%s\" ip_address=\"%s\" user_agent=\"%s\" params=\"%v\"\n"
+	LogTimeFormat       string = "request_id=\"%s\" method=\"%s\" path=\"%s\" ip_address=\"%s\" user_agent=\"%s\" service=%dms status=%d\n"
+	LogWebSocketFormat  string = "request_id=\"%s\" path=\"%s\" ip_address=\"%s\" type=\"websocket\" duration=%dms messages_read=%d messages_written=%d close_code=%d\n"
 )
 
 // Package variables
 var (
-	authTokenKey  paramRequestKey = "auth_token"
-	customDataKey paramRequestKey = "custom_data"
-	ipAddressKey  paramRequestKey = "ip_address"
-	requestIDKey  paramRequestKey = "request_id"
+	authTokenKey      paramRequestKey = "auth_token"
+	bodyLimitsKey     paramRequestKey = "body_limits"
+	bodyReaderKey     paramRequestKey = "body_reader"
+	customDataKey     paramRequestKey = "custom_data"
+	errorLoggerKey    paramRequestKey = "error_logger"
+	ipAddressKey      paramRequestKey = "ip_address"
+	problemDetailsKey paramRequestKey = "problem_details"
+	requestIDKey      paramRequestKey = "request_id"
 
 	// defaultFilterFields is the fields to filter from logs
 	defaultFilterFields = []string{
@@ -76,15 +83,23 @@ type paramRequestKey string
 // Router is the configuration for the middleware service
 type Router struct {
 	AccessControlExposeHeaders  string               `json:"access_control_expose_headers" url:"access_control_expose_headers"`   // Allow specific headers for cors
+	CompressionContentTypes     []string             `json:"compression_content_types" url:"compression_content_types"`           // Content types to compress (supports "text/*")
+	CompressionEnabled          bool                 `json:"compression_enabled" url:"compression_enabled"`                       // Enable gzip/deflate response compression
+	CompressionLevel            int                  `json:"compression_level" url:"compression_level"`                           // Compression level (IE: gzip.BestSpeed)
+	CompressionMinSize          int                  `json:"compression_min_size" url:"compression_min_size"`                     // Minimum response size (bytes) to compress
 	CrossOriginAllowCredentials bool                 `json:"cross_origin_allow_credentials" url:"cross_origin_allow_credentials"` // Allow credentials for BasicAuth()
 	CrossOriginAllowHeaders     string               `json:"cross_origin_allow_headers" url:"cross_origin_allow_headers"`         // Allowed headers
 	CrossOriginAllowMethods     string               `json:"cross_origin_allow_methods" url:"cross_origin_allow_methods"`         // Allowed methods
 	CrossOriginAllowOrigin      string               `json:"cross_origin_allow_origin" url:"cross_origin_allow_origin"`           // Custom value for allow origin
 	CrossOriginAllowOriginAll   bool                 `json:"cross_origin_allow_origin_all" url:"cross_origin_allow_origin_all"`   // Allow all origins
 	CrossOriginEnabled          bool                 `json:"cross_origin_enabled" url:"cross_origin_enabled"`                     // Enable or Disable CrossOrigin
+	ErrorLogPolicy              *ErrorLogPolicy      `json:"error_log_policy" url:"error_log_policy"`                             // Log levels, sampling and suppression for API errors (nil = defaults)
 	FilterFields                []string             `json:"filter_fields" url:"filter_fields"`                                   // Filter out protected fields from logging
 	HTTPRouter                  *nrhttprouter.Router `json:"-" url:"-"`                                                           // NewRelic wrapper for J Schmidt's httprouter
 	Logger                      LoggerInterface      `json:"-" url:"-"`                                                           // Logger interface
+	MaxBodySize                 int64                `json:"max_body_size" url:"max_body_size"`                                   // Maximum request body size in bytes (0 = unlimited)
+	MaxMultipartBodySize        int64                `json:"max_multipart_body_size" url:"max_multipart_body_size"`               // Maximum multipart/form-data body size in bytes (0 = use MaxBodySize)
+	ProblemDetails              bool                 `json:"problem_details" url:"problem_details"`                               // Render error responses as application/problem+json (RFC 9457)
 	SkipLoggingPaths            []string             `json:"skip_logging_paths" url:"skip_logging_paths"`                         // Skip logging on these paths (IE: /health)
 	loadedNewRelic              bool
 }
@@ -114,6 +129,11 @@ func defaultRouter(app *newrelic.Application) (r *Router) {
 	// Default is for the common request methods
 	r.CrossOriginAllowMethods = defaultMethods
 
+	// Compression is opt-in, but ready to go with sensible defaults
+	r.CompressionContentTypes = defaultCompressionContentTypes
+	r.CompressionLevel = gzip.DefaultCompression
+	r.CompressionMinSize = defaultCompressionMinSize
+
 	// Create the router (nil if app is not set)
 	r.HTTPRouter = nrhttprouter.New(app)
 	r.loadedNewRelic = app != nil
@@ -137,7 +157,10 @@ func New() *Router {
 
 // Request will write the request to the logs before and after calling the handler
 func (r *Router) Request(h httprouter.Handle) httprouter.Handle {
-	return parameters.MakeHTTPRouterParsedReq(func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	// Reject any body that exceeded the limit while parsing
+	h = rejectOversizedBody(h)
+
+	return r.limitRequestBody(parameters.MakeHTTPRouterParsedReq(func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 		// Get the params from parameters.GetParams(req)
 		params := GetParams(req)
 
@@ -149,14 +172,22 @@ func (r *Router) Request(h httprouter.Handle) httprouter.Handle {
 			Method:         req.Method,
 			RequestID:      guid.String(),
 			ResponseWriter: w,
-			Status:         0, // future use with E-tags
+			Status:         0, // set by WriteHeader() or Write()
 			URL:            req.URL.String(),
 			UserAgent:      req.UserAgent(),
+			acceptLanguage: req.Header.Get(acceptLanguageHeader),
+			errorLogger:    r.errorLogger(),
+			start:          time.Now(),
 		}
 
 		// Store key information into the request that can be used by other methods
+		req = SetOnRequest(req, errorLoggerKey, writer.errorLogger)
 		req = SetOnRequest(req, ipAddressKey, writer.IPAddress)
 		req = SetOnRequest(req, requestIDKey, writer.RequestID)
+		req = withRouteParams(req, ps)
+		if r.ProblemDetails {
+			req = SetOnRequest(req, problemDetailsKey, true)
+		}
 
 		// Set cross-origin on each request that goes through logging
 		r.SetCrossOriginHeaders(writer, req, ps)
@@ -166,6 +197,10 @@ func (r *Router) Request(h httprouter.Handle) httprouter.Handle {
 			w.Header().Set(exposeHeader, r.AccessControlExposeHeaders)
 		}
 
+		// Compress the response if enabled and accepted by the client
+		r.negotiateCompression(writer, req)
+		defer writer.finish()
+
 		// Do we have paths to skip?
 		// todo: this was added because some requests are confidential or "health-checks" and they can't be split apart from the router
 		var skipLogging bool
@@ -203,13 +238,16 @@ func (r *Router) Request(h httprouter.Handle) httprouter.Handle {
 			// Fire the request (no logging)
 			h(writer, req, ps)
 		}
-	})
+	}))
 }
 
 // RequestNoLogging will just call the handler without any logging
 // Used for API calls that do not require any logging overhead
 func (r *Router) RequestNoLogging(h httprouter.Handle) httprouter.Handle {
-	return parameters.MakeHTTPRouterParsedReq(func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	// Reject any body that exceeded the limit while parsing
+	h = rejectOversizedBody(h)
+
+	return r.limitRequestBody(parameters.MakeHTTPRouterParsedReq(func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 		// Start the custom response writer
 		guid, _ := uuid.NewV4()
 		writer := &APIResponseWriter{
@@ -217,14 +255,22 @@ func (r *Router) RequestNoLogging(h httprouter.Handle) httprouter.Handle {
 			Method:         req.Method,
 			RequestID:      guid.String(),
 			ResponseWriter: w,
-			Status:         0, // future use with E-tags
+			Status:         0, // set by WriteHeader() or Write()
 			URL:            req.URL.String(),
 			UserAgent:      req.UserAgent(),
+			acceptLanguage: req.Header.Get(acceptLanguageHeader),
+			errorLogger:    r.errorLogger(),
+			start:          time.Now(),
 		}
 
 		// Store key information into the request that can be used by other methods
+		req = SetOnRequest(req, errorLoggerKey, writer.errorLogger)
 		req = SetOnRequest(req, ipAddressKey, writer.IPAddress)
 		req = SetOnRequest(req, requestIDKey, writer.RequestID)
+		req = withRouteParams(req, ps)
+		if r.ProblemDetails {
+			req = SetOnRequest(req, problemDetailsKey, true)
+		}
 
 		// Set cross-origin on each request that goes through logging
 		r.SetCrossOriginHeaders(writer, req, ps)
@@ -234,9 +280,13 @@ func (r *Router) RequestNoLogging(h httprouter.Handle) httprouter.Handle {
 			w.Header().Set(exposeHeader, r.AccessControlExposeHeaders)
 		}
 
+		// Compress the response if enabled and accepted by the client
+		r.negotiateCompression(writer, req)
+		defer writer.finish()
+
 		// Fire the request
 		h(writer, req, ps)
-	})
+	}))
 }
 
 // BasicAuth wraps a request for Basic Authentication (RFC 2617)
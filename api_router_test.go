@@ -19,6 +19,17 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// serveRequest fires a request with the given headers through the router
+func serveRequest(router *Router, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequestWithContext(context.Background(), method, path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	router.HTTPRouter.ServeHTTP(rr, req)
+	return rr
+}
+
 // testStruct is for testing restricted fields
 type testStruct struct {
 	ID              uint64 `json:"id"`
@@ -31,7 +31,8 @@ const (
 type Claims struct {
 	jwt.RegisteredClaims // Updated to use RegisteredClaims
 
-	UserID string `json:"user_id"` // The user ID set on the claims
+	Roles  []string `json:"roles,omitempty"` // The roles of the user (see JSONEncodeVisible)
+	UserID string   `json:"user_id"`         // The user ID set on the claims
 }
 
 // CreateToken will make a token from claims
@@ -41,8 +42,10 @@ func (c Claims) CreateToken(expiration time.Duration, sessionSecret string) (str
 		return "", err
 	}
 
-	// Create a new token object, specifying signing method, and the claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, createClaims(c.UserID, c.Issuer, c.ID, expiration))
+	// Create a new token object, specifying signing method, and the claims (keeping the roles)
+	claims := createClaims(c.UserID, c.Issuer, c.ID, expiration)
+	claims.Roles = c.Roles
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign and get the complete encoded token as a string using the secret
 	return token.SignedString([]byte(sessionSecret))
@@ -94,14 +97,14 @@ func createClaims(userID, issuer, sessionID string, expiration time.Duration) Cl
 		expiration = defaultExpiration
 	}
 	return Claims{
-		jwt.RegisteredClaims{ // Updated to use RegisteredClaims
+		RegisteredClaims: jwt.RegisteredClaims{ // Updated to use RegisteredClaims
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration).UTC()),
 			ID:        sessionID,
 			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 			Issuer:    issuer,
 			NotBefore: jwt.NewNumericDate(time.Now().UTC()),
 		},
-		userID,
+		UserID: userID,
 	}
 }
 
@@ -191,15 +194,11 @@ func Check(w http.ResponseWriter, r *http.Request, sessionSecret, issuer string,
 			return authenticated, req, err
 		}
 
-		// Create new token
+		// Create new token (keeping the roles)
+		refreshed := Claims{Roles: claims.Roles, UserID: claims.UserID}
+		refreshed.Issuer, refreshed.ID = issuer, claims.ID
 		var newToken string
-		if newToken, err = CreateToken(
-			sessionSecret,
-			claims.UserID,
-			issuer,
-			claims.ID,
-			sessionAge,
-		); err != nil {
+		if newToken, err = refreshed.CreateToken(sessionAge, sessionSecret); err != nil {
 			return authenticated, req, err
 		}
 
@@ -0,0 +1,423 @@
+package apirouter
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Binding sources (struct tags) in the order they are applied, later sources override earlier ones
+const (
+	bindBody   string = "json"
+	bindQuery  string = "query"
+	bindPath   string = "path"
+	bindHeader string = "header"
+)
+
+// Binding tag options
+const (
+	bindDefaultTag      string = "default"
+	bindRequiredOption  string = "required"
+	bindMultipartMemory int64  = 10 << 20 // Multipart files over this size are stored on disk
+)
+
+// Types with a custom binding
+var (
+	durationType        = reflect.TypeFor[time.Duration]()
+	fileHeaderType      = reflect.TypeFor[*multipart.FileHeader]()
+	fileHeadersType     = reflect.TypeFor[[]*multipart.FileHeader]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// bindSource is where a field is bound from
+type bindSource struct {
+	in       string
+	name     string
+	required bool
+}
+
+// bindField is a struct field with its sources and default
+type bindField struct {
+	defaultValue string
+	hasDefault   bool
+	index        []int
+	sources      []bindSource
+}
+
+// bindFieldCache caches the binding plan of each struct type
+var bindFieldCache sync.Map // map[reflect.Type][]bindField
+
+// Bind decodes the request into the struct pointed to by dst using the field tags:
+//
+//	type CreateUser struct {
+//		Email  string `json:"email,required"`    // JSON, form or multipart body
+//		OrgID  uint64 `path:"org_id,required"`   // httprouter.Params
+//		Page   int    `query:"page" default:"1"` // Query string
+//		Tenant string `header:"X-Tenant"`        // Request header
+//	}
+//
+// Values are converted to the field types (strings, numbers, bools, time.Duration, encoding.TextUnmarshaler
+// and slices of them), the default tag is used for fields without a value, and the required option
+// rejects a missing value. Multipart files bind to *multipart.FileHeader or []*multipart.FileHeader fields.
+// The bound struct is then checked with the validate tags (see Validate).
+//
+// Invalid or missing fields return an *APIError wrapping a ValidationError (422), a body that cannot be decoded
+// returns an *APIError with ErrCodeInvalidBody (400).
+func Bind(req *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return ErrInvalidBindTarget
+	}
+	v = v.Elem()
+
+	body, err := readBindBody(req, v)
+	if err != nil {
+		return err
+	}
+
+	validation := &ValidationError{}
+	pathParams := httprouter.ParamsFromContext(req.Context())
+	query := req.URL.Query()
+	for _, field := range bindFields(v.Type()) {
+		fieldValue, err := v.FieldByIndexErr(field.index)
+		if err != nil {
+			continue // Nil embedded pointer
+		}
+
+		found := false
+		for _, source := range field.sources {
+			var values []string
+			var ok bool
+			switch source.in {
+			case bindBody:
+				values, ok, err = body.values(source.name, fieldValue)
+			case bindQuery:
+				values, ok = query[source.name]
+			case bindPath:
+				var value string
+				if value = pathParams.ByName(source.name); len(value) > 0 {
+					values, ok = []string{value}, true
+				}
+			case bindHeader:
+				values = req.Header.Values(source.name)
+				ok = len(values) > 0
+			}
+
+			switch {
+			case err != nil:
+				validation.Add(FieldPointer(source.name), RuleType, bindTypeMessage(fieldValue.Type()), bindMeta(source.in))
+				found = true
+			case ok:
+				found = true
+				if len(values) > 0 {
+					if err = setBindValue(fieldValue, values); err != nil {
+						validation.Add(FieldPointer(source.name), RuleType, bindTypeMessage(fieldValue.Type()), bindMeta(source.in))
+					}
+				}
+			case source.required:
+				validation.Add(FieldPointer(source.name), RuleRequired, "is required", bindMeta(source.in))
+			}
+			err = nil
+		}
+
+		if !found && field.hasDefault && fieldValue.IsZero() {
+			if err = setBindValue(fieldValue, []string{field.defaultValue}); err != nil {
+				return fmt.Errorf("default for field %v: %w", field.index, err)
+			}
+		}
+	}
+
+	// Type errors from the JSON body
+	for _, fieldErr := range body.errors {
+		validation.Add(fieldErr.Field, fieldErr.Rule, fieldErr.Message, fieldErr.Meta)
+	}
+
+	// Validate the bound values (skipping the fields that already failed to bind)
+	rules := &ValidationError{}
+	if err = validateStruct(v, "", rules); err != nil {
+		return err
+	}
+	for _, fieldErr := range rules.Fields {
+		if !slices.ContainsFunc(validation.Fields, func(f FieldError) bool { return f.Field == fieldErr.Field }) {
+			validation.Fields = append(validation.Fields, fieldErr)
+		}
+	}
+	if validation.Err() != nil {
+		return NewAPIError(req, validation)
+	}
+	return nil
+}
+
+// bindBodyValues are the decoded body fields
+type bindBodyValues struct {
+	errors []FieldError
+	files  map[string][]*multipart.FileHeader
+	form   map[string][]string
+	json   map[string]json.RawMessage
+}
+
+// values returns the form values of the field, or if a JSON key is present (the value is already decoded)
+func (b *bindBodyValues) values(name string, fieldValue reflect.Value) ([]string, bool, error) {
+	if b.json != nil {
+		if _, ok := b.json[name]; ok {
+			return nil, true, nil
+		}
+		for key := range b.json {
+			if strings.EqualFold(key, name) { // The same as encoding/json
+				return nil, true, nil
+			}
+		}
+		return nil, false, nil
+	}
+
+	// Multipart files
+	if files, ok := b.files[name]; ok && len(files) > 0 {
+		switch fieldValue.Type() {
+		case fileHeaderType:
+			fieldValue.Set(reflect.ValueOf(files[0]))
+			return nil, true, nil
+		case fileHeadersType:
+			fieldValue.Set(reflect.ValueOf(files))
+			return nil, true, nil
+		default:
+			return nil, true, ErrUnsupportedBindType
+		}
+	}
+
+	values, ok := b.form[name]
+	return values, ok, nil
+}
+
+// readBindBody decodes a JSON body into the struct, or parses a form or multipart body
+func readBindBody(req *http.Request, v reflect.Value) (*bindBodyValues, error) {
+	body := &bindBodyValues{}
+	if req.Body == nil || req.Body == http.NoBody {
+		return body, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get(contentTypeHeader))
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		data, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(data)) // Restore the body for other readers
+		if err != nil {
+			return nil, bindBodyError(req, err)
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			return body, nil
+		}
+		if err = json.Unmarshal(data, &body.json); err != nil {
+			return nil, bindBodyError(req, err)
+		}
+
+		var typeErr *json.UnmarshalTypeError
+		if err = json.Unmarshal(data, v.Addr().Interface()); errors.As(err, &typeErr) {
+			body.errors = append(body.errors, FieldError{
+				Field:   FieldPointer(strings.Split(typeErr.Field, ".")...),
+				Message: bindTypeMessage(typeErr.Type),
+				Rule:    RuleType,
+			})
+		} else if err != nil {
+			return nil, bindBodyError(req, err)
+		}
+	case mediaType == multipartFormData:
+		if req.MultipartForm == nil {
+			if err := req.ParseMultipartForm(bindMultipartMemory); err != nil {
+				return nil, bindBodyError(req, err)
+			}
+		}
+		body.files, body.form = req.MultipartForm.File, req.MultipartForm.Value
+	case mediaType == "application/x-www-form-urlencoded":
+		if err := req.ParseForm(); err != nil {
+			return nil, bindBodyError(req, err)
+		}
+		body.form = req.PostForm
+	default:
+	}
+	return body, nil
+}
+
+// bindBodyError returns the error for a body that cannot be read or decoded
+func bindBodyError(req *http.Request, err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return NewAPIError(req, err, WithCode(ErrCodeBodyTooLarge))
+	}
+	return NewAPIError(req, err, WithCode(ErrCodeInvalidBody))
+}
+
+// bindFields returns the binding plan of the struct type
+func bindFields(t reflect.Type) []bindField {
+	if cached, ok := bindFieldCache.Load(t); ok {
+		return cached.([]bindField)
+	}
+
+	jsonNames := jsonFields(t)
+	fields := make([]bindField, 0, t.NumField())
+	for _, structField := range reflect.VisibleFields(t) {
+		if !structField.IsExported() || structField.Anonymous {
+			continue
+		}
+
+		field := bindField{index: structField.Index}
+		field.defaultValue, field.hasDefault = structField.Tag.Lookup(bindDefaultTag)
+		for _, in := range []string{bindBody, bindQuery, bindPath, bindHeader} {
+			tag, ok := structField.Tag.Lookup(in)
+			if !ok || tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			if in == bindBody {
+				i := slices.IndexFunc(jsonNames, func(f jsonField) bool { return slices.Equal(f.index, structField.Index) })
+				if i < 0 {
+					continue
+				}
+				name = jsonNames[i].name
+			}
+			if len(name) == 0 {
+				name = structField.Name
+			}
+			field.sources = append(field.sources, bindSource{
+				in:       in,
+				name:     name,
+				required: slices.Contains(strings.Split(options, ","), bindRequiredOption),
+			})
+		}
+		if len(field.sources) > 0 || field.hasDefault {
+			fields = append(fields, field)
+		}
+	}
+
+	bindFieldCache.Store(t, fields)
+	return fields
+}
+
+// setBindValue converts the string values to the field type
+func setBindValue(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setBindValue(v.Elem(), values)
+	}
+
+	value := strings.TrimSpace(values[0])
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+	if v.Type() == durationType {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(duration))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(values[0]))
+			return nil
+		}
+		if len(values) == 1 { // Comma separated (IE: ids=1,2,3)
+			values = strings.Split(values[0], ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, item := range values {
+			if err := setBindValue(slice.Index(i), []string{item}); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.String:
+		v.SetString(values[0])
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return ErrUnsupportedBindType
+	}
+	return nil
+}
+
+// bindTypeMessage returns the public message for a value that cannot be converted to the type
+func bindTypeMessage(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer || (t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8) {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType:
+		return "must be a duration (IE: 1m30s)"
+	case t == timeType:
+		return "must be a date and time (RFC 3339)"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "must be true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "must be an integer"
+	case reflect.Float32, reflect.Float64:
+		return "must be a number"
+	case reflect.String:
+		return "must be a string"
+	case reflect.Struct, reflect.Map:
+		return "must be an object"
+	default:
+		return "has an invalid value"
+	}
+}
+
+// bindMeta returns the field error metadata for the source (body fields have none)
+func bindMeta(in string) map[string]interface{} {
+	if in == bindBody {
+		return nil
+	}
+	return map[string]interface{}{"in": in}
+}
+
+// withRouteParams stores the httprouter.Params on the request (for Bind) if they are not already there
+func withRouteParams(req *http.Request, ps httprouter.Params) *http.Request {
+	if len(ps) == 0 || httprouter.ParamsFromContext(req.Context()) != nil {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), httprouter.ParamsKey, ps))
+}
@@ -0,0 +1,198 @@
+package apirouter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+// testBindUser is the struct used for binding tests
+type testBindUser struct {
+	Active  bool          `json:"active"`
+	Age     int           `json:"age"`
+	Email   string        `json:"email,required"`
+	IDs     []int         `query:"ids"`
+	Ignored string        `json:"-"`
+	Limit   int           `query:"limit" default:"25"`
+	Name    *string       `json:"name"`
+	OrgID   uint64        `path:"org_id,required"`
+	Since   time.Time     `query:"since"`
+	Tenant  string        `header:"X-Tenant"`
+	Timeout time.Duration `query:"timeout" default:"30s"`
+}
+
+// testBindUpload is the struct used for multipart binding tests
+type testBindUpload struct {
+	Avatar *multipart.FileHeader   `json:"avatar,required"`
+	Files  []*multipart.FileHeader `json:"files"`
+	Title  string                  `json:"title"`
+}
+
+// newBindRequest creates a request with the route params on the context
+func newBindRequest(method, target, contentType string, body []byte, ps httprouter.Params) *http.Request {
+	req := httptest.NewRequestWithContext(context.Background(), method, target, bytes.NewReader(body))
+	if len(contentType) > 0 {
+		req.Header.Set(contentTypeHeader, contentType)
+	}
+	return withRouteParams(req, ps)
+}
+
+// bindFieldErrors returns the field errors of a Bind() error
+func bindFieldErrors(t *testing.T, err error) []FieldError {
+	t.Helper()
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, ErrCodeValidation, apiErr.Code)
+	require.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+
+	var validation *ValidationError
+	require.ErrorAs(t, err, &validation)
+	return validation.Fields
+}
+
+// TestBind tests binding from all the sources
+func TestBind(t *testing.T) {
+	t.Parallel()
+
+	orgParams := httprouter.Params{{Key: "org_id", Value: "42"}}
+
+	t.Run("json body, query, path and header", func(t *testing.T) {
+		req := newBindRequest(
+			http.MethodPost, "/orgs/42/users?ids=1,2,3&since=2024-01-02T03:04:05Z&timeout=1m", "application/json; charset=utf-8",
+			[]byte(`{"active":true,"age":30,"email":"a@b.com","name":"Ann","Ignored":"x"}`), orgParams,
+		)
+		req.Header.Set("X-Tenant", "acme")
+
+		var user testBindUser
+		require.NoError(t, Bind(req, &user))
+		require.True(t, user.Active)
+		require.Equal(t, 30, user.Age)
+		require.Equal(t, "a@b.com", user.Email)
+		require.Equal(t, []int{1, 2, 3}, user.IDs)
+		require.Empty(t, user.Ignored)
+		require.Equal(t, 25, user.Limit)
+		require.Equal(t, "Ann", *user.Name)
+		require.Equal(t, uint64(42), user.OrgID)
+		require.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), user.Since)
+		require.Equal(t, "acme", user.Tenant)
+		require.Equal(t, time.Minute, user.Timeout)
+
+		// The body can still be read
+		body := new(bytes.Buffer)
+		_, err := body.ReadFrom(req.Body)
+		require.NoError(t, err)
+		require.Contains(t, body.String(), "a@b.com")
+	})
+
+	t.Run("repeated query values", func(t *testing.T) {
+		var user testBindUser
+		req := newBindRequest(http.MethodGet, "/?ids=4&ids=5&email=x", "", nil, orgParams)
+		require.Error(t, Bind(req, &user)) // email is a body field
+		require.Equal(t, []int{4, 5}, user.IDs)
+	})
+
+	t.Run("form body", func(t *testing.T) {
+		form := url.Values{"active": {"true"}, "age": {"31"}, "email": {"f@b.com"}, "name": {"Bo"}}
+		req := newBindRequest(http.MethodPost, "/?limit=5", "application/x-www-form-urlencoded", []byte(form.Encode()), orgParams)
+
+		var user testBindUser
+		require.NoError(t, Bind(req, &user))
+		require.True(t, user.Active)
+		require.Equal(t, 31, user.Age)
+		require.Equal(t, "f@b.com", user.Email)
+		require.Equal(t, "Bo", *user.Name)
+		require.Equal(t, 5, user.Limit)
+	})
+
+	t.Run("multipart body", func(t *testing.T) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		require.NoError(t, writer.WriteField("title", "photos"))
+		for _, name := range []string{"avatar", "files", "files"} {
+			part, err := writer.CreateFormFile(name, name+".png")
+			require.NoError(t, err)
+			_, err = part.Write([]byte("png"))
+			require.NoError(t, err)
+		}
+		require.NoError(t, writer.Close())
+
+		var upload testBindUpload
+		req := newBindRequest(http.MethodPost, "/", writer.FormDataContentType(), body.Bytes(), nil)
+		require.NoError(t, Bind(req, &upload))
+		require.Equal(t, "photos", upload.Title)
+		require.Equal(t, "avatar.png", upload.Avatar.Filename)
+		require.Len(t, upload.Files, 2)
+	})
+
+	t.Run("field errors", func(t *testing.T) {
+		req := newBindRequest(http.MethodPost, "/?limit=ten&ids=1,x&timeout=soon", "application/json", []byte(`{"age":"old"}`), nil)
+
+		var user testBindUser
+		fields := bindFieldErrors(t, Bind(req, &user))
+		require.ElementsMatch(t, []FieldError{
+			{Field: "/email", Message: "is required", Rule: RuleRequired},
+			{Field: "/ids", Message: "must be an integer", Meta: map[string]interface{}{"in": "query"}, Rule: RuleType},
+			{Field: "/limit", Message: "must be an integer", Meta: map[string]interface{}{"in": "query"}, Rule: RuleType},
+			{Field: "/org_id", Message: "is required", Meta: map[string]interface{}{"in": "path"}, Rule: RuleRequired},
+			{Field: "/timeout", Message: "must be a duration (IE: 1m30s)", Meta: map[string]interface{}{"in": "query"}, Rule: RuleType},
+			{Field: "/age", Message: "must be an integer", Rule: RuleType},
+		}, fields)
+	})
+
+	t.Run("malformed json", func(t *testing.T) {
+		req := newBindRequest(http.MethodPost, "/", "application/json", []byte(`{"email":`), orgParams)
+
+		var user testBindUser
+		err := Bind(req, &user)
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, ErrCodeInvalidBody, apiErr.Code)
+		require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	})
+
+	t.Run("invalid target", func(t *testing.T) {
+		req := newBindRequest(http.MethodGet, "/", "", nil, nil)
+		var user testBindUser
+		require.ErrorIs(t, Bind(req, user), ErrInvalidBindTarget)
+		require.ErrorIs(t, Bind(req, (*testBindUser)(nil)), ErrInvalidBindTarget)
+		require.ErrorIs(t, Bind(req, new(string)), ErrInvalidBindTarget)
+	})
+
+	t.Run("through the router", func(t *testing.T) {
+		router := New()
+		var user testBindUser
+		var bindErr error
+		router.HTTPRouter.POST("/orgs/:org_id/users", router.RequestNoLogging(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+			if bindErr = Bind(req, &user); bindErr != nil {
+				RespondWith(w, req, http.StatusBadRequest, bindErr)
+			}
+		}))
+
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/orgs/7/users", strings.NewReader(`{"email":"r@b.com"}`))
+		req.Header.Set(contentTypeHeader, "application/json")
+		w := httptest.NewRecorder()
+		router.HTTPRouter.ServeHTTP(w, req)
+		require.NoError(t, bindErr)
+		require.Equal(t, uint64(7), user.OrgID)
+		require.Equal(t, "r@b.com", user.Email)
+
+		req = httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/orgs/7/users", strings.NewReader(`{}`))
+		req.Header.Set(contentTypeHeader, "application/json")
+		w = httptest.NewRecorder()
+		router.HTTPRouter.ServeHTTP(w, req)
+		require.True(t, errors.As(bindErr, new(*ValidationError)))
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		require.Contains(t, w.Body.String(), `"field":"/email"`)
+	})
+}
@@ -0,0 +1,111 @@
+package apirouter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// multipartFormData is the media type used for file uploads
+const multipartFormData = "multipart/form-data"
+
+// BodyLimits overrides the Router's request body size limits (in bytes) for a single route.
+// A zero value inherits the Router setting and a negative value removes the limit.
+type BodyLimits struct {
+	MaxBodySize          int64 `json:"max_body_size" url:"max_body_size"`                     // Limit for all non-multipart bodies
+	MaxMultipartBodySize int64 `json:"max_multipart_body_size" url:"max_multipart_body_size"` // Limit for multipart/form-data bodies
+}
+
+// bodyLimitReader wraps http.MaxBytesReader and remembers if the limit was exceeded
+type bodyLimitReader struct {
+	io.ReadCloser
+
+	exceeded bool
+	limit    int64
+}
+
+// Read reads from the limited body and flags the reader once the limit is hit
+func (b *bodyLimitReader) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// WithBodyLimits overrides the body size limits for a single route.
+// The limits are enforced before parsing, so this must wrap the handle returned by Request() or RequestNoLogging():
+//
+//	router.HTTPRouter.POST("/upload", apirouter.WithBodyLimits(router.Request(upload), apirouter.BodyLimits{MaxMultipartBodySize: 50 << 20}))
+func WithBodyLimits(h httprouter.Handle, limits BodyLimits) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		h(w, SetOnRequest(req, bodyLimitsKey, limits), ps)
+	}
+}
+
+// bodyLimit returns the body size limit for the request (0 or less is unlimited)
+func (r *Router) bodyLimit(req *http.Request) int64 {
+	// Route overrides take precedence over the router settings
+	limits, _ := req.Context().Value(bodyLimitsKey).(BodyLimits)
+	limit := firstLimit(limits.MaxBodySize, r.MaxBodySize)
+
+	// Multipart uploads have their own limit (falling back to the general limit)
+	if mediaType, _, err := mime.ParseMediaType(req.Header.Get(contentTypeHeader)); err == nil && mediaType == multipartFormData {
+		limit = firstLimit(limits.MaxMultipartBodySize, r.MaxMultipartBodySize, limit)
+	}
+
+	return limit
+}
+
+// firstLimit returns the first limit that is set (non-zero)
+func firstLimit(limits ...int64) int64 {
+	for _, limit := range limits {
+		if limit != 0 {
+			return limit
+		}
+	}
+	return 0
+}
+
+// limitRequestBody caps the request body using http.MaxBytesReader before the parameters are parsed
+func (r *Router) limitRequestBody(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		if limit := r.bodyLimit(req); limit > 0 && req.Body != nil && req.Body != http.NoBody {
+			reader := &bodyLimitReader{limit: limit}
+
+			// Do not bother reading a body that is already declared too large
+			if req.ContentLength > limit {
+				_ = req.Body.Close()
+				reader.exceeded = true
+				reader.ReadCloser = http.NoBody
+			} else {
+				reader.ReadCloser = http.MaxBytesReader(w, req.Body, limit)
+			}
+
+			req.Body = reader
+			req = SetOnRequest(req, bodyReaderKey, reader)
+		}
+		h(w, req, ps)
+	}
+}
+
+// rejectOversizedBody responds with a 413 if the request body exceeded its limit during parsing
+func rejectOversizedBody(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		if reader, ok := req.Context().Value(bodyReaderKey).(*bodyLimitReader); ok && reader.exceeded {
+			RespondWith(w, req, http.StatusRequestEntityTooLarge, ErrorFromRequest(
+				req,
+				fmt.Sprintf("request body exceeded the limit of %d bytes", reader.limit),
+				fmt.Sprintf("request body is too large, the maximum allowed size is %d bytes", reader.limit),
+				ErrCodeBodyTooLarge, http.StatusRequestEntityTooLarge, nil,
+			))
+			return
+		}
+		h(w, req, ps)
+	}
+}
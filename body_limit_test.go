@@ -0,0 +1,152 @@
+package apirouter
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+// bodyLimitTestHandler echos the size of the body it received
+func bodyLimitTestHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	body, _ := io.ReadAll(req.Body)
+	RespondWith(w, req, http.StatusOK, map[string]int{"size": len(body)})
+}
+
+// newBodyLimitRequest creates a POST request with a JSON body of the given size
+func newBodyLimitRequest(size int, chunked bool) *http.Request {
+	body := `{"data":"` + strings.Repeat("a", size-11) + `"}`
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/upload", strings.NewReader(body))
+	req.Header.Set(contentTypeHeader, "application/json")
+	if chunked {
+		req.ContentLength = -1
+	}
+	return req
+}
+
+// newMultipartRequest creates a multipart upload request with a file of the given size
+func newMultipartRequest(t *testing.T, size int) *http.Request {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, err := mw.CreateFormFile("file", "upload.txt")
+	require.NoError(t, err)
+	_, err = part.Write(bytes.Repeat([]byte("a"), size))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/upload", &buf)
+	req.Header.Set(contentTypeHeader, mw.FormDataContentType())
+	return req
+}
+
+// TestRouter_MaxBodySize tests the body size limits on Request()
+func TestRouter_MaxBodySize(t *testing.T) {
+	t.Parallel()
+
+	t.Run("body under the limit is accepted", func(t *testing.T) {
+		router := New()
+		router.MaxBodySize = 1024
+		router.HTTPRouter.POST("/upload", router.Request(bodyLimitTestHandler))
+
+		rr := httptest.NewRecorder()
+		router.HTTPRouter.ServeHTTP(rr, newBodyLimitRequest(512, false))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, `{"size":512}`, rr.Body.String())
+	})
+
+	t.Run("declared content length over the limit is rejected", func(t *testing.T) {
+		router := New()
+		router.MaxBodySize = 100
+		router.HTTPRouter.POST("/upload", router.Request(bodyLimitTestHandler))
+
+		rr := httptest.NewRecorder()
+		router.HTTPRouter.ServeHTTP(rr, newBodyLimitRequest(512, false))
+		require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+		require.JSONEq(t, `{"error":"request body is too large, the maximum allowed size is 100 bytes"}`, rr.Body.String())
+	})
+
+	t.Run("chunked body over the limit is rejected", func(t *testing.T) {
+		router := New()
+		router.MaxBodySize = 100
+		router.HTTPRouter.POST("/upload", router.RequestNoLogging(bodyLimitTestHandler))
+
+		rr := httptest.NewRecorder()
+		router.HTTPRouter.ServeHTTP(rr, newBodyLimitRequest(512, true))
+		require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	})
+
+	t.Run("no limit by default", func(t *testing.T) {
+		router := New()
+		router.HTTPRouter.POST("/upload", router.Request(bodyLimitTestHandler))
+
+		rr := httptest.NewRecorder()
+		router.HTTPRouter.ServeHTTP(rr, newBodyLimitRequest(1<<20, true))
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("multipart uses its own limit", func(t *testing.T) {
+		router := New()
+		router.MaxBodySize = 100
+		router.MaxMultipartBodySize = 4096
+		router.HTTPRouter.POST("/upload", router.Request(bodyLimitTestHandler))
+
+		rr := httptest.NewRecorder()
+		router.HTTPRouter.ServeHTTP(rr, newMultipartRequest(t, 1024))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = httptest.NewRecorder()
+		router.HTTPRouter.ServeHTTP(rr, newMultipartRequest(t, 8192))
+		require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	})
+
+	t.Run("multipart falls back to the general limit", func(t *testing.T) {
+		router := New()
+		router.MaxBodySize = 100
+		router.HTTPRouter.POST("/upload", router.Request(bodyLimitTestHandler))
+
+		rr := httptest.NewRecorder()
+		router.HTTPRouter.ServeHTTP(rr, newMultipartRequest(t, 1024))
+		require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	})
+}
+
+// TestWithBodyLimits tests the per-route body limit overrides
+func TestWithBodyLimits(t *testing.T) {
+	t.Parallel()
+
+	t.Run("route limit overrides the router limit", func(t *testing.T) {
+		router := New()
+		router.MaxBodySize = 100
+		router.HTTPRouter.POST("/upload", WithBodyLimits(router.Request(bodyLimitTestHandler), BodyLimits{MaxBodySize: 1024}))
+
+		rr := httptest.NewRecorder()
+		router.HTTPRouter.ServeHTTP(rr, newBodyLimitRequest(512, false))
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("negative route limit removes the limit", func(t *testing.T) {
+		router := New()
+		router.MaxBodySize = 100
+		router.HTTPRouter.POST("/upload", WithBodyLimits(router.Request(bodyLimitTestHandler), BodyLimits{MaxBodySize: -1}))
+
+		rr := httptest.NewRecorder()
+		router.HTTPRouter.ServeHTTP(rr, newBodyLimitRequest(4096, true))
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("route multipart limit", func(t *testing.T) {
+		router := New()
+		router.HTTPRouter.POST("/upload", WithBodyLimits(router.Request(bodyLimitTestHandler), BodyLimits{MaxMultipartBodySize: 512}))
+
+		rr := httptest.NewRecorder()
+		router.HTTPRouter.ServeHTTP(rr, newMultipartRequest(t, 1024))
+		require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	})
+}
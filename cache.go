@@ -0,0 +1,144 @@
+package apirouter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Cache headers
+const (
+	ageHeader       string = "Age"
+	cacheHit        string = "HIT"
+	cacheMiss       string = "MISS"
+	cookieHeader    string = "Cookie"
+	setCookieHeader string = "Set-Cookie"
+	xCacheHeader    string = "X-Cache"
+)
+
+// CacheOptions is the configuration for the Cache middleware
+type CacheOptions struct {
+	// KeyIdentifiers returns extra values for the cache key (IE: the user id for per-user responses).
+	// Without it, authenticated requests and responses are never cached.
+	KeyIdentifiers func(req *http.Request) []string
+
+	// Store is where responses are kept (defaults to an in-memory LRU store)
+	Store CacheStore
+
+	// VaryHeaders are request headers that are part of the cache key (IE: Accept, Accept-Language)
+	VaryHeaders []string
+}
+
+// Cache returns middleware that caches GET/HEAD responses in the store.
+//
+// A handler opts in by setting CacheTTL on the APIResponseWriter, and can tag the response
+// with AddCacheIdentifier() so it can be invalidated later with CacheStore.Invalidate().
+// Cached responses are served without invoking the handler, and every response gets an X-Cache HIT or MISS header.
+// Responses that set cookies (IE: a refreshed session token) or are not 200 OK are never stored.
+// Unless KeyIdentifiers are set, requests with an Authorization or Cookie header skip the cache,
+// and authenticated responses are not stored, so one user's response is never served to another.
+func Cache(options CacheOptions) Middleware {
+	if options.Store == nil {
+		options.Store = NewMemoryCacheStore(defaultCacheCapacity)
+	}
+
+	return func(h httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+			// Only safe methods are cached
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				h(w, req, ps)
+				return
+			}
+
+			key := cacheKey(req, options)
+			writer := responseWriterFor(w)
+			header := writer.Header()
+			shared := options.KeyIdentifiers == nil // The key does not identify the user
+			if shared && isPrivateRequest(req) {
+				header.Set(xCacheHeader, cacheMiss)
+				h(writer, req, ps)
+				return
+			}
+
+			// Serve the hit without the handler
+			if cached, found := options.Store.Get(req.Context(), key); found {
+				for name, values := range cached.Header {
+					header[name] = slices.Clone(values)
+				}
+				header.Set(ageHeader, strconv.Itoa(int(time.Since(cached.Stored)/time.Second)))
+				header.Set(xCacheHeader, cacheHit)
+				writer.writeBuffered(cached.Status, cached.Body)
+				return
+			}
+
+			// Remember the headers that were set before the handler (IE: CORS headers are per request)
+			before := header.Clone()
+			status, body := writer.bufferResponse(h, req, ps)
+
+			if writer.CacheTTL > 0 && status == http.StatusOK && len(header.Values(setCookieHeader)) == 0 &&
+				(!shared || !isAuthenticatedResponse(req, header)) {
+				now := time.Now()
+				_ = options.Store.Set(req.Context(), key, &CachedResponse{
+					Body:    body,
+					Expires: now.Add(writer.CacheTTL),
+					Header:  changedHeaders(before, header),
+					Status:  status,
+					Stored:  now,
+					Tags:    slices.Clone(writer.CacheIdentifier),
+				})
+			}
+
+			header.Set(xCacheHeader, cacheMiss)
+			writer.writeBuffered(status, body)
+		}
+	}
+}
+
+// cacheKey builds the cache key from the route, query, key identifiers and vary headers
+func cacheKey(req *http.Request, options CacheOptions) string {
+	var b strings.Builder
+	b.WriteString(req.Method)
+	b.WriteString(" ")
+	b.WriteString(req.URL.Path)
+	b.WriteString("?")
+	b.WriteString(req.URL.Query().Encode()) // Sorted by key
+
+	if options.KeyIdentifiers != nil {
+		for _, identifier := range options.KeyIdentifiers(req) {
+			b.WriteString("\n")
+			b.WriteString(identifier)
+		}
+	}
+
+	for _, name := range options.VaryHeaders {
+		b.WriteString("\n")
+		b.WriteString(http.CanonicalHeaderKey(name))
+		b.WriteString(":")
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// isPrivateRequest checks if the request has credentials (an Authorization or Cookie header)
+func isPrivateRequest(req *http.Request) bool {
+	return len(req.Header.Get(AuthorizationHeader)) > 0 || len(req.Header.Get(cookieHeader)) > 0
+}
+
+// changedHeaders returns the headers that were added or changed since the snapshot
+func changedHeaders(before, after http.Header) http.Header {
+	changed := make(http.Header)
+	for name, values := range after {
+		if !slices.Equal(before[name], values) {
+			changed[name] = slices.Clone(values)
+		}
+	}
+	return changed
+}
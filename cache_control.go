@@ -0,0 +1,148 @@
+package apirouter
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Cache-Control header and directives
+const (
+	cacheControlHeader  string = "Cache-Control"
+	cacheNoStore        string = "no-store"
+	cachePrivateNoStore string = "private, no-store"
+)
+
+// CachePolicy is a declarative Cache-Control policy
+type CachePolicy struct {
+	AllowAuthenticated   bool          `json:"allow_authenticated" url:"allow_authenticated"`       // Keep the policy on authenticated responses (default is to force no-store)
+	Immutable            bool          `json:"immutable" url:"immutable"`                           // The response will never change while fresh
+	MaxAge               time.Duration `json:"max_age" url:"max_age"`                               // Freshness lifetime for all caches
+	MustRevalidate       bool          `json:"must_revalidate" url:"must_revalidate"`               // Stale responses must be revalidated
+	NoCache              bool          `json:"no_cache" url:"no_cache"`                             // Caches must revalidate before every use
+	NoStore              bool          `json:"no_store" url:"no_store"`                             // The response must not be stored at all
+	Private              bool          `json:"private" url:"private"`                               // Only the client may cache the response (wins over Public)
+	Public               bool          `json:"public" url:"public"`                                 // Shared caches (CDN, proxy) may cache the response
+	SMaxAge              time.Duration `json:"s_maxage" url:"s_maxage"`                             // Freshness lifetime for shared caches
+	StaleIfError         time.Duration `json:"stale_if_error" url:"stale_if_error"`                 // How long a stale response can be used if the origin errors
+	StaleWhileRevalidate time.Duration `json:"stale_while_revalidate" url:"stale_while_revalidate"` // How long a stale response can be used while revalidating
+	Vary                 []string      `json:"vary" url:"vary"`                                     // Request headers that change the response
+}
+
+// String returns the Cache-Control header value for the policy.
+// A policy without any freshness (max-age, s-maxage or immutable) defaults to no-cache.
+func (p CachePolicy) String() string {
+	if p.NoStore {
+		return cacheNoStore
+	}
+
+	directives := make([]string, 0, 8)
+	if p.Private {
+		directives = append(directives, "private")
+	} else if p.Public {
+		directives = append(directives, "public")
+	}
+	if p.NoCache || (p.MaxAge <= 0 && p.SMaxAge <= 0 && !p.Immutable) {
+		directives = append(directives, "no-cache")
+	}
+	if p.MaxAge > 0 {
+		directives = append(directives, "max-age="+seconds(p.MaxAge))
+	}
+	if p.SMaxAge > 0 && !p.Private {
+		directives = append(directives, "s-maxage="+seconds(p.SMaxAge))
+	}
+	if p.MustRevalidate {
+		directives = append(directives, "must-revalidate")
+	}
+	if p.StaleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+seconds(p.StaleWhileRevalidate))
+	}
+	if p.StaleIfError > 0 {
+		directives = append(directives, "stale-if-error="+seconds(p.StaleIfError))
+	}
+	if p.Immutable {
+		directives = append(directives, "immutable")
+	}
+	return strings.Join(directives, ", ")
+}
+
+// SetCachePolicy sets the Cache-Control and Vary headers for the policy on the response
+func SetCachePolicy(w http.ResponseWriter, policy CachePolicy) {
+	header := w.Header()
+	header.Set(cacheControlHeader, policy.String())
+	for _, name := range policy.Vary {
+		addVary(header, name)
+	}
+}
+
+// CacheControl returns middleware that applies the cache policy to every response of a route or group.
+//
+// Handlers can still override the policy with SetCachePolicy() or NoCache(). Unless AllowAuthenticated is set,
+// authenticated responses (IE: Check() succeeded and refreshed the token) are forced to "private, no-store",
+// and server errors are never cached.
+func CacheControl(policy CachePolicy) Middleware {
+	return func(h httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+			SetCachePolicy(w, policy)
+
+			// Check the final response right before the headers are sent
+			if writer, ok := w.(*APIResponseWriter); ok {
+				writer.onWriteHeader(func(status int) {
+					header := writer.Header()
+					if status >= http.StatusInternalServerError {
+						header.Set(cacheControlHeader, cacheNoStore)
+					} else if !policy.AllowAuthenticated && isAuthenticatedResponse(req, header) {
+						header.Set(cacheControlHeader, cachePrivateNoStore)
+					}
+				})
+			} else if !policy.AllowAuthenticated && isAuthenticatedResponse(req, w.Header()) {
+				w.Header().Set(cacheControlHeader, cachePrivateNoStore)
+			}
+
+			h(w, req, ps)
+		}
+	}
+}
+
+// isAuthenticatedResponse detects a response for an authenticated user (claims on the request, or a token on the response)
+func isAuthenticatedResponse(req *http.Request, header http.Header) bool {
+	if claims, ok := GetCustomData(req).(*Claims); ok && !claims.IsEmpty() {
+		return true
+	}
+	if len(header.Get(AuthorizationHeader)) > 0 {
+		return true
+	}
+	for _, cookie := range header.Values(setCookieHeader) {
+		if strings.HasPrefix(cookie, CookieName+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// addVary adds the header name to the Vary header if not already present
+func addVary(header http.Header, name string) {
+	if !hasVary(header, name) {
+		header.Add(varyHeaderString, name)
+	}
+}
+
+// hasVary checks if the Vary header lists the header name
+func hasVary(header http.Header, name string) bool {
+	for _, value := range header.Values(varyHeaderString) {
+		for _, existing := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(existing), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// seconds formats the duration as whole seconds
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
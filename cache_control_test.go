@@ -0,0 +1,129 @@
+package apirouter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCachePolicy_String tests the Cache-Control values of a CachePolicy
+func TestCachePolicy_String(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		policy   CachePolicy
+		expected string
+	}{
+		{"zero policy is no-cache", CachePolicy{}, "no-cache"},
+		{"no-store wins", CachePolicy{NoStore: true, Public: true, MaxAge: time.Hour}, "no-store"},
+		{"public max-age", CachePolicy{Public: true, MaxAge: time.Minute}, "public, max-age=60"},
+		{"private ignores public and s-maxage", CachePolicy{Private: true, Public: true, MaxAge: time.Minute, SMaxAge: time.Hour}, "private, max-age=60"},
+		{
+			"shared cache with stale directives",
+			CachePolicy{Public: true, MaxAge: time.Minute, SMaxAge: 10 * time.Minute, StaleWhileRevalidate: 30 * time.Second, StaleIfError: time.Hour},
+			"public, max-age=60, s-maxage=600, stale-while-revalidate=30, stale-if-error=3600",
+		},
+		{"immutable assets", CachePolicy{Public: true, MaxAge: 365 * 24 * time.Hour, Immutable: true}, "public, max-age=31536000, immutable"},
+		{"revalidate", CachePolicy{Private: true, NoCache: true, MustRevalidate: true}, "private, no-cache, must-revalidate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.policy.String())
+		})
+	}
+}
+
+// TestSetCachePolicy tests SetCachePolicy() sets the headers without duplicate Vary values
+func TestSetCachePolicy(t *testing.T) {
+	t.Parallel()
+
+	w := httptest.NewRecorder()
+	w.Header().Set(varyHeaderString, "Origin, accept-language")
+	SetCachePolicy(w, CachePolicy{Public: true, MaxAge: time.Minute, Vary: []string{"Accept-Language", "Accept"}})
+
+	require.Equal(t, "public, max-age=60", w.Header().Get(cacheControlHeader))
+	require.Equal(t, []string{"Origin, accept-language", "Accept"}, w.Header().Values(varyHeaderString))
+}
+
+// cacheControlTestRouter creates a router with the CacheControl middleware on a resource
+func cacheControlTestRouter(policy CachePolicy, handler httprouter.Handle, claims *Claims) *Router {
+	router := New()
+	s := NewStack()
+	if claims != nil {
+		s.Use(func(h httprouter.Handle) httprouter.Handle {
+			return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+				h(w, SetCustomData(req, claims), ps)
+			}
+		})
+	}
+	s.Use(CacheControl(policy))
+	router.HTTPRouter.GET("/resource", router.Request(s.Wrap(handler)))
+	return router
+}
+
+// TestCacheControl tests the CacheControl middleware
+func TestCacheControl(t *testing.T) {
+	t.Parallel()
+
+	publicPolicy := CachePolicy{Public: true, MaxAge: time.Minute, Vary: []string{"Accept"}}
+	okHandler := func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		RespondWith(w, req, http.StatusOK, map[string]string{"ok": "yes"})
+	}
+
+	t.Run("applies the policy", func(t *testing.T) {
+		rr := serveRequest(cacheControlTestRouter(publicPolicy, okHandler, nil), http.MethodGet, "/resource", nil)
+		require.Equal(t, "public, max-age=60", rr.Header().Get(cacheControlHeader))
+		require.Contains(t, rr.Header().Values(varyHeaderString), "Accept")
+	})
+
+	t.Run("handler can override the policy", func(t *testing.T) {
+		router := cacheControlTestRouter(publicPolicy, func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+			NoCache(w, req)
+			RespondWith(w, req, http.StatusOK, nil)
+		}, nil)
+		rr := serveRequest(router, http.MethodGet, "/resource", nil)
+		require.Equal(t, noCacheHeaders["Cache-Control"], rr.Header().Get(cacheControlHeader))
+	})
+
+	t.Run("token refreshed by Check forces no-store", func(t *testing.T) {
+		router := cacheControlTestRouter(publicPolicy, func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+			SetTokenHeader(w, req, "token", time.Minute)
+			RespondWith(w, req, http.StatusOK, nil)
+		}, nil)
+		rr := serveRequest(router, http.MethodGet, "/resource", nil)
+		require.Equal(t, cachePrivateNoStore, rr.Header().Get(cacheControlHeader))
+	})
+
+	t.Run("claims on the request force no-store", func(t *testing.T) {
+		rr := serveRequest(cacheControlTestRouter(publicPolicy, okHandler, &Claims{UserID: testUserID123}), http.MethodGet, "/resource", nil)
+		require.Equal(t, cachePrivateNoStore, rr.Header().Get(cacheControlHeader))
+	})
+
+	t.Run("allow authenticated keeps the policy", func(t *testing.T) {
+		policy := CachePolicy{Private: true, MaxAge: time.Minute, AllowAuthenticated: true}
+		rr := serveRequest(cacheControlTestRouter(policy, okHandler, &Claims{UserID: testUserID123}), http.MethodGet, "/resource", nil)
+		require.Equal(t, "private, max-age=60", rr.Header().Get(cacheControlHeader))
+	})
+
+	t.Run("server errors are not cached", func(t *testing.T) {
+		router := cacheControlTestRouter(publicPolicy, func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+			RespondWith(w, req, http.StatusInternalServerError, nil)
+		}, nil)
+		rr := serveRequest(router, http.MethodGet, "/resource", nil)
+		require.Equal(t, cacheNoStore, rr.Header().Get(cacheControlHeader))
+	})
+
+	t.Run("works without an APIResponseWriter", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/resource", nil)
+		rr := httptest.NewRecorder()
+		CacheControl(publicPolicy)(okHandler)(rr, SetCustomData(req, &Claims{UserID: testUserID123}), nil)
+		require.Equal(t, cachePrivateNoStore, rr.Header().Get(cacheControlHeader))
+	})
+}
@@ -0,0 +1,145 @@
+package apirouter
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultCacheCapacity is the number of responses kept by the default in-memory store
+const defaultCacheCapacity = 1000
+
+// CachedResponse is a response stored by the Cache middleware
+type CachedResponse struct {
+	Body    []byte      `json:"body" url:"body"`       // Response body
+	Expires time.Time   `json:"expires" url:"expires"` // When the response is no longer fresh
+	Header  http.Header `json:"header" url:"header"`   // Headers set by the handler
+	Status  int         `json:"status" url:"status"`   // HTTP status code
+	Stored  time.Time   `json:"stored" url:"stored"`   // When the response was stored (used for the Age header)
+	Tags    []string    `json:"tags" url:"tags"`       // Cache identifiers used for invalidation
+}
+
+// CacheStore is the interface for storing cached responses (IE: in-memory, Redis)
+type CacheStore interface {
+	// Get returns the cached response for the key if found and not expired
+	Get(ctx context.Context, key string) (*CachedResponse, bool)
+
+	// Set stores the response under the key, indexed by the response tags
+	Set(ctx context.Context, key string, response *CachedResponse) error
+
+	// Invalidate removes all responses that have any of the tags
+	Invalidate(ctx context.Context, tags ...string) error
+}
+
+// memoryCacheEntry is an element in the LRU list
+type memoryCacheEntry struct {
+	key      string
+	response *CachedResponse
+}
+
+// MemoryCacheStore is an in-memory LRU implementation of CacheStore
+type MemoryCacheStore struct {
+	capacity int
+	entries  map[string]*list.Element
+	mu       sync.Mutex
+	recent   *list.List
+	tags     map[string]map[string]struct{}
+}
+
+// NewMemoryCacheStore creates an in-memory LRU cache store holding up to capacity responses
+func NewMemoryCacheStore(capacity int) *MemoryCacheStore {
+	if capacity <= 0 {
+		capacity = defaultCacheCapacity
+	}
+	return &MemoryCacheStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element, capacity),
+		recent:   list.New(),
+		tags:     make(map[string]map[string]struct{}),
+	}
+}
+
+// Get returns the cached response for the key if found and not expired
+func (m *MemoryCacheStore) Get(_ context.Context, key string) (*CachedResponse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.response.Expires) {
+		m.remove(element)
+		return nil, false
+	}
+
+	m.recent.MoveToFront(element)
+	return entry.response, true
+}
+
+// Set stores the response under the key, evicting the least recently used response if full
+func (m *MemoryCacheStore) Set(_ context.Context, key string, response *CachedResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Replace any existing response
+	if element, ok := m.entries[key]; ok {
+		m.remove(element)
+	}
+
+	m.entries[key] = m.recent.PushFront(&memoryCacheEntry{key: key, response: response})
+	for _, tag := range response.Tags {
+		if m.tags[tag] == nil {
+			m.tags[tag] = make(map[string]struct{})
+		}
+		m.tags[tag][key] = struct{}{}
+	}
+
+	// Evict the oldest responses
+	for m.recent.Len() > m.capacity {
+		m.remove(m.recent.Back())
+	}
+	return nil
+}
+
+// Invalidate removes all responses that have any of the tags
+func (m *MemoryCacheStore) Invalidate(_ context.Context, tags ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range m.tags[tag] {
+			if element, ok := m.entries[key]; ok {
+				m.remove(element)
+			}
+		}
+		delete(m.tags, tag)
+	}
+	return nil
+}
+
+// Len returns the number of responses in the store
+func (m *MemoryCacheStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.recent.Len()
+}
+
+// remove deletes the element from the list, map and tag index (lock must be held)
+func (m *MemoryCacheStore) remove(element *list.Element) {
+	entry := element.Value.(*memoryCacheEntry)
+	m.recent.Remove(element)
+	delete(m.entries, entry.key)
+	for _, tag := range entry.response.Tags {
+		if keys, ok := m.tags[tag]; ok {
+			delete(keys, entry.key)
+			if len(keys) == 0 {
+				delete(m.tags, tag)
+			}
+		}
+	}
+}
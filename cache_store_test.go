@@ -0,0 +1,98 @@
+package apirouter
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCachedResponse creates a cached response that expires after the ttl
+func newTestCachedResponse(ttl time.Duration, tags ...string) *CachedResponse {
+	return &CachedResponse{
+		Body:    []byte("body"),
+		Expires: time.Now().Add(ttl),
+		Status:  200,
+		Stored:  time.Now(),
+		Tags:    tags,
+	}
+}
+
+// TestMemoryCacheStore tests the in-memory LRU cache store
+func TestMemoryCacheStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("get and set", func(t *testing.T) {
+		store := NewMemoryCacheStore(10)
+		_, found := store.Get(ctx, "key")
+		require.False(t, found)
+
+		require.NoError(t, store.Set(ctx, "key", newTestCachedResponse(time.Minute)))
+		response, found := store.Get(ctx, "key")
+		require.True(t, found)
+		require.Equal(t, []byte("body"), response.Body)
+	})
+
+	t.Run("expired responses are removed", func(t *testing.T) {
+		store := NewMemoryCacheStore(10)
+		require.NoError(t, store.Set(ctx, "key", newTestCachedResponse(-time.Second, "tag")))
+		_, found := store.Get(ctx, "key")
+		require.False(t, found)
+		require.Equal(t, 0, store.Len())
+		require.Empty(t, store.tags)
+	})
+
+	t.Run("least recently used is evicted", func(t *testing.T) {
+		store := NewMemoryCacheStore(3)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, store.Set(ctx, strconv.Itoa(i), newTestCachedResponse(time.Minute)))
+		}
+
+		// Touch the oldest so "1" becomes the least recently used
+		_, found := store.Get(ctx, "0")
+		require.True(t, found)
+
+		require.NoError(t, store.Set(ctx, "3", newTestCachedResponse(time.Minute)))
+		require.Equal(t, 3, store.Len())
+		_, found = store.Get(ctx, "1")
+		require.False(t, found)
+		_, found = store.Get(ctx, "0")
+		require.True(t, found)
+	})
+
+	t.Run("replacing a key updates the tags", func(t *testing.T) {
+		store := NewMemoryCacheStore(10)
+		require.NoError(t, store.Set(ctx, "key", newTestCachedResponse(time.Minute, "old")))
+		require.NoError(t, store.Set(ctx, "key", newTestCachedResponse(time.Minute, "new")))
+		require.Equal(t, 1, store.Len())
+
+		require.NoError(t, store.Invalidate(ctx, "old"))
+		require.Equal(t, 1, store.Len())
+
+		require.NoError(t, store.Invalidate(ctx, "new"))
+		require.Equal(t, 0, store.Len())
+	})
+
+	t.Run("invalidate removes every response with the tag", func(t *testing.T) {
+		store := NewMemoryCacheStore(10)
+		require.NoError(t, store.Set(ctx, "a", newTestCachedResponse(time.Minute, "users", "user:1")))
+		require.NoError(t, store.Set(ctx, "b", newTestCachedResponse(time.Minute, "users", "user:2")))
+		require.NoError(t, store.Set(ctx, "c", newTestCachedResponse(time.Minute, "posts")))
+
+		require.NoError(t, store.Invalidate(ctx, "user:1"))
+		require.Equal(t, 2, store.Len())
+
+		require.NoError(t, store.Invalidate(ctx, "users", "missing"))
+		require.Equal(t, 1, store.Len())
+		_, found := store.Get(ctx, "c")
+		require.True(t, found)
+	})
+
+	t.Run("default capacity", func(t *testing.T) {
+		require.Equal(t, defaultCacheCapacity, NewMemoryCacheStore(0).capacity)
+	})
+}
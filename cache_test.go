@@ -0,0 +1,189 @@
+package apirouter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+// cacheTestRouter creates a router with the Cache middleware and counts handler calls
+func cacheTestRouter(options CacheOptions, calls *int32) *Router {
+	router := New()
+	s := NewStack()
+	s.Use(Cache(options))
+
+	router.HTTPRouter.GET("/users", router.Request(s.Wrap(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		atomic.AddInt32(calls, 1)
+		if writer, ok := w.(*APIResponseWriter); ok {
+			writer.CacheTTL = time.Minute
+			writer.AddCacheIdentifier("users")
+		}
+		w.Header().Set("X-Custom", "value")
+		RespondWith(w, req, http.StatusOK, map[string]string{"lang": req.Header.Get("Accept-Language")})
+	})))
+	router.HTTPRouter.GET("/uncached", router.Request(s.Wrap(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		atomic.AddInt32(calls, 1)
+		RespondWith(w, req, http.StatusOK, map[string]string{"cached": "no"})
+	})))
+	router.HTTPRouter.GET("/session", router.Request(s.Wrap(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		atomic.AddInt32(calls, 1)
+		w.(*APIResponseWriter).CacheTTL = time.Minute
+		http.SetCookie(w, &http.Cookie{Name: CookieName, Value: "token"})
+		RespondWith(w, req, http.StatusOK, nil)
+	})))
+	return router
+}
+
+// TestCache tests the Cache middleware
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	t.Run("second request is served from the cache", func(t *testing.T) {
+		var calls int32
+		router := cacheTestRouter(CacheOptions{}, &calls)
+
+		rr := serveRequest(router, http.MethodGet, "/users?b=2&a=1", nil)
+		require.Equal(t, cacheMiss, rr.Header().Get(xCacheHeader))
+		require.Equal(t, "value", rr.Header().Get("X-Custom"))
+
+		// Same query in a different order is the same key
+		rr = serveRequest(router, http.MethodGet, "/users?a=1&b=2", map[string]string{origin: "https://other.com"})
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, cacheHit, rr.Header().Get(xCacheHeader))
+		require.Equal(t, "value", rr.Header().Get("X-Custom"))
+		require.Equal(t, "0", rr.Header().Get(ageHeader))
+		require.Equal(t, "https://other.com", rr.Header().Get(allowOriginHeader))
+		require.JSONEq(t, `{"lang":""}`, rr.Body.String())
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("vary headers are part of the key", func(t *testing.T) {
+		var calls int32
+		router := cacheTestRouter(CacheOptions{VaryHeaders: []string{"Accept-Language"}}, &calls)
+
+		serveRequest(router, http.MethodGet, "/users", map[string]string{"Accept-Language": "en"})
+		rr := serveRequest(router, http.MethodGet, "/users", map[string]string{"Accept-Language": "fr"})
+		require.Equal(t, cacheMiss, rr.Header().Get(xCacheHeader))
+		require.JSONEq(t, `{"lang":"fr"}`, rr.Body.String())
+
+		rr = serveRequest(router, http.MethodGet, "/users", map[string]string{"Accept-Language": "en"})
+		require.Equal(t, cacheHit, rr.Header().Get(xCacheHeader))
+		require.JSONEq(t, `{"lang":"en"}`, rr.Body.String())
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("key identifiers are part of the key", func(t *testing.T) {
+		var calls int32
+		router := cacheTestRouter(CacheOptions{KeyIdentifiers: func(req *http.Request) []string {
+			return []string{req.Header.Get("X-User")}
+		}}, &calls)
+
+		serveRequest(router, http.MethodGet, "/users", map[string]string{"X-User": "1"})
+		rr := serveRequest(router, http.MethodGet, "/users", map[string]string{"X-User": "2"})
+		require.Equal(t, cacheMiss, rr.Header().Get(xCacheHeader))
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("responses without a ttl are not stored", func(t *testing.T) {
+		var calls int32
+		router := cacheTestRouter(CacheOptions{}, &calls)
+
+		serveRequest(router, http.MethodGet, "/uncached", nil)
+		rr := serveRequest(router, http.MethodGet, "/uncached", nil)
+		require.Equal(t, cacheMiss, rr.Header().Get(xCacheHeader))
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("responses setting cookies are not stored", func(t *testing.T) {
+		var calls int32
+		router := cacheTestRouter(CacheOptions{}, &calls)
+
+		serveRequest(router, http.MethodGet, "/session", nil)
+		serveRequest(router, http.MethodGet, "/session", nil)
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("requests with credentials skip the cache", func(t *testing.T) {
+		var calls int32
+		store := NewMemoryCacheStore(10)
+		router := cacheTestRouter(CacheOptions{Store: store}, &calls)
+
+		serveRequest(router, http.MethodGet, "/users", nil)
+		for _, headers := range []map[string]string{
+			{AuthorizationHeader: AuthorizationBearer + " token"},
+			{cookieHeader: CookieName + "=token"},
+		} {
+			rr := serveRequest(router, http.MethodGet, "/users", headers)
+			require.Equal(t, cacheMiss, rr.Header().Get(xCacheHeader))
+		}
+		require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+		require.Equal(t, 1, store.Len())
+	})
+
+	t.Run("authenticated responses are not stored", func(t *testing.T) {
+		var calls int32
+		store := NewMemoryCacheStore(10)
+		handler := Cache(CacheOptions{Store: store})(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+			atomic.AddInt32(&calls, 1)
+			w.(*APIResponseWriter).CacheTTL = time.Minute
+			w.Header().Set(AuthorizationHeader, AuthorizationBearer+" refreshed")
+			RespondWith(w, req, http.StatusOK, map[string]string{"private": "yes"})
+		})
+
+		for i := 0; i < 2; i++ {
+			rr := httptest.NewRecorder()
+			handler(&APIResponseWriter{ResponseWriter: rr}, httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/me", nil), nil)
+			require.Equal(t, cacheMiss, rr.Header().Get(xCacheHeader))
+		}
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+		require.Equal(t, 0, store.Len())
+	})
+
+	t.Run("key identifiers allow authenticated requests", func(t *testing.T) {
+		var calls int32
+		router := cacheTestRouter(CacheOptions{KeyIdentifiers: func(req *http.Request) []string {
+			return []string{req.Header.Get(AuthorizationHeader)}
+		}}, &calls)
+
+		headers := map[string]string{AuthorizationHeader: AuthorizationBearer + " token"}
+		serveRequest(router, http.MethodGet, "/users", headers)
+		rr := serveRequest(router, http.MethodGet, "/users", headers)
+		require.Equal(t, cacheHit, rr.Header().Get(xCacheHeader))
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("invalidating a cache identifier removes the response", func(t *testing.T) {
+		var calls int32
+		store := NewMemoryCacheStore(10)
+		router := cacheTestRouter(CacheOptions{Store: store}, &calls)
+
+		serveRequest(router, http.MethodGet, "/users", nil)
+		require.Equal(t, 1, store.Len())
+		require.NoError(t, store.Invalidate(context.Background(), "users"))
+		require.Equal(t, 0, store.Len())
+
+		rr := serveRequest(router, http.MethodGet, "/users", nil)
+		require.Equal(t, cacheMiss, rr.Header().Get(xCacheHeader))
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("unsafe methods skip the cache", func(t *testing.T) {
+		var called bool
+		handler := Cache(CacheOptions{})(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+			called = true
+			RespondWith(w, req, http.StatusCreated, nil)
+		})
+
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/users", nil), nil)
+		require.True(t, called)
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Empty(t, rr.Header().Get(xCacheHeader))
+	})
+}
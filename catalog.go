@@ -0,0 +1,218 @@
+package apirouter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Log levels for error definitions
+const (
+	LogLevelError string = logLevelError
+	LogLevelInfo  string = "info"
+	LogLevelNone  string = "none" // Never logged
+	LogLevelWarn  string = "warn"
+)
+
+// ErrorDefinition is a registered error code with its defaults
+type ErrorDefinition struct {
+	Code          int    `json:"code" url:"code"`                         // Unique error code (APIError.Code)
+	Description   string `json:"description,omitempty" url:"description"` // Documentation for the code
+	LogLevel      string `json:"log_level,omitempty" url:"log_level"`     // Log level (default is based on the status code)
+	Name          string `json:"name" url:"name"`                         // Short identifier (IE: body_too_large)
+	PublicMessage string `json:"message" url:"message"`                   // Default public message
+	Retryable     bool   `json:"retryable" url:"retryable"`               // If the client can retry the request
+	StatusCode    int    `json:"status_code" url:"status_code"`           // Default HTTP status code
+}
+
+// ErrorCatalog is a registry of error codes
+type ErrorCatalog struct {
+	DefaultLanguage string // Language of the definitions' public messages (IE: en)
+	definitions     map[int]ErrorDefinition
+	messages        map[int]map[string]string // Localized public messages by code and locale
+	mu              sync.RWMutex
+}
+
+// DefaultErrorCatalog is used by ErrorFromRequest(), ErrorFromResponse() and NewAPIError() to fill in the defaults for a code
+var DefaultErrorCatalog = NewErrorCatalog()
+
+// init registers the error codes used by this package
+func init() {
+	DefaultErrorCatalog.MustRegister(
+		ErrorDefinition{
+			Code: ErrCodeUnknown, Name: "unknown", StatusCode: http.StatusInternalServerError,
+			PublicMessage: "an unknown error occurred", Description: "An unexpected error occurred",
+		},
+		ErrorDefinition{
+			Code: ErrCodeBodyTooLarge, Name: "body_too_large", StatusCode: http.StatusRequestEntityTooLarge,
+			PublicMessage: "request body is too large", Description: "The request body exceeded the maximum allowed size",
+		},
+		ErrorDefinition{
+			Code: ErrCodePreconditionFailed, Name: "precondition_failed", StatusCode: http.StatusPreconditionFailed,
+			PublicMessage: "the resource has been modified", Description: "If-Match or If-Unmodified-Since did not match the current resource",
+		},
+		ErrorDefinition{
+			Code: ErrCodeWebSocketUpgrade, Name: "websocket_upgrade", StatusCode: http.StatusBadRequest,
+			PublicMessage: "unable to upgrade the connection", Description: "The WebSocket handshake was rejected",
+		},
+		ErrorDefinition{
+			Code: ErrCodeNotAcceptable, Name: "not_acceptable", StatusCode: http.StatusNotAcceptable,
+			PublicMessage: "unable to respond in any of the accepted formats", Description: "No response format matches the Accept header",
+		},
+		ErrorDefinition{
+			Code: ErrCodeValidation, Name: "validation_failed", StatusCode: http.StatusUnprocessableEntity,
+			PublicMessage: validationMessage, Description: "One or more fields are invalid (the fields are listed in the response)",
+		},
+		ErrorDefinition{
+			Code: ErrCodeInvalidBody, Name: "invalid_body", StatusCode: http.StatusBadRequest,
+			PublicMessage: "the request body is invalid", Description: "The request body could not be decoded (IE: malformed JSON)",
+		},
+		ErrorDefinition{
+			Code: ErrCodeInvalidFields, Name: "invalid_fields", StatusCode: http.StatusBadRequest,
+			PublicMessage: "invalid fields requested: {fields}", Description: "The fields query parameter is malformed or requests a field that is not available",
+		},
+	)
+}
+
+// NewErrorCatalog creates an empty catalog
+func NewErrorCatalog() *ErrorCatalog {
+	return &ErrorCatalog{
+		DefaultLanguage: defaultLanguage,
+		definitions:     make(map[int]ErrorDefinition),
+		messages:        make(map[int]map[string]string),
+	}
+}
+
+// RegisterErrorCode adds the definitions to the DefaultErrorCatalog
+func RegisterErrorCode(definitions ...ErrorDefinition) error {
+	return DefaultErrorCatalog.Register(definitions...)
+}
+
+// Register adds the definitions, returning ErrDuplicateErrorCode (and adding none of them) if a code is already registered
+func (c *ErrorCatalog) Register(definitions ...ErrorDefinition) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen := make(map[int]bool, len(definitions))
+	for _, definition := range definitions {
+		if _, exists := c.definitions[definition.Code]; exists || seen[definition.Code] {
+			return fmt.Errorf("%w: %d", ErrDuplicateErrorCode, definition.Code)
+		}
+		seen[definition.Code] = true
+	}
+
+	for _, definition := range definitions {
+		c.definitions[definition.Code] = definition
+	}
+	return nil
+}
+
+// MustRegister adds the definitions and panics on a duplicate code (IE: detected at startup)
+func (c *ErrorCatalog) MustRegister(definitions ...ErrorDefinition) {
+	if err := c.Register(definitions...); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup returns the definition for the code
+func (c *ErrorCatalog) Lookup(code int) (ErrorDefinition, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	definition, ok := c.definitions[code]
+	return definition, ok
+}
+
+// Definitions returns all the definitions sorted by code
+func (c *ErrorCatalog) Definitions() []ErrorDefinition {
+	c.mu.RLock()
+	definitions := make([]ErrorDefinition, 0, len(c.definitions))
+	for _, definition := range c.definitions {
+		definitions = append(definitions, definition)
+	}
+	c.mu.RUnlock()
+
+	slices.SortFunc(definitions, func(a, b ErrorDefinition) int {
+		return a.Code - b.Code
+	})
+	return definitions
+}
+
+// ExportJSON writes the definitions as a JSON array (sorted by code)
+func (c *ErrorCatalog) ExportJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c.Definitions())
+}
+
+// ExportMarkdown writes the definitions as a Markdown table (sorted by code)
+func (c *ErrorCatalog) ExportMarkdown(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("| Code | Name | Status | Message | Retryable | Description |\n")
+	b.WriteString("|------|------|--------|---------|-----------|-------------|\n")
+	for _, definition := range c.Definitions() {
+		retryable := "no"
+		if definition.Retryable {
+			retryable = "yes"
+		}
+		cells := []string{
+			strconv.Itoa(definition.Code),
+			"`" + definition.Name + "`",
+			strconv.Itoa(definition.StatusCode) + " " + http.StatusText(definition.StatusCode),
+			definition.PublicMessage,
+			retryable,
+			definition.Description,
+		}
+		b.WriteString("|")
+		for _, cell := range cells {
+			b.WriteString(" ")
+			b.WriteString(markdownCell(cell))
+			b.WriteString(" |")
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Retryable checks if the error code is registered as retryable
+func (e *APIError) Retryable() bool {
+	definition, ok := DefaultErrorCatalog.Lookup(e.Code)
+	return ok && definition.Retryable
+}
+
+// errorDefaults fills in the status code and public message from the catalog when they are not set.
+// The message is localized using the Accept-Language of the request (if any) and returned with its locale.
+func errorDefaults(acceptLanguage string, code, statusCode int, publicMessage string, data interface{}) (int, string, string) {
+	definition, ok := DefaultErrorCatalog.Lookup(code)
+	if !ok {
+		return statusCode, publicMessage, ""
+	}
+	if statusCode == 0 {
+		statusCode = definition.StatusCode
+	}
+	if len(publicMessage) > 0 {
+		return statusCode, publicMessage, ""
+	}
+
+	publicMessage, locale, _ := DefaultErrorCatalog.Message(code, acceptLanguage, data)
+	return statusCode, publicMessage, locale
+}
+
+// requestLanguage returns the Accept-Language of the request (empty without a request)
+func requestLanguage(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	return req.Header.Get(acceptLanguageHeader)
+}
+
+// markdownCell escapes the text for a Markdown table cell
+func markdownCell(text string) string {
+	text = strings.ReplaceAll(text, "|", "\\|")
+	return strings.ReplaceAll(text, "\n", " ")
+}
@@ -0,0 +1,138 @@
+package apirouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestErrorCatalog_Register tests registering and looking up codes
+func TestErrorCatalog_Register(t *testing.T) {
+	t.Parallel()
+
+	catalog := NewErrorCatalog()
+	require.NoError(t, catalog.Register(
+		ErrorDefinition{Code: 1001, Name: "rate_limited", StatusCode: http.StatusTooManyRequests, PublicMessage: "slow down", Retryable: true},
+		ErrorDefinition{Code: 1000, Name: "user_not_found", StatusCode: http.StatusNotFound, PublicMessage: "user not found"},
+	))
+
+	definition, ok := catalog.Lookup(1001)
+	require.True(t, ok)
+	require.Equal(t, "rate_limited", definition.Name)
+	require.True(t, definition.Retryable)
+
+	_, ok = catalog.Lookup(999)
+	require.False(t, ok)
+
+	definitions := catalog.Definitions()
+	require.Len(t, definitions, 2)
+	require.Equal(t, 1000, definitions[0].Code)
+
+	t.Run("duplicate code", func(t *testing.T) {
+		err := catalog.Register(ErrorDefinition{Code: 1002}, ErrorDefinition{Code: 1000})
+		require.ErrorIs(t, err, ErrDuplicateErrorCode)
+		require.Contains(t, err.Error(), "1000")
+
+		// Nothing from the failed call is registered
+		_, ok = catalog.Lookup(1002)
+		require.False(t, ok)
+	})
+
+	t.Run("duplicate within one call", func(t *testing.T) {
+		require.ErrorIs(t, catalog.Register(ErrorDefinition{Code: 1003}, ErrorDefinition{Code: 1003}), ErrDuplicateErrorCode)
+	})
+
+	t.Run("must register panics on a duplicate", func(t *testing.T) {
+		require.Panics(t, func() {
+			catalog.MustRegister(ErrorDefinition{Code: 1001})
+		})
+	})
+
+	t.Run("package codes are registered", func(t *testing.T) {
+		require.ErrorIs(t, RegisterErrorCode(ErrorDefinition{Code: ErrCodeBodyTooLarge}), ErrDuplicateErrorCode)
+	})
+}
+
+// TestErrorFromRequest_Catalog tests creating errors from just a code
+func TestErrorFromRequest_Catalog(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, RegisterErrorCode(ErrorDefinition{
+		Code: 2001, Name: "quota_exceeded", StatusCode: http.StatusTooManyRequests,
+		PublicMessage: "quota exceeded", Retryable: true, LogLevel: LogLevelNone,
+	}))
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil)
+
+	t.Run("defaults from the code", func(t *testing.T) {
+		err := ErrorFromRequest(req, "", "", 2001, 0, nil)
+		require.Equal(t, http.StatusTooManyRequests, err.StatusCode)
+		require.Equal(t, "quota exceeded", err.Error())
+		require.True(t, err.Retryable())
+	})
+
+	t.Run("explicit values win", func(t *testing.T) {
+		err := ErrorFromRequest(req, "", "try tomorrow", 2001, http.StatusForbidden, nil)
+		require.Equal(t, http.StatusForbidden, err.StatusCode)
+		require.Equal(t, "try tomorrow", err.Error())
+	})
+
+	t.Run("from a response writer", func(t *testing.T) {
+		err := ErrorFromResponse(setupTest(), "", "", 2001, 0, nil)
+		require.Equal(t, http.StatusTooManyRequests, err.StatusCode)
+	})
+
+	t.Run("new api error with a code", func(t *testing.T) {
+		err := NewAPIError(req, nil, WithCode(2001))
+		require.Equal(t, http.StatusTooManyRequests, err.StatusCode)
+		require.Equal(t, "quota exceeded", err.Error())
+	})
+
+	t.Run("unregistered code", func(t *testing.T) {
+		err := ErrorFromRequest(req, "", "", 2999, 0, nil)
+		require.Zero(t, err.StatusCode)
+		require.False(t, err.Retryable())
+	})
+
+	t.Run("log level", func(t *testing.T) {
+		_, logged := errorLogLevel(2001, http.StatusTooManyRequests, nil)
+		require.False(t, logged)
+
+		level, logged := errorLogLevel(2999, http.StatusBadRequest, nil)
+		require.True(t, logged)
+		require.Equal(t, LogLevelWarn, level)
+	})
+}
+
+// TestErrorCatalog_Export tests the documentation exports
+func TestErrorCatalog_Export(t *testing.T) {
+	t.Parallel()
+
+	catalog := NewErrorCatalog()
+	catalog.MustRegister(
+		ErrorDefinition{Code: 2, Name: "b", StatusCode: http.StatusConflict, PublicMessage: "a | b", Retryable: true, Description: "line one\nline two"},
+		ErrorDefinition{Code: 1, Name: "a", StatusCode: http.StatusBadRequest, PublicMessage: "bad"},
+	)
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, catalog.ExportJSON(&buf))
+
+		var definitions []ErrorDefinition
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &definitions))
+		require.Equal(t, catalog.Definitions(), definitions)
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, catalog.ExportMarkdown(&buf))
+		require.Equal(t, "| Code | Name | Status | Message | Retryable | Description |\n"+
+			"|------|------|--------|---------|-----------|-------------|\n"+
+			"| 1 | `a` | 400 Bad Request | bad | no |  |\n"+
+			"| 2 | `b` | 409 Conflict | a \\| b | yes | line one line two |\n", buf.String())
+	})
+}
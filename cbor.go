@@ -0,0 +1,208 @@
+package apirouter
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// CBOR major types (RFC 8949 section 3.1)
+const (
+	cborUnsignedInt byte = 0
+	cborNegativeInt byte = 1
+	cborByteString  byte = 2
+	cborTextString  byte = 3
+	cborArray       byte = 4
+	cborMap         byte = 5
+	cborTag         byte = 6
+)
+
+// CBOR simple values and float headers
+const (
+	cborFalse   byte = 0xf4
+	cborTrue    byte = 0xf5
+	cborNull    byte = 0xf6
+	cborFloat32 byte = 0xfa
+	cborFloat64 byte = 0xfb
+)
+
+// Type checks for values with a custom encoding
+var (
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	timeType          = reflect.TypeFor[time.Time]()
+)
+
+// MarshalCBOR encodes the value as CBOR (RFC 8949), using the same field names as encoding/json.
+// Map keys are sorted (deterministic encoding) and time.Time values use the standard date/time tag.
+func MarshalCBOR(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeCBOR(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeCBOR writes a single data item
+func encodeCBOR(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buf.WriteByte(cborNull)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			buf.WriteByte(cborNull)
+			return nil
+		}
+	default:
+	}
+
+	// Types with a custom encoding
+	if v.Type() == timeType {
+		writeCBORHead(buf, cborTag, 0) // Standard date/time string
+		text := v.Interface().(time.Time).Format(time.RFC3339Nano)
+		writeCBORHead(buf, cborTextString, uint64(len(text)))
+		buf.WriteString(text)
+		return nil
+	}
+	if v.Type().Implements(textMarshalerType) && v.Kind() != reflect.Pointer && v.Kind() != reflect.Interface {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		writeCBORHead(buf, cborTextString, uint64(len(text)))
+		buf.Write(text)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(cborTrue)
+		} else {
+			buf.WriteByte(cborFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i := v.Int(); i >= 0 {
+			writeCBORHead(buf, cborUnsignedInt, uint64(i))
+		} else {
+			writeCBORHead(buf, cborNegativeInt, uint64(-1-i))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeCBORHead(buf, cborUnsignedInt, v.Uint())
+	case reflect.Float32:
+		buf.WriteByte(cborFloat32)
+		_ = binary.Write(buf, binary.BigEndian, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		buf.WriteByte(cborFloat64)
+		_ = binary.Write(buf, binary.BigEndian, math.Float64bits(v.Float()))
+	case reflect.String:
+		writeCBORHead(buf, cborTextString, uint64(v.Len()))
+		buf.WriteString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			writeCBORHead(buf, cborByteString, uint64(v.Len()))
+			buf.Write(v.Bytes())
+			return nil
+		}
+		writeCBORHead(buf, cborArray, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeCBOR(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		return encodeCBORMap(buf, v)
+	case reflect.Struct:
+		return encodeCBORStruct(buf, v)
+	case reflect.Pointer, reflect.Interface:
+		return encodeCBOR(buf, v.Elem())
+	default:
+		return ErrUnsupportedResponseData
+	}
+	return nil
+}
+
+// encodeCBORMap writes a map with the keys sorted by their encoded bytes
+func encodeCBORMap(buf *bytes.Buffer, v reflect.Value) error {
+	type entry struct {
+		key   []byte
+		value reflect.Value
+	}
+
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		var key bytes.Buffer
+		if err := encodeCBOR(&key, iter.Key()); err != nil {
+			return err
+		}
+		entries = append(entries, entry{key: key.Bytes(), value: iter.Value()})
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		return bytes.Compare(a.key, b.key)
+	})
+
+	writeCBORHead(buf, cborMap, uint64(len(entries)))
+	for _, e := range entries {
+		buf.Write(e.key)
+		if err := encodeCBOR(buf, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeCBORStruct writes a struct as a map of its fields (in field order, like encoding/json)
+func encodeCBORStruct(buf *bytes.Buffer, v reflect.Value) error {
+	fields := jsonFields(v.Type())
+	values := make([]reflect.Value, 0, len(fields))
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		value, err := v.FieldByIndexErr(field.index)
+		if err != nil {
+			continue // Nil embedded pointer
+		}
+		if field.omitEmpty && isEmptyValue(value) {
+			continue
+		}
+		values = append(values, value)
+		names = append(names, field.name)
+	}
+
+	writeCBORHead(buf, cborMap, uint64(len(values)))
+	for i, value := range values {
+		writeCBORHead(buf, cborTextString, uint64(len(names[i])))
+		buf.WriteString(names[i])
+		if err := encodeCBOR(buf, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCBORHead writes the major type and argument using the shortest form
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		_ = binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		_ = binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major | 27)
+		_ = binary.Write(buf, binary.BigEndian, n)
+	}
+}
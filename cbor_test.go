@@ -0,0 +1,89 @@
+package apirouter
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestMarshalCBOR tests the encoding against the examples in RFC 8949 appendix A
+func TestMarshalCBOR(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{"zero", 0, "00"},
+		{"small int", 23, "17"},
+		{"one byte int", 24, "1818"},
+		{"two byte int", 1000, "1903e8"},
+		{"four byte int", 1000000, "1a000f4240"},
+		{"eight byte int", uint64(1000000000000), "1b000000e8d4a51000"},
+		{"max uint64", uint64(math.MaxUint64), "1bffffffffffffffff"},
+		{"negative", -10, "29"},
+		{"negative two bytes", -1000, "3903e7"},
+		{"float64", 1.1, "fb3ff199999999999a"},
+		{"float32", float32(100000), "fa47c35000"},
+		{"false", false, "f4"},
+		{"true", true, "f5"},
+		{"nil", nil, "f6"},
+		{"nil pointer", (*int)(nil), "f6"},
+		{"empty string", "", "60"},
+		{"string", "IETF", "6449455446"},
+		{"utf-8 string", "ü", "62c3bc"},
+		{"bytes", []byte{1, 2, 3, 4}, "4401020304"},
+		{"empty array", []int{}, "80"},
+		{"array", []int{1, 2, 3}, "83010203"},
+		{"nested array", []interface{}{1, []int{2, 3}, []int{4, 5}}, "8301820203820405"},
+		{"empty map", map[string]int{}, "a0"},
+		{"map", map[string]interface{}{"a": 1, "b": []int{2, 3}}, "a26161016162820203"},
+		{"int keys sorted", map[int]int{3: 4, 1: 2}, "a201020304"},
+		{"time", time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC), "c074323031332d30332d32315432303a30343a30305a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := MarshalCBOR(test.value)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, hex.EncodeToString(encoded))
+		})
+	}
+}
+
+// TestMarshalCBOR_Struct tests structs use the encoding/json field names and options
+func TestMarshalCBOR_Struct(t *testing.T) {
+	t.Parallel()
+
+	type Base struct {
+		ID int `json:"id"`
+	}
+	type Named struct {
+		Hidden int
+	}
+	type model struct {
+		Base
+		Named    `json:"named"`
+		Name     string `json:"name"`
+		Nickname string `json:"nickname,omitempty"`
+		Secret   string `json:"-"`
+		private  string
+	}
+
+	encoded, err := MarshalCBOR(model{Base: Base{ID: 1}, Named: Named{Hidden: 2}, Name: "a", Secret: "s", private: "p"})
+	require.NoError(t, err)
+
+	// {"id": 1, "named": {"Hidden": 2}, "name": "a"}
+	require.Equal(t, "a3"+"626964"+"01"+"656e616d6564"+"a1"+"6648696464656e"+"02"+"646e616d65"+"6161", hex.EncodeToString(encoded))
+}
+
+// TestMarshalCBOR_Unsupported tests values that cannot be encoded
+func TestMarshalCBOR_Unsupported(t *testing.T) {
+	t.Parallel()
+
+	_, err := MarshalCBOR(map[string]interface{}{"ch": make(chan int)})
+	require.ErrorIs(t, err, ErrUnsupportedResponseData)
+}
@@ -0,0 +1,197 @@
+package apirouter
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Compression encodings and headers
+const (
+	acceptEncodingHeader  string = "Accept-Encoding"
+	contentEncodingHeader string = "Content-Encoding"
+	contentLengthHeader   string = "Content-Length"
+	encodingDeflate       string = "deflate"
+	encodingGzip          string = "gzip"
+
+	// defaultCompressionMinSize is the smallest response (in bytes) worth compressing
+	defaultCompressionMinSize = 1024
+)
+
+// defaultCompressionContentTypes are the content types that are compressed by default
+var defaultCompressionContentTypes = []string{
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"image/svg+xml",
+	"text/css",
+	"text/csv",
+	"text/html",
+	"text/javascript",
+	"text/plain",
+	"text/xml",
+}
+
+// Writer pools per encoding, indexed by compression level (gzip.HuffmanOnly to gzip.BestCompression)
+var (
+	deflateWriterPools [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+	gzipWriterPools    [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+)
+
+// compressWriter is the shared behavior of gzip.Writer and flate.Writer
+type compressWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// responseCompressor buffers the start of a response until it knows if compression is worthwhile
+type responseCompressor struct {
+	contentTypes []string
+	decided      bool
+	encoding     string
+	level        int
+	minSize      int
+	pending      []byte
+	status       int
+	writer       compressWriter
+}
+
+// negotiateCompression attaches a compressor to the writer if enabled and accepted by the client
+func (r *Router) negotiateCompression(w *APIResponseWriter, req *http.Request) {
+	if !r.CompressionEnabled {
+		return
+	}
+
+	// The response varies by the Accept-Encoding even if we do not compress this one
+	addVary(w.Header(), acceptEncodingHeader)
+
+	// HEAD requests have no body to compress
+	if req.Method == http.MethodHead {
+		return
+	}
+
+	encoding := negotiateEncoding(req.Header.Get(acceptEncodingHeader))
+	if len(encoding) == 0 {
+		return
+	}
+
+	// Fall back to the default level if the configured level is invalid
+	level := r.CompressionLevel
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+
+	w.compressor = &responseCompressor{
+		contentTypes: r.CompressionContentTypes,
+		encoding:     encoding,
+		level:        level,
+		minSize:      r.CompressionMinSize,
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from the Accept-Encoding header (honoring q-values)
+func negotiateEncoding(acceptEncoding string) string {
+	if len(acceptEncoding) == 0 {
+		return ""
+	}
+
+	var gzipQ, deflateQ, wildcardQ float64 = -1, -1, -1
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, q := parseQualityValue(part)
+		switch strings.ToLower(name) {
+		case encodingGzip:
+			gzipQ = q
+		case encodingDeflate:
+			deflateQ = q
+		case "*":
+			wildcardQ = q
+		}
+	}
+
+	// Encodings not listed inherit the wildcard
+	if gzipQ < 0 {
+		gzipQ = wildcardQ
+	}
+	if deflateQ < 0 {
+		deflateQ = wildcardQ
+	}
+
+	// Prefer gzip on ties
+	if gzipQ > 0 && gzipQ >= deflateQ {
+		return encodingGzip
+	} else if deflateQ > 0 {
+		return encodingDeflate
+	}
+	return ""
+}
+
+// parseQualityValue splits a header element into its value and q-value (default 1)
+func parseQualityValue(part string) (string, float64) {
+	value, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+	q := 1.0
+	for _, param := range strings.Split(params, ";") {
+		key, val, found := strings.Cut(strings.TrimSpace(param), "=")
+		if found && strings.EqualFold(strings.TrimSpace(key), "q") {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+			if err != nil || parsed < 0 {
+				parsed = 0
+			}
+			q = parsed
+		}
+	}
+	return strings.TrimSpace(value), q
+}
+
+// matchContentType returns true if the content type is in the list (supports "type/*" entries)
+func matchContentType(contentType string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, entry := range allowed {
+		entry = strings.ToLower(entry)
+		if entry == mediaType {
+			return true
+		} else if prefix, ok := strings.CutSuffix(entry, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// getCompressWriter returns a pooled compression writer for the encoding and level
+func getCompressWriter(encoding string, level int, w io.Writer) compressWriter {
+	pool := compressWriterPool(encoding, level)
+	if cw, ok := pool.Get().(compressWriter); ok {
+		cw.Reset(w)
+		return cw
+	}
+
+	// Levels are validated in negotiateCompression, so these cannot fail
+	if encoding == encodingGzip {
+		gz, _ := gzip.NewWriterLevel(w, level)
+		return gz
+	}
+	fl, _ := flate.NewWriter(w, level)
+	return fl
+}
+
+// putCompressWriter returns the compression writer to its pool
+func putCompressWriter(encoding string, level int, cw compressWriter) {
+	cw.Reset(io.Discard)
+	compressWriterPool(encoding, level).Put(cw)
+}
+
+// compressWriterPool returns the pool for the encoding and level
+func compressWriterPool(encoding string, level int) *sync.Pool {
+	if encoding == encodingGzip {
+		return &gzipWriterPools[level-gzip.HuffmanOnly]
+	}
+	return &deflateWriterPools[level-gzip.HuffmanOnly]
+}
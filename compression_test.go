@@ -0,0 +1,183 @@
+package apirouter
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+// compressionTestRouter creates a router with compression enabled and a few test routes
+func compressionTestRouter() *Router {
+	router := New()
+	router.CompressionEnabled = true
+
+	largeBody := map[string]string{"message": strings.Repeat("compress me ", 200)}
+	router.HTTPRouter.GET("/large", router.Request(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		RespondWith(w, req, http.StatusOK, largeBody)
+	}))
+	router.HTTPRouter.GET("/small", router.Request(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		RespondWith(w, req, http.StatusOK, map[string]string{"message": "tiny"})
+	}))
+	router.HTTPRouter.GET("/stream", router.Request(func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		for i := 0; i < 100; i++ {
+			_, _ = w.Write([]byte("line of plain text\n"))
+		}
+	}))
+	router.HTTPRouter.GET("/png", router.Request(func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.Header().Set(contentTypeHeader, "image/png")
+		_, _ = w.Write(make([]byte, 4096))
+	}))
+	router.HTTPRouter.GET("/encoded", router.Request(func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.Header().Set(contentTypeHeader, "text/plain")
+		w.Header().Set(contentEncodingHeader, "br")
+		_, _ = w.Write(make([]byte, 4096))
+	}))
+	router.HTTPRouter.GET("/empty", router.Request(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		RespondWith(w, req, http.StatusNoContent, nil)
+	}))
+	return router
+}
+
+// TestRouter_Compression tests the response compression in APIResponseWriter
+func TestRouter_Compression(t *testing.T) {
+	t.Parallel()
+
+	router := compressionTestRouter()
+
+	t.Run("large JSON response is gzipped", func(t *testing.T) {
+		rr := serveRequest(router, http.MethodGet, "/large", map[string]string{acceptEncodingHeader: "gzip, deflate"})
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, encodingGzip, rr.Header().Get(contentEncodingHeader))
+		require.Empty(t, rr.Header().Get(contentLengthHeader))
+		require.Contains(t, rr.Header().Values(varyHeaderString), acceptEncodingHeader)
+
+		gz, err := gzip.NewReader(rr.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		require.Contains(t, string(body), "compress me compress me")
+	})
+
+	t.Run("deflate is used when preferred", func(t *testing.T) {
+		rr := serveRequest(router, http.MethodGet, "/large", map[string]string{acceptEncodingHeader: "gzip;q=0.5, deflate"})
+		require.Equal(t, encodingDeflate, rr.Header().Get(contentEncodingHeader))
+
+		body, err := io.ReadAll(flate.NewReader(rr.Body))
+		require.NoError(t, err)
+		require.Contains(t, string(body), "compress me")
+	})
+
+	t.Run("small response is not compressed", func(t *testing.T) {
+		rr := serveRequest(router, http.MethodGet, "/small", map[string]string{acceptEncodingHeader: encodingGzip})
+		require.Empty(t, rr.Header().Get(contentEncodingHeader))
+		require.JSONEq(t, `{"message":"tiny"}`, rr.Body.String())
+		require.Contains(t, rr.Header().Values(varyHeaderString), acceptEncodingHeader)
+	})
+
+	t.Run("client without Accept-Encoding gets identity", func(t *testing.T) {
+		rr := serveRequest(router, http.MethodGet, "/large", nil)
+		require.Empty(t, rr.Header().Get(contentEncodingHeader))
+		require.NotEmpty(t, rr.Header().Get(contentLengthHeader))
+	})
+
+	t.Run("streamed response without content length is compressed and sniffed", func(t *testing.T) {
+		rr := serveRequest(router, http.MethodGet, "/stream", map[string]string{acceptEncodingHeader: encodingGzip})
+		require.Equal(t, encodingGzip, rr.Header().Get(contentEncodingHeader))
+		require.Contains(t, rr.Header().Get(contentTypeHeader), "text/plain")
+
+		gz, err := gzip.NewReader(rr.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		require.Len(t, body, 100*len("line of plain text\n"))
+	})
+
+	t.Run("content type not in the allowlist is not compressed", func(t *testing.T) {
+		rr := serveRequest(router, http.MethodGet, "/png", map[string]string{acceptEncodingHeader: encodingGzip})
+		require.Empty(t, rr.Header().Get(contentEncodingHeader))
+		require.Len(t, rr.Body.Bytes(), 4096)
+	})
+
+	t.Run("already encoded response is skipped", func(t *testing.T) {
+		rr := serveRequest(router, http.MethodGet, "/encoded", map[string]string{acceptEncodingHeader: encodingGzip})
+		require.Equal(t, "br", rr.Header().Get(contentEncodingHeader))
+		require.Len(t, rr.Body.Bytes(), 4096)
+	})
+
+	t.Run("no content response is skipped", func(t *testing.T) {
+		rr := serveRequest(router, http.MethodGet, "/empty", map[string]string{acceptEncodingHeader: encodingGzip})
+		require.Equal(t, http.StatusNoContent, rr.Code)
+		require.Empty(t, rr.Header().Get(contentEncodingHeader))
+		require.Empty(t, rr.Body.Bytes())
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		plain := New()
+		plain.HTTPRouter.GET("/large", plain.Request(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+			RespondWith(w, req, http.StatusOK, map[string]string{"message": strings.Repeat("a", 4096)})
+		}))
+		rr := serveRequest(plain, http.MethodGet, "/large", map[string]string{acceptEncodingHeader: encodingGzip})
+		require.Empty(t, rr.Header().Get(contentEncodingHeader))
+		require.NotContains(t, rr.Header().Values(varyHeaderString), acceptEncodingHeader)
+	})
+}
+
+// TestNegotiateEncoding tests the Accept-Encoding negotiation
+func TestNegotiateEncoding(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", ""},
+		{"gzip", encodingGzip},
+		{"deflate", encodingDeflate},
+		{"gzip, deflate, br", encodingGzip},
+		{"deflate, gzip", encodingGzip},
+		{"gzip;q=0.2, deflate;q=0.8", encodingDeflate},
+		{"gzip;q=0", ""},
+		{"*", encodingGzip},
+		{"*;q=0.5, gzip;q=0", encodingDeflate},
+		{"br, identity", ""},
+		{"GZIP", encodingGzip},
+		{"gzip;q=bad", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			require.Equal(t, tt.expected, negotiateEncoding(tt.acceptEncoding))
+		})
+	}
+}
+
+// TestMatchContentType tests the content type allowlist matching
+func TestMatchContentType(t *testing.T) {
+	t.Parallel()
+
+	allowed := []string{"application/json", "text/*"}
+	require.True(t, matchContentType("application/json; charset=utf-8", allowed))
+	require.True(t, matchContentType("Text/HTML", allowed))
+	require.False(t, matchContentType("image/png", allowed))
+	require.False(t, matchContentType("", allowed))
+	require.False(t, matchContentType("application/json", nil))
+}
+
+// BenchmarkRouter_Compression benchmarks a compressed response (writer pools keep allocations low)
+func BenchmarkRouter_Compression(b *testing.B) {
+	router := compressionTestRouter()
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/large", nil)
+	req.Header.Set(acceptEncodingHeader, encodingGzip)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		router.HTTPRouter.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
@@ -3,38 +3,77 @@ package apirouter
 import (
 	"encoding/json"
 	"net/http"
-
-	"github.com/mrz1836/go-logger"
+	"runtime"
+	"strconv"
+	"strings"
 )
 
 const (
 	// ErrCodeUnknown unknown error code (example)
 	ErrCodeUnknown int = 600
 
+	// ErrCodeBodyTooLarge is the error code when the request body exceeds the size limit
+	ErrCodeBodyTooLarge int = 601
+
+	// ErrCodePreconditionFailed is the error code when a conditional request (If-Match) fails
+	ErrCodePreconditionFailed int = 602
+
+	// ErrCodeWebSocketUpgrade is the error code when a WebSocket handshake is rejected
+	ErrCodeWebSocketUpgrade int = 603
+
+	// ErrCodeNotAcceptable is the error code when no response format matches the Accept header
+	ErrCodeNotAcceptable int = 604
+
+	// ErrCodeValidation is the error code when the request has invalid fields (see ValidationError)
+	ErrCodeValidation int = 605
+
+	// ErrCodeInvalidBody is the error code when the request body cannot be decoded (IE: malformed JSON)
+	ErrCodeInvalidBody int = 606
+
+	// ErrCodeInvalidFields is the error code when the requested sparse fieldset is invalid or not allowed (see SparseFields)
+	ErrCodeInvalidFields int = 607
+
 	// StatusCodeUnknown unknown HTTP status code (example)
 	StatusCodeUnknown int = 600
 
 	// logLevelError is the log level string used for error-level messages.
 	logLevelError = "error"
+
+	// maxStackDepth is the maximum number of frames captured by WithStack()
+	maxStackDepth = 32
 )
 
 // APIError is the enriched error message for API related errors
+//
+// The internal message, cause and stack trace are logged but never serialized to clients.
 type APIError struct {
+	Cause           error       `json:"-" url:"-" xml:"-"`               // Underlying error (available with errors.Is/errors.As)
 	Code            int         `json:"code" url:"code"`                 // Associated error code
 	Data            interface{} `json:"data" url:"data"`                 // Arbitrary data that is relevant
-	InternalMessage string      `json:"-" url:"-"`                       // An internal message for engineers
+	InternalMessage string      `json:"-" url:"-" xml:"-"`               // An internal message for engineers
 	IPAddress       string      `json:"ip_address" url:"ip_address"`     // Current IP of user
+	Locale          string      `json:"-" url:"-" xml:"-"`               // Language of the public message (sent as Content-Language)
 	Method          string      `json:"method" url:"method"`             // Method requested (IE: POST)
 	PublicMessage   string      `json:"message" url:"message"`           // Public error message
 	RequestGUID     string      `json:"request_guid" url:"request_guid"` // Unique Request ID for tracking
 	StatusCode      int         `json:"status_code" url:"status_code"`   // Associated HTTP status code (should be in request as well)
 	URL             string      `json:"url" url:"url"`                   // Requesting URL
+	captureStack    bool
+	stack           []uintptr
 }
 
+// APIErrorOption is a functional option for NewAPIError()
+type APIErrorOption func(e *APIError)
+
 // ErrorFromResponse generates a new error struct using CustomResponseWriter from LogRequest()
+// A registered error code (see ErrorCatalog) fills in an empty public message and a zero status code,
+// localized using the Accept-Language of the writer's request.
 func ErrorFromResponse(w *APIResponseWriter, internalMessage, publicMessage string, errorCode, statusCode int, data interface{}) *APIError {
+	// Use the defaults for a registered code
+	statusCode, publicMessage, locale := errorDefaults(w.acceptLanguage, errorCode, statusCode, publicMessage, data)
+
 	// Log the error
-	logError(statusCode, internalMessage, w.RequestID, w.IPAddress)
+	w.errorLogger.logError(errorCode, statusCode, internalMessage, w.RequestID, w.IPAddress)
 
 	// Return an error
 	return &APIError{
@@ -42,6 +81,7 @@ func ErrorFromResponse(w *APIResponseWriter, internalMessage, publicMessage stri
 		Data:            data,
 		InternalMessage: internalMessage,
 		IPAddress:       w.IPAddress,
+		Locale:          locale,
 		Method:          w.Method,
 		PublicMessage:   publicMessage,
 		RequestGUID:     w.RequestID,
@@ -51,13 +91,18 @@ func ErrorFromResponse(w *APIResponseWriter, internalMessage, publicMessage stri
 }
 
 // ErrorFromRequest gives an error without a response writer using the request
+// A registered error code (see ErrorCatalog) fills in an empty public message and a zero status code,
+// IE: ErrorFromRequest(req, "", "", ErrCodeBodyTooLarge, 0, nil)
 func ErrorFromRequest(req *http.Request, internalMessage, publicMessage string, errorCode, statusCode int, data interface{}) *APIError {
 	// Get values from req if available
 	ip, _ := GetIPFromRequest(req)
 	id, _ := GetRequestID(req)
 
+	// Use the defaults for a registered code
+	statusCode, publicMessage, locale := errorDefaults(requestLanguage(req), errorCode, statusCode, publicMessage, data)
+
 	// Log the error
-	logError(statusCode, internalMessage, id, ip)
+	requestErrorLogger(req).logError(errorCode, statusCode, internalMessage, id, ip)
 
 	// Return an error
 	return &APIError{
@@ -65,6 +110,7 @@ func ErrorFromRequest(req *http.Request, internalMessage, publicMessage string,
 		Data:            data,
 		InternalMessage: internalMessage,
 		IPAddress:       ip,
+		Locale:          locale,
 		Method:          req.Method,
 		PublicMessage:   publicMessage,
 		RequestGUID:     id,
@@ -73,28 +119,98 @@ func ErrorFromRequest(req *http.Request, internalMessage, publicMessage string,
 	}
 }
 
-// logError will log the internal message and code for diagnosing
-func logError(statusCode int, internalMessage, requestID, ipAddress string) {
-	// Skip non-error codes
-	if statusCode < http.StatusBadRequest || statusCode == http.StatusNotFound {
-		return
+// NewAPIError wraps the error (the cause) with the request details, defaulting to a 500 with a generic public message.
+// The cause is used as the internal message unless WithInternalMessage() is set, and the error is logged once created.
+// WithCode() uses the status code and public message of a registered code unless they are also set.
+func NewAPIError(req *http.Request, err error, opts ...APIErrorOption) *APIError {
+	// Get values from req if available
+	ip, _ := GetIPFromRequest(req)
+	id, _ := GetRequestID(req)
+
+	e := &APIError{
+		Cause:       err,
+		IPAddress:   ip,
+		Method:      req.Method,
+		RequestGUID: id,
+		URL:         req.URL.String(),
+	}
+	if err != nil {
+		e.InternalMessage = err.Error()
+	}
+	if validationErr, ok := validationError(err); ok {
+		e.Code, e.Data = ErrCodeValidation, validationErr.Fields
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	// Use the defaults for a registered code
+	if e.Code == 0 {
+		e.Code = ErrCodeUnknown
+	} else {
+		e.StatusCode, e.PublicMessage, e.Locale = errorDefaults(requestLanguage(req), e.Code, e.StatusCode, e.PublicMessage, e.Data)
+	}
+	if e.StatusCode == 0 {
+		e.StatusCode = http.StatusInternalServerError
+	}
+	if len(e.PublicMessage) == 0 {
+		e.PublicMessage = http.StatusText(e.StatusCode)
+	}
+	if e.captureStack {
+		e.stack = captureStack(3)
+	}
+
+	// Log the error
+	e.log(requestErrorLogger(req))
+	return e
+}
+
+// WithCode sets the error code
+func WithCode(code int) APIErrorOption {
+	return func(e *APIError) {
+		e.Code = code
 	}
+}
+
+// WithData sets the public data
+func WithData(data interface{}) APIErrorOption {
+	return func(e *APIError) {
+		e.Data = data
+	}
+}
 
-	// Start with error
-	logLevel := logLevelError
+// WithInternalMessage sets the internal message (logged, never sent to the client)
+func WithInternalMessage(message string) APIErrorOption {
+	return func(e *APIError) {
+		e.InternalMessage = message
+	}
+}
 
-	// Switch based on known statuses
-	if statusCode == http.StatusBadRequest ||
-		statusCode == http.StatusUnauthorized ||
-		statusCode == http.StatusMethodNotAllowed ||
-		statusCode == http.StatusLocked ||
-		statusCode == http.StatusForbidden ||
-		statusCode == http.StatusUnprocessableEntity {
-		logLevel = "warn"
+// WithPublicMessage sets the message that is sent to the client
+func WithPublicMessage(message string) APIErrorOption {
+	return func(e *APIError) {
+		e.PublicMessage = message
 	}
+}
 
-	// Show the login a standard way
-	logger.NoFilePrintf(LogErrorFormat, requestID, ipAddress, logLevel, internalMessage, statusCode)
+// WithStack captures the stack trace where the error was created (logged, never sent to the client)
+func WithStack() APIErrorOption {
+	return func(e *APIError) {
+		e.captureStack = true
+	}
+}
+
+// WithStatus sets the HTTP status code
+func WithStatus(statusCode int) APIErrorOption {
+	return func(e *APIError) {
+		e.StatusCode = statusCode
+	}
+}
+
+// captureStack returns the program counters of the caller's stack, skipping the given frames
+func captureStack(skip int) []uintptr {
+	pcs := make([]uintptr, maxStackDepth)
+	return pcs[:runtime.Callers(skip, pcs)]
 }
 
 // Error returns the string error message (only public message)
@@ -117,3 +233,57 @@ func (e *APIError) JSON() (string, error) {
 func (e *APIError) Internal() string {
 	return e.InternalMessage
 }
+
+// Unwrap returns the underlying cause (for errors.Is and errors.As)
+func (e *APIError) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+	return e.Cause
+}
+
+// StackTrace returns the stack trace captured when the error was created (empty unless WithStack() was used)
+func (e *APIError) StackTrace() string {
+	if len(e.stack) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		frame, more := frames.Next()
+		b.WriteString(frame.Function)
+		b.WriteString("\n\t")
+		b.WriteString(frame.File)
+		b.WriteString(":")
+		b.WriteString(strconv.Itoa(frame.Line))
+		b.WriteString("\n")
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// log writes the internal message, cause and stack trace (if captured) to the Router's logs
+func (e *APIError) log(l *errorLogger) {
+	logLevel, ok := l.logLevel(e.Code, e.StatusCode)
+	if !ok {
+		return
+	}
+
+	// Include the cause if it is not already the internal message
+	message := e.InternalMessage
+	if e.Cause != nil && message != e.Cause.Error() {
+		if len(message) > 0 {
+			message += ": "
+		}
+		message += e.Cause.Error()
+	}
+
+	if len(e.stack) > 0 {
+		l.printf(LogErrorStackFormat, e.RequestGUID, e.IPAddress, logLevel, message, e.StatusCode, strings.ReplaceAll(e.StackTrace(), "\n", ";"))
+		return
+	}
+	l.printf(LogErrorFormat, e.RequestGUID, e.IPAddress, logLevel, message, e.StatusCode)
+}
@@ -0,0 +1,120 @@
+package apirouter
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"slices"
+
+	"github.com/mrz1836/go-logger"
+)
+
+// ErrorLogPolicy controls how the Router logs API errors (ErrorFromRequest, ErrorFromResponse and NewAPIError)
+//
+// A log level registered for the error code (see ErrorCatalog) takes precedence over Levels.
+type ErrorLogPolicy struct {
+	Levels      map[int]string  `json:"levels" url:"levels"`             // Log level by HTTP status code, overriding the defaults (LogLevelNone skips the status)
+	SampleRates map[int]float64 `json:"sample_rates" url:"sample_rates"` // Fraction of errors logged by error code (IE: 0.01 logs 1%)
+	Suppress    []int           `json:"suppress" url:"suppress"`         // Error codes that are never logged
+}
+
+// errorLogger writes API errors to the Router's logger using its policy
+type errorLogger struct {
+	logger LoggerInterface
+	policy *ErrorLogPolicy
+}
+
+// errorLogger returns the logger and policy stored on each request
+func (r *Router) errorLogger() *errorLogger {
+	return &errorLogger{logger: r.Logger, policy: r.ErrorLogPolicy}
+}
+
+// requestErrorLogger returns the Router's error logger for the request (nil if the request did not go through the Router)
+func requestErrorLogger(req *http.Request) *errorLogger {
+	if req == nil {
+		return nil
+	}
+	l, _ := req.Context().Value(errorLoggerKey).(*errorLogger)
+	return l
+}
+
+// logLevel returns the log level for the error, or false if it should not be logged (suppressed or not sampled)
+func (p *ErrorLogPolicy) logLevel(errorCode, statusCode int) (string, bool) {
+	if p == nil {
+		return errorLogLevel(errorCode, statusCode, nil)
+	}
+	if slices.Contains(p.Suppress, errorCode) {
+		return "", false
+	}
+
+	logLevel, ok := errorLogLevel(errorCode, statusCode, p.Levels)
+	if !ok {
+		return "", false
+	}
+
+	// Only log a fraction of the noisy codes
+	if rate, found := p.SampleRates[errorCode]; found && rand.Float64() >= rate { //nolint:gosec // sampling does not need a secure random number
+		return "", false
+	}
+	return logLevel, true
+}
+
+// printf writes to the Router's logger, or the default logger if the error was not created from a Router request
+func (l *errorLogger) printf(format string, v ...interface{}) {
+	if l == nil || l.logger == nil {
+		logger.NoFilePrintf(format, v...)
+		return
+	}
+	l.logger.Printf(format, v...)
+}
+
+// logLevel returns the log level for the error using the Router's policy (or the defaults)
+func (l *errorLogger) logLevel(errorCode, statusCode int) (string, bool) {
+	if l == nil {
+		return errorLogLevel(errorCode, statusCode, nil)
+	}
+	return l.policy.logLevel(errorCode, statusCode)
+}
+
+// logError will log the internal message and code for diagnosing
+func (l *errorLogger) logError(errorCode, statusCode int, internalMessage, requestID, ipAddress string) {
+	logLevel, ok := l.logLevel(errorCode, statusCode)
+	if !ok {
+		return
+	}
+
+	// Show the log in a standard way
+	l.printf(LogErrorFormat, requestID, ipAddress, logLevel, internalMessage, statusCode)
+}
+
+// errorLogLevel returns the log level for the error code (if registered), the configured levels or the status code,
+// or false if it should not be logged
+func errorLogLevel(errorCode, statusCode int, levels map[int]string) (string, bool) {
+	// Registered codes can set the level
+	if definition, ok := DefaultErrorCatalog.Lookup(errorCode); ok && len(definition.LogLevel) > 0 {
+		return definition.LogLevel, definition.LogLevel != LogLevelNone
+	}
+
+	// Configured levels by status
+	if logLevel, ok := levels[statusCode]; ok {
+		return logLevel, logLevel != LogLevelNone
+	}
+
+	// Skip non-error codes
+	if statusCode < http.StatusBadRequest || statusCode == http.StatusNotFound {
+		return "", false
+	}
+
+	// Start with error
+	logLevel := logLevelError
+
+	// Switch based on known statuses
+	if statusCode == http.StatusBadRequest ||
+		statusCode == http.StatusUnauthorized ||
+		statusCode == http.StatusMethodNotAllowed ||
+		statusCode == http.StatusLocked ||
+		statusCode == http.StatusForbidden ||
+		statusCode == http.StatusUnprocessableEntity {
+		logLevel = LogLevelWarn
+	}
+	return logLevel, true
+}
@@ -0,0 +1,125 @@
+package apirouter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+// errTestLogging is the cause used for logging tests
+var errTestLogging = errors.New("logging cause")
+
+// serveErrorLogging serves the handler through the router and returns the log lines
+func serveErrorLogging(t *testing.T, policy *ErrorLogPolicy, h httprouter.Handle) *captureLogger {
+	t.Helper()
+
+	logs := &captureLogger{}
+	router := New()
+	router.Logger = logs
+	router.ErrorLogPolicy = policy
+	router.HTTPRouter.GET("/test", router.RequestNoLogging(h))
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/test", nil)
+	router.HTTPRouter.ServeHTTP(httptest.NewRecorder(), req)
+	return logs
+}
+
+// TestErrorLogging tests that API errors use the router's logger and policy
+func TestErrorLogging(t *testing.T) {
+	t.Parallel()
+
+	t.Run("error from request uses the router logger", func(t *testing.T) {
+		logs := serveErrorLogging(t, nil, func(_ http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+			_ = ErrorFromRequest(req, "request failed", "failed", ErrCodeUnknown, http.StatusBadRequest, nil)
+		})
+		require.True(t, logs.contains("internal_message=\"request failed\""))
+		require.True(t, logs.contains("type=\"warn\""))
+	})
+
+	t.Run("error from response uses the router logger", func(t *testing.T) {
+		logs := serveErrorLogging(t, nil, func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+			writer, ok := w.(*APIResponseWriter)
+			require.True(t, ok)
+			_ = ErrorFromResponse(writer, "response failed", "failed", ErrCodeUnknown, http.StatusInternalServerError, nil)
+		})
+		require.True(t, logs.contains("internal_message=\"response failed\""))
+		require.True(t, logs.contains("type=\"error\""))
+	})
+
+	t.Run("new api error uses the router logger", func(t *testing.T) {
+		logs := serveErrorLogging(t, nil, func(_ http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+			_ = NewAPIError(req, errTestLogging)
+		})
+		require.True(t, logs.contains(errTestLogging.Error()))
+	})
+
+	t.Run("configured levels by status", func(t *testing.T) {
+		policy := &ErrorLogPolicy{Levels: map[int]string{
+			http.StatusNotFound:   LogLevelInfo,
+			http.StatusBadRequest: LogLevelNone,
+		}}
+		logs := serveErrorLogging(t, policy, func(_ http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+			_ = ErrorFromRequest(req, "not found", "", ErrCodeUnknown, http.StatusNotFound, nil)
+			_ = ErrorFromRequest(req, "bad request", "", ErrCodeUnknown, http.StatusBadRequest, nil)
+		})
+		require.True(t, logs.contains("internal_message=\"not found\""))
+		require.True(t, logs.contains("type=\"info\""))
+		require.False(t, logs.contains("bad request"))
+	})
+
+	t.Run("suppressed codes", func(t *testing.T) {
+		policy := &ErrorLogPolicy{Suppress: []int{ErrCodeUnknown}}
+		logs := serveErrorLogging(t, policy, func(_ http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+			_ = ErrorFromRequest(req, "suppressed", "", ErrCodeUnknown, http.StatusInternalServerError, nil)
+			_ = NewAPIError(req, errTestLogging, WithStack())
+		})
+		require.Empty(t, logs.lines)
+	})
+
+	t.Run("sampled codes", func(t *testing.T) {
+		policy := &ErrorLogPolicy{SampleRates: map[int]float64{ErrCodeUnknown: 0, ErrCodeBodyTooLarge: 1}}
+		logs := serveErrorLogging(t, policy, func(_ http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+			for i := 0; i < 10; i++ {
+				_ = ErrorFromRequest(req, "never sampled", "", ErrCodeUnknown, http.StatusInternalServerError, nil)
+			}
+			_ = ErrorFromRequest(req, "always sampled", "", ErrCodeBodyTooLarge, 0, nil)
+		})
+		require.False(t, logs.contains("never sampled"))
+		require.True(t, logs.contains("always sampled"))
+	})
+}
+
+// TestErrorLogPolicy_logLevel tests the level, suppression and sampling decisions
+func TestErrorLogPolicy_logLevel(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil policy uses the defaults", func(t *testing.T) {
+		var policy *ErrorLogPolicy
+		level, ok := policy.logLevel(ErrCodeUnknown, http.StatusForbidden)
+		require.True(t, ok)
+		require.Equal(t, LogLevelWarn, level)
+
+		_, ok = policy.logLevel(ErrCodeUnknown, http.StatusNotFound)
+		require.False(t, ok)
+	})
+
+	t.Run("catalog level takes precedence", func(t *testing.T) {
+		require.NoError(t, RegisterErrorCode(ErrorDefinition{Code: 3001, Name: "logging_test", LogLevel: LogLevelInfo}))
+		policy := &ErrorLogPolicy{Levels: map[int]string{http.StatusConflict: LogLevelError}}
+
+		level, ok := policy.logLevel(3001, http.StatusConflict)
+		require.True(t, ok)
+		require.Equal(t, LogLevelInfo, level)
+	})
+
+	t.Run("sampling applies after the level", func(t *testing.T) {
+		policy := &ErrorLogPolicy{SampleRates: map[int]float64{ErrCodeUnknown: 1}}
+		_, ok := policy.logLevel(ErrCodeUnknown, http.StatusOK)
+		require.False(t, ok)
+	})
+}
@@ -2,9 +2,14 @@ package apirouter
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 // setupTest creates the foundation for each error test
@@ -237,3 +242,103 @@ func BenchmarkAPIError_ErrorCode(b *testing.B) {
 		_ = err.ErrorCode()
 	}
 }
+
+// errTestDatabase is a cause for the wrapping tests
+var errTestDatabase = errors.New("connection refused")
+
+// testQueryError is a typed cause for errors.As
+type testQueryError struct {
+	query string
+}
+
+// Error returns the query
+func (e *testQueryError) Error() string {
+	return "query failed: " + e.query
+}
+
+// TestNewAPIError tests creating an error that wraps a cause
+func TestNewAPIError(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/users", nil)
+	req = SetOnRequest(req, requestIDKey, "request-123")
+	req = SetOnRequest(req, ipAddressKey, "127.0.0.1")
+
+	t.Run("defaults", func(t *testing.T) {
+		err := NewAPIError(req, errTestDatabase)
+		require.Equal(t, ErrCodeUnknown, err.Code)
+		require.Equal(t, http.StatusInternalServerError, err.StatusCode)
+		require.Equal(t, "Internal Server Error", err.Error())
+		require.Equal(t, errTestDatabase.Error(), err.Internal())
+		require.Equal(t, "request-123", err.RequestGUID)
+		require.Equal(t, "127.0.0.1", err.IPAddress)
+		require.Equal(t, http.MethodPost, err.Method)
+		require.Equal(t, "/users", err.URL)
+		require.Empty(t, err.StackTrace())
+	})
+
+	t.Run("options", func(t *testing.T) {
+		err := NewAPIError(req, errTestDatabase,
+			WithCode(ErrCodeBodyTooLarge),
+			WithData(map[string]int{"limit": 10}),
+			WithInternalMessage("saving user"),
+			WithPublicMessage("unable to save the user"),
+			WithStatus(http.StatusServiceUnavailable),
+		)
+		require.Equal(t, ErrCodeBodyTooLarge, err.Code)
+		require.Equal(t, map[string]int{"limit": 10}, err.Data)
+		require.Equal(t, "saving user", err.Internal())
+		require.Equal(t, "unable to save the user", err.Error())
+		require.Equal(t, http.StatusServiceUnavailable, err.StatusCode)
+	})
+
+	t.Run("errors.Is and errors.As see the cause", func(t *testing.T) {
+		var err error = NewAPIError(req, fmt.Errorf("loading user: %w", &testQueryError{query: "select"}))
+		var queryErr *testQueryError
+		require.ErrorAs(t, err, &queryErr)
+		require.Equal(t, "select", queryErr.query)
+
+		err = NewAPIError(req, errTestDatabase)
+		require.ErrorIs(t, err, errTestDatabase)
+
+		var apiErr *APIError
+		require.ErrorAs(t, fmt.Errorf("handler: %w", err), &apiErr)
+		require.Equal(t, errTestDatabase, apiErr.Unwrap())
+	})
+
+	t.Run("stack trace", func(t *testing.T) {
+		err := NewAPIError(req, errTestDatabase, WithStack())
+		stack := err.StackTrace()
+		require.True(t, strings.HasPrefix(stack, "github.com/mrz1836/go-api-router.TestNewAPIError"), stack)
+		require.Contains(t, stack, "error_test.go:")
+	})
+
+	t.Run("internal details are never serialized", func(t *testing.T) {
+		err := NewAPIError(req, errTestDatabase, WithStack(), WithInternalMessage("secret internal"))
+		data, jsonErr := err.JSON()
+		require.NoError(t, jsonErr)
+		require.NotContains(t, data, "connection refused")
+		require.NotContains(t, data, "secret internal")
+		require.NotContains(t, data, "error_test.go")
+
+		rr := httptest.NewRecorder()
+		xmlReq := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil)
+		xmlReq.Header.Set(acceptHeader, "application/xml")
+		RespondNegotiated(rr, xmlReq, http.StatusInternalServerError, err)
+		require.NotContains(t, rr.Body.String(), "secret internal")
+	})
+
+	t.Run("nil cause", func(t *testing.T) {
+		err := NewAPIError(req, nil, WithStatus(http.StatusBadRequest))
+		require.NoError(t, err.Unwrap())
+		require.Equal(t, "Bad Request", err.Error())
+	})
+}
+
+// ExampleNewAPIError example using NewAPIError()
+func ExampleNewAPIError() {
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/users/1", nil)
+	err := NewAPIError(req, errTestDatabase, WithStatus(http.StatusNotFound), WithPublicMessage("user not found"))
+	fmt.Println(err.Error(), errors.Is(err, errTestDatabase))
+	// Output:user not found true
+}
@@ -31,3 +31,60 @@ var ErrIssuerTooLong = errors.New("issuer exceeds maximum length")
 
 // ErrSessionIDTooLong is when the session ID exceeds the maximum length
 var ErrSessionIDTooLong = errors.New("session id exceeds maximum length")
+
+// ErrStreamingNotSupported is when the response writer cannot be flushed for streaming
+var ErrStreamingNotSupported = errors.New("response writer does not support streaming")
+
+// ErrInvalidEventField is when an event id or name contains a line break
+var ErrInvalidEventField = errors.New("event id and name cannot contain line breaks")
+
+// ErrNotWebSocketUpgrade is when the request is not a valid WebSocket upgrade request
+var ErrNotWebSocketUpgrade = errors.New("request is not a websocket upgrade")
+
+// ErrWebSocketVersion is when the client requests an unsupported WebSocket version
+var ErrWebSocketVersion = errors.New("unsupported websocket version")
+
+// ErrWebSocketKey is when the Sec-WebSocket-Key header is missing or invalid
+var ErrWebSocketKey = errors.New("missing or invalid websocket key")
+
+// ErrWebSocketOrigin is when the origin is not allowed to open a WebSocket
+var ErrWebSocketOrigin = errors.New("websocket origin is not allowed")
+
+// ErrWebSocketClosed is when writing to a WebSocket that has been closed
+var ErrWebSocketClosed = errors.New("websocket connection is closed")
+
+// ErrInvalidMessageType is when a WebSocket message is not text or binary
+var ErrInvalidMessageType = errors.New("websocket message type must be text or binary")
+
+// ErrControlFrameTooLarge is when a WebSocket ping or close payload exceeds 125 bytes
+var ErrControlFrameTooLarge = errors.New("websocket control frame payload exceeds 125 bytes")
+
+// ErrUnsupportedResponseData is when the data cannot be encoded in the negotiated format (IE: CSV for a map)
+var ErrUnsupportedResponseData = errors.New("data cannot be encoded in this format")
+
+// ErrDuplicateErrorCode is when an error code is registered more than once
+var ErrDuplicateErrorCode = errors.New("error code is already registered")
+
+// ErrInvalidBindTarget is when Bind() is not given a pointer to a struct
+var ErrInvalidBindTarget = errors.New("bind target must be a non-nil pointer to a struct")
+
+// ErrUnsupportedBindType is when a bound field has a type that cannot be converted from a string
+var ErrUnsupportedBindType = errors.New("unsupported field type for binding")
+
+// ErrInvalidValidateTarget is when Validate() is not given a struct or a pointer to a struct
+var ErrInvalidValidateTarget = errors.New("validate target must be a struct or a pointer to a struct")
+
+// ErrInvalidValidationRule is when a validate tag has an invalid parameter (IE: min=abc)
+var ErrInvalidValidationRule = errors.New("invalid validation rule")
+
+// ErrUnknownValidationRule is when a validate tag uses a rule that is not registered
+var ErrUnknownValidationRule = errors.New("unknown validation rule")
+
+// ErrInvalidAllowedFields is when the allowed fields of JSONEncodeHierarchy are not a []string, *Fieldset or AllowedKeys
+var ErrInvalidAllowedFields = errors.New("allowed fields must be a []string or AllowedKeys")
+
+// ErrInvalidFieldsParam is when the fields query parameter cannot be parsed (IE: unbalanced parentheses)
+var ErrInvalidFieldsParam = errors.New("invalid fields parameter")
+
+// ErrUnknownField is when the fields query parameter requests a field that is not allowed
+var ErrUnknownField = errors.New("unknown field requested")
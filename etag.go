@@ -0,0 +1,169 @@
+package apirouter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Conditional request headers
+const (
+	etagHeader              string = "ETag"
+	ifMatchHeader           string = "If-Match"
+	ifModifiedSinceHeader   string = "If-Modified-Since"
+	ifNoneMatchHeader       string = "If-None-Match"
+	ifUnmodifiedSinceHeader string = "If-Unmodified-Since"
+	lastModifiedHeader      string = "Last-Modified"
+	weakETagPrefix          string = "W/"
+)
+
+// ETagOptions is the configuration for the ETag middleware
+type ETagOptions struct {
+	// CurrentState returns the ETag and last modified time of the resource targeted by the request.
+	// It is used to evaluate If-Match and If-Unmodified-Since (optimistic concurrency on PUT/PATCH/DELETE).
+	// Return an empty ETag and zero time if the resource does not exist.
+	CurrentState func(req *http.Request) (etag string, lastModified time.Time)
+
+	// Weak will generate weak ETags (W/"..."), they are always weak when the response varies by
+	// the Accept-Encoding (IE: compression is enabled), since the tag is generated from the uncompressed body
+	Weak bool
+}
+
+// ETag returns middleware that adds ETags to GET/HEAD responses and handles conditional requests.
+//
+// Successful GET/HEAD responses are buffered and given an ETag (unless the handler set one), then
+// If-None-Match and If-Modified-Since are evaluated and a 304 Not Modified is sent when the client is current.
+// If-Match and If-Unmodified-Since are evaluated using CurrentState and fail with 412 Precondition Failed.
+func ETag(options ETagOptions) Middleware {
+	return func(h httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+			// Evaluate the preconditions before any changes are made
+			if options.CurrentState != nil && (len(req.Header.Get(ifMatchHeader)) > 0 || len(req.Header.Get(ifUnmodifiedSinceHeader)) > 0) {
+				etag, lastModified := options.CurrentState(req)
+				if !CheckPreconditions(w, req, etag, lastModified) {
+					return
+				}
+			}
+
+			// Only safe methods have a representation to tag
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				h(w, req, ps)
+				return
+			}
+
+			writer := responseWriterFor(w)
+			status, body := writer.bufferResponse(h, req, ps)
+
+			// Only tag successful responses
+			if status != http.StatusOK {
+				writer.writeBuffered(status, body)
+				return
+			}
+
+			header := writer.Header()
+			if len(header.Get(etagHeader)) == 0 {
+				header.Set(etagHeader, GenerateETag(body, options.Weak || hasVary(header, acceptEncodingHeader)))
+			}
+
+			// Is the client already current?
+			if notModified(req, header) {
+				for _, key := range []string{contentTypeHeader, contentLengthHeader, contentEncodingHeader} {
+					header.Del(key)
+				}
+				writer.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			header.Set(contentLengthHeader, strconv.Itoa(len(body)))
+			writer.writeBuffered(status, body)
+		}
+	}
+}
+
+// GenerateETag creates an ETag from the response body (weak ETags are prefixed with W/)
+func GenerateETag(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return weakETagPrefix + etag
+	}
+	return etag
+}
+
+// CheckPreconditions evaluates If-Match and If-Unmodified-Since against the current state of the resource.
+// It responds with 412 Precondition Failed and returns false if the request should not proceed.
+// Use an empty etag and zero time if the resource does not exist.
+func CheckPreconditions(w http.ResponseWriter, req *http.Request, etag string, lastModified time.Time) bool {
+	passed := true
+	if ifMatch := req.Header.Get(ifMatchHeader); len(ifMatch) > 0 {
+		passed = matchETags(ifMatch, etag, false)
+	} else if ifUnmodifiedSince := req.Header.Get(ifUnmodifiedSinceHeader); len(ifUnmodifiedSince) > 0 && !lastModified.IsZero() {
+		if since, err := http.ParseTime(ifUnmodifiedSince); err == nil {
+			passed = !lastModified.Truncate(time.Second).After(since)
+		}
+	}
+
+	if !passed {
+		RespondWith(w, req, http.StatusPreconditionFailed, ErrorFromRequest(
+			req,
+			"precondition failed for etag "+etag,
+			"the resource has been modified, fetch the latest version and try again",
+			ErrCodePreconditionFailed, http.StatusPreconditionFailed, nil,
+		))
+	}
+	return passed
+}
+
+// notModified returns true if the conditional GET headers match the response headers
+func notModified(req *http.Request, header http.Header) bool {
+	// If-None-Match takes precedence over If-Modified-Since
+	if ifNoneMatch := req.Header.Get(ifNoneMatchHeader); len(ifNoneMatch) > 0 {
+		return matchETags(ifNoneMatch, header.Get(etagHeader), true)
+	}
+
+	ifModifiedSince := req.Header.Get(ifModifiedSinceHeader)
+	lastModified := header.Get(lastModifiedHeader)
+	if len(ifModifiedSince) == 0 || len(lastModified) == 0 {
+		return false
+	}
+
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+// matchETags checks the ETag against a list from If-Match or If-None-Match (IE: "a", W/"b" or *).
+// Weak comparison ignores the W/ prefix, strong comparison never matches weak ETags.
+func matchETags(list, etag string, weak bool) bool {
+	if len(etag) == 0 {
+		return false
+	}
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	etagWeak := strings.HasPrefix(etag, weakETagPrefix)
+	opaque := strings.TrimPrefix(etag, weakETagPrefix)
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		candidateWeak := strings.HasPrefix(candidate, weakETagPrefix)
+		if !weak && (etagWeak || candidateWeak) {
+			continue
+		}
+		if strings.TrimPrefix(candidate, weakETagPrefix) == opaque {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package apirouter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+// etagTestModified is the last modified time of the test resource
+var etagTestModified = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// etagTestRouter creates a router with the ETag middleware on a resource
+func etagTestRouter(options ETagOptions) *Router {
+	router := New()
+	s := NewStack()
+	s.Use(ETag(options))
+
+	handler := func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead:
+			w.Header().Set(lastModifiedHeader, etagTestModified.Format(http.TimeFormat))
+			RespondWith(w, req, http.StatusOK, map[string]string{"name": testNameJohn})
+		default:
+			RespondWith(w, req, http.StatusOK, map[string]string{"status": "updated"})
+		}
+	}
+	router.HTTPRouter.GET("/resource", router.Request(s.Wrap(handler)))
+	router.HTTPRouter.HEAD("/resource", router.Request(s.Wrap(handler)))
+	router.HTTPRouter.PUT("/resource", router.Request(s.Wrap(handler)))
+	router.HTTPRouter.GET("/missing", router.Request(s.Wrap(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		RespondWith(w, req, http.StatusNotFound, nil)
+	})))
+	return router
+}
+
+// TestETag tests the ETag middleware
+func TestETag(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"name":"John Doe"}`)
+	etag := GenerateETag(body, false)
+
+	t.Run("adds a strong etag to GET responses", func(t *testing.T) {
+		rr := serveRequest(etagTestRouter(ETagOptions{}), http.MethodGet, "/resource", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, etag, rr.Header().Get(etagHeader))
+		require.Equal(t, string(body), rr.Body.String())
+	})
+
+	t.Run("adds a weak etag", func(t *testing.T) {
+		rr := serveRequest(etagTestRouter(ETagOptions{Weak: true}), http.MethodGet, "/resource", nil)
+		require.Equal(t, "W/"+etag, rr.Header().Get(etagHeader))
+	})
+
+	t.Run("etags are weak with compression", func(t *testing.T) {
+		router := etagTestRouter(ETagOptions{})
+		router.CompressionEnabled = true
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			rr := serveRequest(router, method, "/resource", map[string]string{acceptEncodingHeader: encodingGzip})
+			require.Equal(t, "W/"+etag, rr.Header().Get(etagHeader))
+		}
+
+		rr := serveRequest(router, http.MethodGet, "/resource", map[string]string{ifNoneMatchHeader: etag})
+		require.Equal(t, http.StatusNotModified, rr.Code)
+	})
+
+	t.Run("If-None-Match returns 304", func(t *testing.T) {
+		rr := serveRequest(etagTestRouter(ETagOptions{}), http.MethodGet, "/resource", map[string]string{ifNoneMatchHeader: `"other", ` + etag})
+		require.Equal(t, http.StatusNotModified, rr.Code)
+		require.Empty(t, rr.Body.String())
+		require.Equal(t, etag, rr.Header().Get(etagHeader))
+		require.Empty(t, rr.Header().Get(contentLengthHeader))
+	})
+
+	t.Run("If-None-Match uses weak comparison", func(t *testing.T) {
+		rr := serveRequest(etagTestRouter(ETagOptions{}), http.MethodHead, "/resource", map[string]string{ifNoneMatchHeader: "W/" + etag})
+		require.Equal(t, http.StatusNotModified, rr.Code)
+	})
+
+	t.Run("If-None-Match mismatch returns the body", func(t *testing.T) {
+		rr := serveRequest(etagTestRouter(ETagOptions{}), http.MethodGet, "/resource", map[string]string{ifNoneMatchHeader: `"stale"`})
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, string(body), rr.Body.String())
+	})
+
+	t.Run("If-Modified-Since returns 304 when not modified", func(t *testing.T) {
+		rr := serveRequest(etagTestRouter(ETagOptions{}), http.MethodGet, "/resource", map[string]string{
+			ifModifiedSinceHeader: etagTestModified.Add(time.Hour).Format(http.TimeFormat),
+		})
+		require.Equal(t, http.StatusNotModified, rr.Code)
+	})
+
+	t.Run("If-Modified-Since returns the body when modified", func(t *testing.T) {
+		rr := serveRequest(etagTestRouter(ETagOptions{}), http.MethodGet, "/resource", map[string]string{
+			ifModifiedSinceHeader: etagTestModified.Add(-time.Hour).Format(http.TimeFormat),
+		})
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("error responses are not tagged", func(t *testing.T) {
+		rr := serveRequest(etagTestRouter(ETagOptions{}), http.MethodGet, "/missing", nil)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Empty(t, rr.Header().Get(etagHeader))
+		require.JSONEq(t, `{"error":"Not Found","code":404}`, rr.Body.String())
+	})
+}
+
+// TestETag_Preconditions tests If-Match and If-Unmodified-Since on unsafe methods
+func TestETag_Preconditions(t *testing.T) {
+	t.Parallel()
+
+	current := GenerateETag([]byte("version-2"), false)
+	router := etagTestRouter(ETagOptions{
+		CurrentState: func(_ *http.Request) (string, time.Time) {
+			return current, etagTestModified
+		},
+	})
+
+	t.Run("matching If-Match proceeds", func(t *testing.T) {
+		rr := serveRequest(router, http.MethodPut, "/resource", map[string]string{ifMatchHeader: current})
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("wildcard If-Match proceeds when the resource exists", func(t *testing.T) {
+		rr := serveRequest(router, http.MethodPut, "/resource", map[string]string{ifMatchHeader: "*"})
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("stale If-Match fails with 412", func(t *testing.T) {
+		rr := serveRequest(router, http.MethodPut, "/resource", map[string]string{ifMatchHeader: GenerateETag([]byte("version-1"), false)})
+		require.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	})
+
+	t.Run("weak If-Match never matches", func(t *testing.T) {
+		rr := serveRequest(router, http.MethodPut, "/resource", map[string]string{ifMatchHeader: "W/" + current})
+		require.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	})
+
+	t.Run("If-Unmodified-Since before the last change fails with 412", func(t *testing.T) {
+		rr := serveRequest(router, http.MethodPut, "/resource", map[string]string{
+			ifUnmodifiedSinceHeader: etagTestModified.Add(-time.Minute).Format(http.TimeFormat),
+		})
+		require.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	})
+
+	t.Run("If-Unmodified-Since after the last change proceeds", func(t *testing.T) {
+		rr := serveRequest(router, http.MethodPut, "/resource", map[string]string{
+			ifUnmodifiedSinceHeader: etagTestModified.Format(http.TimeFormat),
+		})
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+// TestCheckPreconditions tests CheckPreconditions() for a missing resource
+func TestCheckPreconditions(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodPut, "/resource", nil)
+	req.Header.Set(ifMatchHeader, "*")
+	rr := httptest.NewRecorder()
+
+	require.False(t, CheckPreconditions(rr, req, "", time.Time{}))
+	require.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+	req.Header.Del(ifMatchHeader)
+	require.True(t, CheckPreconditions(httptest.NewRecorder(), req, "", time.Time{}))
+}
+
+// TestGenerateETag tests GenerateETag()
+func TestGenerateETag(t *testing.T) {
+	t.Parallel()
+
+	strong := GenerateETag([]byte("hello"), false)
+	require.Len(t, strong, 34)
+	require.Equal(t, strong, GenerateETag([]byte("hello"), false))
+	require.NotEqual(t, strong, GenerateETag([]byte("hello!"), false))
+	require.Equal(t, "W/"+strong, GenerateETag([]byte("hello"), true))
+}
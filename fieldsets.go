@@ -0,0 +1,175 @@
+package apirouter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// fieldsParam is the query parameter for sparse fieldsets
+const fieldsParam = "fields"
+
+// Fieldset is a sparse fieldset requested by the client (see SparseFields), compiled for encoding
+//
+// The fields chosen by the client are kept in bounded caches of their own, so encode with the Fieldset's
+// methods (or JSONEncodeHierarchy) rather than passing the Fields to JSONEncode(), which caches them with the server's fields.
+type Fieldset struct {
+	Fields []string // The allowed fields (IE: "id" and "profile.bio")
+	set    *allowedSet
+}
+
+// SparseFields returns the fields requested with ?fields=id,name,profile(avatar,bio) as a Fieldset
+// (IE: "id", "name", "profile.avatar" and "profile.bio").
+//
+//	fields, err := SparseFields(req, []string{"id", "name", "profile"})
+//	if err != nil {
+//		RespondWith(w, req, http.StatusBadRequest, err)
+//		return
+//	}
+//	err = fields.JSONEncode(json.NewEncoder(w), users)
+//
+// The requested fields are intersected with the server's allowed fields, so requesting "profile" when only
+// "profile.bio" is allowed returns "profile.bio". Without the parameter, the allowed fields are returned.
+// A malformed parameter or a field that is not allowed returns an *APIError with ErrCodeInvalidFields (400).
+func SparseFields(req *http.Request, allowed []string) (*Fieldset, error) {
+	return sparseFields(req, fieldsParam, allowed)
+}
+
+// SparseFieldsFor is SparseFields() for a JSON:API style parameter of the resource type (IE: ?fields[users]=id,name)
+func SparseFieldsFor(req *http.Request, resourceType string, allowed []string) (*Fieldset, error) {
+	return sparseFields(req, fieldsParam+"["+resourceType+"]", allowed)
+}
+
+// JSONEncode is JSONEncode() with the fields of the fieldset
+func (f *Fieldset) JSONEncode(e *json.Encoder, objects interface{}) error {
+	return jsonEncode(e, objects, f.allowedSet(), nil)
+}
+
+// JSONEncodeVisible is JSONEncodeVisible() with the fields of the fieldset
+func (f *Fieldset) JSONEncodeVisible(e *json.Encoder, objects interface{}, roles []string) error {
+	return jsonEncode(e, objects, f.allowedSet(), newRoleSet(roles))
+}
+
+// allowedSet returns the compiled fields (a nil Fieldset allows no fields)
+func (f *Fieldset) allowedSet() *allowedSet {
+	if f == nil {
+		return newAllowedSet(nil)
+	}
+	return f.set
+}
+
+// sparseFields parses the fields of the query parameter and intersects them with the allowed fields
+func sparseFields(req *http.Request, param string, allowed []string) (*Fieldset, error) {
+	values := req.URL.Query()[param]
+	if len(values) == 0 {
+		return &Fieldset{Fields: allowed, set: newAllowedSet(allowed)}, nil
+	}
+
+	value := strings.Join(values, ",")
+	requested, ok := parseSparseFields(value)
+	if !ok {
+		return nil, invalidFieldsError(req, fmt.Errorf("%w: %s", ErrInvalidFieldsParam, value), value)
+	}
+
+	set := newAllowedSet(allowed)
+	fields := make([]string, 0, len(requested))
+	for _, path := range requested {
+		matched, found := set.intersect(strings.Split(path, "."))
+		if !found {
+			return nil, invalidFieldsError(req, fmt.Errorf("%w: %s", ErrUnknownField, path), path)
+		}
+		for _, field := range matched {
+			if !slices.Contains(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return &Fieldset{Fields: fields, set: newRequestAllowedSet(fields)}, nil
+}
+
+// parseSparseFields parses a list of fields with nested groups (IE: "id,profile(avatar,address(city))") into dotted paths
+func parseSparseFields(value string) ([]string, bool) {
+	var paths, prefix []string
+	start := 0
+	afterGroup := false // A group was just closed, so only a separator can follow
+	for i := 0; i <= len(value); i++ {
+		c := byte(',') // The end of the value closes the last field
+		if i < len(value) {
+			c = value[i]
+		}
+
+		switch c {
+		case ',', ')':
+			field := strings.TrimSpace(value[start:i])
+			if len(field) > 0 {
+				if afterGroup {
+					return nil, false
+				}
+				paths = append(paths, strings.Join(append(slices.Clone(prefix), field), "."))
+			} else if !afterGroup {
+				return nil, false // Empty field or group
+			}
+			afterGroup = false
+			if c == ')' {
+				if len(prefix) == 0 {
+					return nil, false
+				}
+				prefix = prefix[:len(prefix)-1]
+				afterGroup = true
+			}
+			start = i + 1
+		case '(':
+			field := strings.TrimSpace(value[start:i])
+			if len(field) == 0 || afterGroup {
+				return nil, false
+			}
+			prefix = append(prefix, field)
+			start = i + 1
+		}
+	}
+	return paths, len(prefix) == 0
+}
+
+// invalidFieldsError returns the error for an invalid fields parameter
+func invalidFieldsError(req *http.Request, err error, fields string) *APIError {
+	return NewAPIError(req, err, WithCode(ErrCodeInvalidFields), WithData(map[string]string{fieldsParam: fields}))
+}
+
+// intersect returns the allowed paths for the requested path, false if the path is not allowed
+func (s *allowedSet) intersect(path []string) ([]string, bool) {
+	node := s
+	for _, name := range path {
+		sub, ok := node.fields[name]
+		if !ok {
+			return nil, false
+		} else if sub == nil {
+			return []string{strings.Join(path, ".")}, true // The whole field is allowed (including any nested path)
+		}
+		node = sub
+	}
+
+	// Only some nested fields are allowed
+	return node.paths(strings.Join(path, ".")), true
+}
+
+// paths returns the dotted paths of the allowed fields (sorted), prefixed by the path of the set
+func (s *allowedSet) paths(prefix string) []string {
+	names := make([]string, 0, len(s.fields))
+	for name := range s.fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		path := prefix + "." + name
+		if sub := s.fields[name]; sub != nil {
+			paths = append(paths, sub.paths(path)...)
+		} else {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
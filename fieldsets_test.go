@@ -0,0 +1,151 @@
+package apirouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testFieldsAllowed is the server's allowlist for the sparse fieldset tests
+var testFieldsAllowed = []string{"id", "nickname", "profile.bio", "profile.address", "previous"}
+
+// fieldsRequest returns a request with the query
+func fieldsRequest(query string) *http.Request {
+	return httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/users?"+query, nil)
+}
+
+// TestSparseFields tests parsing and intersecting the fields parameter
+func TestSparseFields(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{"no parameter", "", testFieldsAllowed},
+		{"top level", "fields=id,nickname", []string{"id", "nickname"}},
+		{"nested group", "fields=id,profile(bio,address(city))", []string{"id", "profile.bio", "profile.address.city"}},
+		{"dotted path", "fields=profile.address.country", []string{"profile.address.country"}},
+		{"parent of allowed fields", "fields=profile", []string{"profile.address", "profile.bio"}},
+		{"whole field", "fields=previous(bio)", []string{"previous.bio"}},
+		{"spaces and duplicates", "fields=" + url.QueryEscape(" id , id,profile( bio )"), []string{"id", "profile.bio"}},
+		{"repeated parameter", "fields=id&fields=nickname", []string{"id", "nickname"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := SparseFields(fieldsRequest(tt.query), testFieldsAllowed)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, fields.Fields)
+		})
+	}
+
+	t.Run("json api style", func(t *testing.T) {
+		req := fieldsRequest(url.Values{"fields[users]": {"id,nickname"}, "fields[posts]": {"title"}}.Encode())
+		fields, err := SparseFieldsFor(req, "users", testFieldsAllowed)
+		require.NoError(t, err)
+		require.Equal(t, []string{"id", "nickname"}, fields.Fields)
+
+		fields, err = SparseFieldsFor(req, "comments", testFieldsAllowed)
+		require.NoError(t, err)
+		require.Equal(t, testFieldsAllowed, fields.Fields)
+	})
+
+	t.Run("encodes the requested fields", func(t *testing.T) {
+		fields, err := SparseFields(fieldsRequest("fields=id,profile(address(city))"), testFieldsAllowed)
+		require.NoError(t, err)
+
+		user := &testEncodeUser{
+			Password: "secret",
+			Profile:  &testEncodeProfile{Address: testEncodeAddress{City: "Rome", Country: "IT"}, Bio: "hello"},
+			UserID:   7,
+		}
+		var buf bytes.Buffer
+		require.NoError(t, fields.JSONEncode(json.NewEncoder(&buf), user))
+		require.Equal(t, `{"id":7,"profile":{"address":{"city":"Rome"}}}`+"\n", buf.String())
+
+		var hierarchy bytes.Buffer
+		require.NoError(t, JSONEncodeHierarchy(&hierarchy, user, fields))
+		require.Equal(t, buf.String(), hierarchy.String())
+
+		buf.Reset()
+		require.NoError(t, fields.JSONEncodeVisible(json.NewEncoder(&buf), user, nil))
+		require.Equal(t, `{"id":7,"profile":{"address":{"city":"Rome"}}}`+"\n", buf.String())
+
+		buf.Reset()
+		var missing *Fieldset
+		require.NoError(t, missing.JSONEncode(json.NewEncoder(&buf), user))
+		require.Equal(t, "{}\n", buf.String())
+	})
+
+	t.Run("requested fields are kept out of the server caches", func(t *testing.T) {
+		fields, err := SparseFields(fieldsRequest("fields=profile(bio),nickname,id"), testFieldsAllowed)
+		require.NoError(t, err)
+		require.True(t, fields.set.request)
+		require.True(t, fields.set.fields["profile"].request)
+		_, cached := allowedSetCache.get(allowedSetKey(fields.Fields))
+		require.False(t, cached)
+
+		// Any order of the same fields shares the set
+		reordered, err := SparseFields(fieldsRequest("fields=id,nickname,profile(bio),id"), testFieldsAllowed)
+		require.NoError(t, err)
+		require.Same(t, fields.set, reordered.set)
+
+		// The Fieldset carries its set, so it does not depend on what is in the request set cache
+		for i := range maxRequestCacheEntries {
+			requestSetCache.add(strconv.Itoa(i), &allowedSet{})
+		}
+		var buf bytes.Buffer
+		require.NoError(t, fields.JSONEncode(json.NewEncoder(&buf), &testEncodeUser{Nickname: "a", UserID: 7}))
+		key := jsonPlanKey{allowed: fields.set.id, mode: jsonEncodeMode, t: reflect.TypeFor[testEncodeUser]()}
+		_, cached = jsonPlanCache.get(key)
+		require.False(t, cached)
+		_, cached = requestPlanCache.get(key)
+		require.True(t, cached)
+		_, cached = allowedSetCache.get(allowedSetKey(fields.Fields))
+		require.False(t, cached)
+	})
+}
+
+// TestSparseFields_Invalid tests the errors for malformed and unknown fields
+func TestSparseFields_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, value := range []string{"id,", ",id", "profile()", "profile(bio", "profile)bio(", "profile(bio)id", "(bio)", "id,,nickname"} {
+		t.Run("malformed "+value, func(t *testing.T) {
+			_, err := SparseFields(fieldsRequest("fields="+url.QueryEscape(value)), testFieldsAllowed)
+			require.ErrorIs(t, err, ErrInvalidFieldsParam)
+
+			var apiErr *APIError
+			require.ErrorAs(t, err, &apiErr)
+			require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+			require.Equal(t, ErrCodeInvalidFields, apiErr.Code)
+		})
+	}
+
+	for _, value := range []string{"password", "profile(avatar)", "profile.address2", "Profile"} {
+		t.Run("unknown "+value, func(t *testing.T) {
+			_, err := SparseFields(fieldsRequest("fields="+url.QueryEscape(value)), testFieldsAllowed)
+			require.ErrorIs(t, err, ErrUnknownField)
+
+			var apiErr *APIError
+			require.ErrorAs(t, err, &apiErr)
+			require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+		})
+	}
+
+	t.Run("public message", func(t *testing.T) {
+		_, err := SparseFields(fieldsRequest("fields=id,password"), testFieldsAllowed)
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, "invalid fields requested: password", apiErr.PublicMessage)
+	})
+}
@@ -0,0 +1,103 @@
+package apirouter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// TypedHandler handles a request bound to Req and returns the response data, or an error
+// (an *APIError for its status code, any other error responds with 500)
+type TypedHandler[Req, Resp any] func(ctx context.Context, in Req) (Resp, error)
+
+// HandlerOption is a functional option for Handle()
+type HandlerOption func(o *handlerOptions)
+
+// handlerOptions are the options of a typed handler
+type handlerOptions struct {
+	negotiate     bool
+	successStatus int
+}
+
+// Handle converts the typed handler into an httprouter.Handle (use with Router.Request() and InternalStack.Wrap()):
+//
+//	router.HTTPRouter.POST("/users", router.Request(apirouter.Handle(createUser, apirouter.WithSuccessStatus(http.StatusCreated))))
+//
+// A struct (or pointer to a struct) Req is filled using Bind(), so invalid input responds with the field errors
+// before the handler is called. The response is written with RespondWith(), using 200 unless WithSuccessStatus() is set.
+func Handle[Req, Resp any](h TypedHandler[Req, Resp], opts ...HandlerOption) httprouter.Handle {
+	options := handlerOptions{successStatus: http.StatusOK}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	// Only structs are bound
+	reqType := reflect.TypeFor[Req]()
+	bindStruct := reqType.Kind() == reflect.Struct
+	bindPointer := reqType.Kind() == reflect.Pointer && reqType.Elem().Kind() == reflect.Struct
+
+	respond := RespondWith
+	if options.negotiate {
+		respond = RespondNegotiated
+	}
+
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		req = withRouteParams(req, ps)
+
+		var in Req
+		var err error
+		switch {
+		case bindStruct:
+			err = Bind(req, &in)
+		case bindPointer:
+			value := reflect.New(reqType.Elem())
+			err = Bind(req, value.Interface())
+			in = value.Interface().(Req)
+		}
+		if err != nil {
+			respondHandlerError(w, req, respond, err)
+			return
+		}
+
+		out, err := h(req.Context(), in)
+		if err != nil {
+			respondHandlerError(w, req, respond, err)
+			return
+		}
+		respond(w, req, options.successStatus, out)
+	}
+}
+
+// WithNegotiation writes the response with RespondNegotiated() (the client's preferred format) instead of JSON
+func WithNegotiation() HandlerOption {
+	return func(o *handlerOptions) {
+		o.negotiate = true
+	}
+}
+
+// WithSuccessStatus sets the status code of a successful response (IE: 201 or 204)
+func WithSuccessStatus(status int) HandlerOption {
+	return func(o *handlerOptions) {
+		o.successStatus = status
+	}
+}
+
+// respondHandlerError responds with an *APIError's status code, or 500 (without exposing the error) for any other error
+func respondHandlerError(w http.ResponseWriter, req *http.Request, respond func(http.ResponseWriter, *http.Request, int, interface{}), err error) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = NewAPIError(req, err)
+	} else if apiErr == nil {
+		// A typed nil *APIError, so its Error() can't be called
+		apiErr = NewAPIError(req, errors.New(http.StatusText(http.StatusInternalServerError)))
+	}
+
+	status := apiErr.StatusCode
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	respond(w, req, status, apiErr)
+}
@@ -0,0 +1,134 @@
+package apirouter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+// errTestHandler is an unexpected error returned by a handler
+var errTestHandler = errors.New("database is down")
+
+// testCreateUser is the input of the typed handler tests
+type testCreateUser struct {
+	Email string `json:"email" validate:"required,email"`
+	OrgID uint64 `path:"org_id"`
+}
+
+// testUser is the output of the typed handler tests
+type testUser struct {
+	Email string `json:"email"`
+	OrgID uint64 `json:"org_id"`
+}
+
+// serveTyped serves the request through the router and returns the response
+func serveTyped(t *testing.T, h httprouter.Handle, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	router := New()
+	stack := NewStack()
+	stack.Use(func(next httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+			w.Header().Set("X-Middleware", "yes")
+			next(w, req, ps)
+		}
+	})
+	router.HTTPRouter.POST("/orgs/:org_id/users", router.RequestNoLogging(stack.Wrap(h)))
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/orgs/3/users", strings.NewReader(body))
+	req.Header.Set(contentTypeHeader, "application/json")
+	w := httptest.NewRecorder()
+	router.HTTPRouter.ServeHTTP(w, req)
+	require.Equal(t, "yes", w.Header().Get("X-Middleware"))
+	return w
+}
+
+// TestHandle tests the typed handler adapter
+func TestHandle(t *testing.T) {
+	t.Parallel()
+
+	createUser := func(_ context.Context, in testCreateUser) (*testUser, error) {
+		switch in.Email {
+		case "taken@example.com":
+			return nil, &APIError{Code: ErrCodeUnknown, PublicMessage: "email is taken", StatusCode: http.StatusConflict}
+		case "down@example.com":
+			return nil, errTestHandler
+		}
+		return &testUser{Email: in.Email, OrgID: in.OrgID}, nil
+	}
+
+	t.Run("success with a custom status", func(t *testing.T) {
+		w := serveTyped(t, Handle(createUser, WithSuccessStatus(http.StatusCreated)), `{"email":"a@example.com"}`)
+		require.Equal(t, http.StatusCreated, w.Code)
+		require.JSONEq(t, `{"email":"a@example.com","org_id":3}`, w.Body.String())
+	})
+
+	t.Run("default status", func(t *testing.T) {
+		w := serveTyped(t, Handle(createUser), `{"email":"a@example.com"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		w := serveTyped(t, Handle(createUser), `{"email":"nope"}`)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		require.Contains(t, w.Body.String(), `"field":"/email"`)
+	})
+
+	t.Run("api error", func(t *testing.T) {
+		w := serveTyped(t, Handle(createUser), `{"email":"taken@example.com"}`)
+		require.Equal(t, http.StatusConflict, w.Code)
+		require.JSONEq(t, `{"error":"email is taken"}`, w.Body.String())
+	})
+
+	t.Run("other errors are not exposed", func(t *testing.T) {
+		w := serveTyped(t, Handle(createUser), `{"email":"down@example.com"}`)
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		require.NotContains(t, w.Body.String(), errTestHandler.Error())
+	})
+
+	t.Run("typed nil api error", func(t *testing.T) {
+		h := Handle(func(_ context.Context, _ struct{}) (string, error) {
+			var apiErr *APIError
+			return "", apiErr
+		})
+		w := serveTyped(t, h, "{}")
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		require.JSONEq(t, `{"error":"`+http.StatusText(http.StatusInternalServerError)+`"}`, w.Body.String())
+	})
+
+	t.Run("pointer input", func(t *testing.T) {
+		h := Handle(func(_ context.Context, in *testCreateUser) (testUser, error) {
+			return testUser{Email: in.Email, OrgID: in.OrgID}, nil
+		})
+		w := serveTyped(t, h, `{"email":"p@example.com"}`)
+		require.JSONEq(t, `{"email":"p@example.com","org_id":3}`, w.Body.String())
+	})
+
+	t.Run("no input and no content", func(t *testing.T) {
+		h := Handle(func(_ context.Context, _ struct{}) (interface{}, error) {
+			return nil, nil
+		}, WithSuccessStatus(http.StatusNoContent))
+		w := serveTyped(t, h, "")
+		require.Equal(t, http.StatusNoContent, w.Code)
+		require.Empty(t, w.Body.String())
+	})
+
+	t.Run("negotiated response", func(t *testing.T) {
+		router := New()
+		router.HTTPRouter.POST("/orgs/:org_id/users", router.RequestNoLogging(Handle(createUser, WithNegotiation())))
+
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/orgs/3/users", strings.NewReader(`{"email":"x@example.com"}`))
+		req.Header.Set(contentTypeHeader, "application/json")
+		req.Header.Set(acceptHeader, "application/xml")
+		w := httptest.NewRecorder()
+		router.HTTPRouter.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Contains(t, w.Body.String(), "<Email>x@example.com</Email>")
+	})
+}
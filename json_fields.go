@@ -0,0 +1,208 @@
+package apirouter
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// jsonField is an exported struct field with its encoding/json name and options
+type jsonField struct {
+	index     []int
+	name      string
+	omitEmpty bool
+	quoted    bool     // The string option (a scalar encoded as a JSON string)
+	visible   []string // The roles of the visible tag (nil is visible to all, see JSONEncodeVisible)
+}
+
+// jsonFieldCandidate is a field that may be hidden by another field with the same name
+type jsonFieldCandidate struct {
+	jsonField
+	tagged bool
+}
+
+// jsonFieldKey identifies the cached fields of a struct type
+type jsonFieldKey struct {
+	snakeCase bool // Untagged fields use SnakeCase names
+	t         reflect.Type
+}
+
+// jsonFieldCache caches the fields of each struct type
+var jsonFieldCache sync.Map // map[jsonFieldKey][]jsonField
+
+// jsonFields returns the exported fields of the struct type using the encoding/json names (embedded fields are promoted)
+func jsonFields(t reflect.Type) []jsonField {
+	return cachedJSONFields(t, false)
+}
+
+// cachedJSONFields returns the exported fields of the struct type, where untagged fields use
+// their SnakeCase name if set (the keys of JSONEncode) instead of the field name.
+//
+// Embedded structs are walked breadth first and name collisions follow the rules of encoding/json:
+// the shallowest field wins, then a tagged field, and the name is dropped if it is still ambiguous.
+func cachedJSONFields(t reflect.Type, snakeCase bool) []jsonField {
+	key := jsonFieldKey{snakeCase: snakeCase, t: t}
+	if cached, ok := jsonFieldCache.Load(key); ok {
+		return cached.([]jsonField)
+	}
+
+	type embedded struct {
+		index []int
+		t     reflect.Type
+	}
+	var candidates []jsonFieldCandidate
+	var current []embedded
+	next := []embedded{{t: t}}
+	count, nextCount := map[reflect.Type]int{}, map[reflect.Type]int{}
+	visited := map[reflect.Type]bool{}
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		count, nextCount = nextCount, map[reflect.Type]int{}
+
+		for _, parent := range current {
+			if visited[parent.t] {
+				continue // A shallower embedding of the type wins
+			}
+			visited[parent.t] = true
+
+			for i := 0; i < parent.t.NumField(); i++ {
+				field := parent.t.Field(i)
+				fieldType := field.Type
+				if fieldType.Kind() == reflect.Pointer && len(fieldType.Name()) == 0 {
+					fieldType = fieldType.Elem()
+				}
+				if field.Anonymous {
+					if !field.IsExported() && fieldType.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !field.IsExported() {
+					continue
+				}
+
+				tag := field.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, options, _ := strings.Cut(tag, ",")
+				if !isValidJSONTag(name) {
+					name = ""
+				}
+				index := append(slices.Clone(parent.index), i)
+
+				// An untagged embedded struct promotes its fields
+				if len(name) == 0 && field.Anonymous && fieldType.Kind() == reflect.Struct {
+					if nextCount[fieldType]++; nextCount[fieldType] == 1 {
+						next = append(next, embedded{index: index, t: fieldType})
+					}
+					continue
+				}
+
+				candidate := jsonFieldCandidate{tagged: len(name) > 0}
+				if !candidate.tagged {
+					name = field.Name
+					if snakeCase {
+						name = SnakeCase(field.Name)
+					}
+				}
+				optionList := strings.Split(options, ",")
+				candidate.jsonField = jsonField{
+					index:     index,
+					name:      name,
+					omitEmpty: slices.Contains(optionList, "omitempty"),
+					quoted:    slices.Contains(optionList, "string") && isQuotableType(field.Type),
+					visible:   visibleRoles(field.Tag),
+				}
+				candidates = append(candidates, candidate)
+				if count[parent.t] > 1 {
+					// The type is embedded more than once at this depth, so its fields are ambiguous
+					candidates = append(candidates, candidate)
+				}
+			}
+		}
+	}
+
+	fields := dominantJSONFields(candidates)
+	jsonFieldCache.Store(key, fields)
+	return fields
+}
+
+// dominantJSONFields returns the field that wins each name (in field order)
+func dominantJSONFields(candidates []jsonFieldCandidate) []jsonField {
+	slices.SortStableFunc(candidates, func(a, b jsonFieldCandidate) int {
+		if c := strings.Compare(a.name, b.name); c != 0 {
+			return c
+		} else if c = len(a.index) - len(b.index); c != 0 {
+			return c
+		} else if a.tagged != b.tagged {
+			if a.tagged {
+				return -1
+			}
+			return 1
+		}
+		return slices.Compare(a.index, b.index)
+	})
+
+	fields := make([]jsonField, 0, len(candidates))
+	for i := 0; i < len(candidates); {
+		first := candidates[i]
+		j := i + 1
+		for j < len(candidates) && candidates[j].name == first.name {
+			j++
+		}
+		if j-i == 1 || len(candidates[i+1].index) > len(first.index) || candidates[i+1].tagged != first.tagged {
+			fields = append(fields, first.jsonField)
+		}
+		i = j
+	}
+
+	slices.SortFunc(fields, func(a, b jsonField) int { return slices.Compare(a.index, b.index) })
+	return fields
+}
+
+// isValidJSONTag checks if the tag name is used by encoding/json (other names fall back to the field name)
+func isValidJSONTag(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for _, c := range name {
+		if !strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", c) && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isQuotableType checks if the string option applies to the type (a bool, number or string, or a pointer to one)
+func isQuotableType(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer && len(t.Name()) == 0 {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.String:
+		return true
+	default:
+		return false
+	}
+}
+
+// isEmptyValue checks if the value is empty for the omitempty option (the same as encoding/json)
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	default:
+		return false
+	}
+}
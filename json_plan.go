@@ -0,0 +1,660 @@
+package apirouter
+
+import (
+	"bytes"
+	"container/list"
+	"encoding"
+	"encoding/json"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxJSONCacheEntries limits each cache of the server's allowed sets, plans, role sets and visible fields
+const maxJSONCacheEntries = 4096
+
+// maxRequestCacheEntries limits the cached allowed sets and plans built from request input (IE: SparseFields)
+const maxRequestCacheEntries = 256
+
+// maxJSONDepth is the pointer depth that is treated as a cycle (the same as encoding/json)
+const maxJSONDepth = 1000
+
+// jsonHex is for escaping control characters in strings
+const jsonHex = "0123456789abcdef"
+
+// jsonMode is the output of the filtered structs (structs with allowed fields or roles), values allowed whole
+// are always written the same as encoding/json
+type jsonMode uint8
+
+// Output modes of the filtered structs
+const (
+	jsonSorted     jsonMode = 1 << iota // The fields are sorted by name (the output of JSONEncode)
+	jsonSnakeCase                       // Untagged fields use their SnakeCase name (the keys of JSONEncode)
+	jsonEncodeMode = jsonSorted | jsonSnakeCase
+)
+
+// Caches of the compiled allowed sets and plans (each evicts its least recently used entries), and the encoding helpers
+var (
+	allowedSetCache   = newJSONLRU(maxJSONCacheEntries) // string -> *allowedSet
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	jsonPlanCache     = newJSONLRU(maxJSONCacheEntries) // jsonPlanKey -> []jsonPlanField
+	jsonBufferPool    = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	jsonInvalidUTF8   = invalidUTF8Replacement()
+	requestPlanCache  = newJSONLRU(maxRequestCacheEntries) // jsonPlanKey -> []jsonPlanField
+	requestSetCache   = newJSONLRU(maxRequestCacheEntries) // string -> *allowedSet
+)
+
+// allowedSet is a compiled set of allowed fields, where a nil *allowedSet allows the whole value
+type allowedSet struct {
+	fields  map[string]*allowedSet // A nil set allows the whole field
+	encode  bool                   // A []string of JSONEncodeHierarchy, so the value is written the same as JSONEncode
+	id      string                 // The canonical form of the set, used to cache the plans
+	request bool                   // Built from request input (its plans are kept in the bounded request caches)
+}
+
+// jsonLRU is a bounded least recently used cache of the compiled sets and plans
+type jsonLRU struct {
+	capacity int
+	entries  map[interface{}]*list.Element
+	mu       sync.Mutex
+	recent   *list.List
+}
+
+// jsonLRUEntry is an entry of a jsonLRU
+type jsonLRUEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+// jsonPlanKey identifies a cached plan
+type jsonPlanKey struct {
+	allowed string // The id of the allowed set
+	all     bool   // All the fields are allowed (a nil set)
+	mode    jsonMode
+	roles   string // The id of the caller's roles (empty when the visible tags are not used)
+	t       reflect.Type
+}
+
+// jsonPlanField is a struct field in a compiled plan
+type jsonPlanField struct {
+	allowed   *allowedSet // The allowed fields of the value (nil writes the whole value)
+	index     []int
+	key       string // The encoded name and colon
+	name      string
+	omitEmpty bool
+	quoted    bool
+}
+
+// jsonWriter writes values as JSON using the cached plans (the same output as encoding/json)
+type jsonWriter struct {
+	buf   *bytes.Buffer
+	depth int
+	mode  jsonMode
+	roles *roleSet // Only the fields visible to the roles are written (nil ignores the visible tags)
+}
+
+// newAllowedSet compiles the allowed fields of JSONEncode (IE: "id" and "profile.address.city"), a whole field wins over its paths
+func newAllowedSet(allowed []string) *allowedSet {
+	cacheKey := allowedSetKey(allowed)
+	if cached, ok := allowedSetCache.get(cacheKey); ok {
+		return cached.(*allowedSet)
+	}
+
+	set := compileAllowedSet(allowed)
+	allowedSetCache.add(cacheKey, set)
+	return set
+}
+
+// newRequestAllowedSet compiles allowed fields chosen by the client (see Fieldset), the set and its plans are
+// cached in the request caches, so they never evict the server's sets and plans
+func newRequestAllowedSet(allowed []string) *allowedSet {
+	cacheKey := allowedSetKey(allowed)
+	if cached, ok := allowedSetCache.get(cacheKey); ok {
+		return cached.(*allowedSet) // The same fields as a set of the server
+	} else if cached, ok = requestSetCache.get(cacheKey); ok {
+		return cached.(*allowedSet)
+	}
+
+	set := compileAllowedSet(allowed)
+	set.markRequest()
+	requestSetCache.add(cacheKey, set)
+	return set
+}
+
+// allowedSetKey returns the cache key of the allowed fields (sorted and without duplicates, so any order shares a set)
+func allowedSetKey(allowed []string) string {
+	for i := 1; i < len(allowed); i++ {
+		if allowed[i-1] >= allowed[i] { // Not sorted, or a duplicate
+			allowed = slices.Compact(slices.Sorted(slices.Values(allowed)))
+			break
+		}
+	}
+	return strings.Join(allowed, "\x00")
+}
+
+// compileAllowedSet compiles the allowed fields into a set
+func compileAllowedSet(allowed []string) *allowedSet {
+	set := &allowedSet{fields: make(map[string]*allowedSet, len(allowed))}
+	for _, path := range allowed {
+		set.add(strings.Split(path, "."))
+	}
+	set.setID()
+	return set
+}
+
+// toAllowedSet compiles the allowed fields of JSONEncodeHierarchy (a []string, *Fieldset or AllowedKeys, nil allows the whole value)
+func toAllowedSet(allowed interface{}) (*allowedSet, error) {
+	var keys map[string]interface{}
+	switch value := allowed.(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		set := *newAllowedSet(value) // A copy, the cached set is shared
+		set.encode = true
+		return &set, nil
+	case *Fieldset:
+		set := *value.allowedSet()
+		set.encode = true
+		return &set, nil
+	case AllowedKeys:
+		keys = value
+	case map[string]interface{}:
+		keys = value
+	default:
+		return nil, ErrInvalidAllowedFields
+	}
+	if keys == nil {
+		return nil, nil
+	}
+
+	set := &allowedSet{fields: make(map[string]*allowedSet, len(keys))}
+	for name, value := range keys {
+		sub, err := toAllowedSet(value)
+		if err != nil {
+			return nil, err
+		}
+		set.fields[name] = sub
+	}
+	set.setID()
+	return set, nil
+}
+
+// add allows the path
+func (s *allowedSet) add(path []string) {
+	sub, exists := s.fields[path[0]]
+	if len(path) == 1 {
+		s.fields[path[0]] = nil
+		return
+	} else if exists && sub == nil {
+		return
+	}
+
+	if sub == nil {
+		sub = &allowedSet{fields: make(map[string]*allowedSet)}
+		s.fields[path[0]] = sub
+	}
+	sub.add(path[1:])
+}
+
+// markRequest marks the set and its subsets as built from request input
+func (s *allowedSet) markRequest() {
+	s.request = true
+	for _, sub := range s.fields {
+		if sub != nil {
+			sub.markRequest()
+		}
+	}
+}
+
+// setID sets the canonical form of the set and its subsets
+func (s *allowedSet) setID() {
+	names := make([]string, 0, len(s.fields))
+	for name := range s.fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var id strings.Builder
+	for _, name := range names {
+		id.WriteString(name)
+		if sub := s.fields[name]; sub != nil {
+			if len(sub.id) == 0 && len(sub.fields) > 0 {
+				sub.setID()
+			}
+			id.WriteByte('\x01')
+			id.WriteString(sub.id)
+			id.WriteByte('\x02')
+		}
+		id.WriteByte('\x00')
+	}
+	s.id = id.String()
+}
+
+// writeAllowedJSON writes the allowed fields of the value as JSON (without a trailing newline)
+func writeAllowedJSON(buf *bytes.Buffer, v interface{}, set *allowedSet, mode jsonMode, roles *roleSet) error {
+	w := jsonWriter{buf: buf, mode: mode, roles: roles}
+	return w.write(reflect.ValueOf(v), set)
+}
+
+// write writes the allowed fields of the value
+func (w *jsonWriter) write(val reflect.Value, set *allowedSet) error {
+	if set != nil && set.encode && w.mode != jsonEncodeMode {
+		mode := w.mode
+		w.mode = jsonEncodeMode
+		err := w.write(val, set)
+		w.mode = mode
+		return err
+	}
+	if !val.IsValid() {
+		w.buf.WriteString("null")
+		return nil
+	} else if hasCustomJSON(val) {
+		return w.writeMarshaled(val)
+	}
+
+	switch val.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if val.IsNil() {
+			w.buf.WriteString("null")
+			return nil
+		}
+		if w.depth++; w.depth > maxJSONDepth {
+			return &json.UnsupportedValueError{Value: val, Str: "encountered a cycle via " + val.Type().String()}
+		}
+		err := w.write(val.Elem(), set)
+		w.depth--
+		return err
+	case reflect.Struct:
+		return w.writeStruct(val, set)
+	case reflect.Map:
+		return w.writeMap(val, set)
+	case reflect.Slice:
+		if val.IsNil() {
+			w.buf.WriteString("null")
+			return nil
+		} else if val.Type().Elem().Kind() == reflect.Uint8 {
+			return w.writeMarshaled(val) // Bytes are base64 encoded
+		}
+		return w.writeArray(val, set)
+	case reflect.Array:
+		return w.writeArray(val, set)
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.String:
+		return w.writeScalar(val)
+	default:
+		return w.writeMarshaled(val) // encoding/json returns the error for unsupported types
+	}
+}
+
+// writeStruct writes the allowed fields of a struct using its cached plan
+func (w *jsonWriter) writeStruct(val reflect.Value, set *allowedSet) error {
+	w.buf.WriteByte('{')
+	first := true
+	for _, field := range cachedJSONPlan(val.Type(), set, w.mode, w.roles) {
+		value, err := val.FieldByIndexErr(field.index)
+		if err != nil {
+			continue // Nil embedded pointer
+		}
+		if field.omitEmpty && isEmptyValue(value) {
+			continue
+		}
+
+		if !first {
+			w.buf.WriteByte(',')
+		}
+		first = false
+		w.buf.WriteString(field.key)
+		if field.quoted {
+			err = w.writeQuoted(value)
+		} else {
+			err = w.write(value, field.allowed)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	w.buf.WriteByte('}')
+	return nil
+}
+
+// writeMap writes the allowed entries of a map (sorted by key, like encoding/json)
+func (w *jsonWriter) writeMap(val reflect.Value, set *allowedSet) error {
+	if val.IsNil() {
+		w.buf.WriteString("null")
+		return nil
+	}
+
+	type entry struct {
+		key   string
+		value reflect.Value
+	}
+	entries := make([]entry, 0, val.Len())
+	iter := val.MapRange()
+	for iter.Next() {
+		key, err := jsonMapKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		if set == nil {
+			entries = append(entries, entry{key: key, value: iter.Value()})
+		} else if _, ok := set.fields[key]; ok {
+			entries = append(entries, entry{key: key, value: iter.Value()})
+		}
+	}
+	slices.SortFunc(entries, func(a, b entry) int { return strings.Compare(a.key, b.key) })
+
+	w.buf.WriteByte('{')
+	for i, e := range entries {
+		if i > 0 {
+			w.buf.WriteByte(',')
+		}
+		w.buf.Write(appendJSONString(w.buf.AvailableBuffer(), e.key))
+		w.buf.WriteByte(':')
+
+		var sub *allowedSet
+		if set != nil {
+			sub = set.fields[e.key]
+		}
+		if err := w.write(e.value, sub); err != nil {
+			return err
+		}
+	}
+	w.buf.WriteByte('}')
+	return nil
+}
+
+// writeArray writes the allowed fields of each element
+func (w *jsonWriter) writeArray(val reflect.Value, set *allowedSet) error {
+	w.buf.WriteByte('[')
+	for i := 0; i < val.Len(); i++ {
+		if i > 0 {
+			w.buf.WriteByte(',')
+		}
+		if err := w.write(val.Index(i), set); err != nil {
+			return err
+		}
+	}
+	w.buf.WriteByte(']')
+	return nil
+}
+
+// writeScalar writes a bool, number or string
+func (w *jsonWriter) writeScalar(val reflect.Value) error {
+	b := w.buf.AvailableBuffer()
+	switch val.Kind() {
+	case reflect.Bool:
+		b = strconv.AppendBool(b, val.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b = strconv.AppendInt(b, val.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b = strconv.AppendUint(b, val.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		bits := val.Type().Bits()
+		f := val.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return &json.UnsupportedValueError{Value: val, Str: strconv.FormatFloat(f, 'g', -1, bits)}
+		}
+		b = appendJSONFloat(b, f, bits)
+	default:
+		b = appendJSONString(b, val.String())
+	}
+	w.buf.Write(b)
+	return nil
+}
+
+// writeQuoted writes a scalar as a JSON string for the string option (IE: 42 becomes "42")
+func (w *jsonWriter) writeQuoted(val reflect.Value) error {
+	if hasCustomJSON(val) {
+		return w.writeMarshaled(val) // The option does not apply to custom encodings
+	}
+	if val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			w.buf.WriteString("null")
+			return nil
+		}
+		val = val.Elem()
+	}
+
+	if val.Kind() == reflect.String {
+		w.buf.Write(appendJSONString(w.buf.AvailableBuffer(), string(appendJSONString(nil, val.String()))))
+		return nil
+	}
+	w.buf.WriteByte('"')
+	if err := w.writeScalar(val); err != nil {
+		return err
+	}
+	w.buf.WriteByte('"')
+	return nil
+}
+
+// writeMarshaled writes the whole value with encoding/json (using the pointer methods of addressable values)
+func (w *jsonWriter) writeMarshaled(val reflect.Value) error {
+	if val.Kind() != reflect.Pointer && val.CanAddr() {
+		val = val.Addr()
+	}
+
+	encoded, err := json.Marshal(val.Interface())
+	if err != nil {
+		return err
+	}
+	w.buf.Write(encoded)
+	return nil
+}
+
+// cachedJSONPlan returns the compiled plan of the struct type for the allowed set and roles
+func cachedJSONPlan(t reflect.Type, set *allowedSet, mode jsonMode, roles *roleSet) []jsonPlanField {
+	key := jsonPlanKey{all: set == nil, t: t}
+	if set != nil {
+		key.allowed = set.id
+		key.mode = mode
+	}
+	if roles != nil {
+		key.roles = roles.id
+		key.mode |= mode & jsonSnakeCase
+	}
+	if set != nil && set.request {
+		if cached, ok := requestPlanCache.get(key); ok {
+			return cached.([]jsonPlanField)
+		}
+	} else if cached, ok := jsonPlanCache.get(key); ok {
+		return cached.([]jsonPlanField)
+	}
+
+	fields := cachedJSONFields(t, key.mode&jsonSnakeCase != 0)
+	plan := make([]jsonPlanField, 0, len(fields))
+	for _, field := range fields {
+		if !roles.canSee(field) {
+			continue
+		}
+		var allowed *allowedSet
+		if set != nil {
+			sub, ok := set.fields[field.name]
+			if !ok {
+				continue
+			}
+			allowed = sub
+		}
+		plan = append(plan, jsonPlanField{
+			allowed:   allowed,
+			index:     field.index,
+			key:       string(appendJSONString(nil, field.name)) + ":",
+			name:      field.name,
+			omitEmpty: field.omitEmpty,
+			quoted:    field.quoted,
+		})
+	}
+	if key.mode&jsonSorted != 0 {
+		slices.SortFunc(plan, func(a, b jsonPlanField) int { return strings.Compare(a.name, b.name) })
+	}
+
+	if set != nil && set.request {
+		requestPlanCache.add(key, plan)
+	} else {
+		jsonPlanCache.add(key, plan)
+	}
+	return plan
+}
+
+// newJSONLRU creates a jsonLRU holding up to the capacity entries
+func newJSONLRU(capacity int) *jsonLRU {
+	return &jsonLRU{capacity: capacity, entries: make(map[interface{}]*list.Element), recent: list.New()}
+}
+
+// get returns the value of the key, marking it as recently used
+func (c *jsonLRU) get(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.recent.MoveToFront(element)
+	return element.Value.(*jsonLRUEntry).value, true
+}
+
+// add stores the value under the key, evicting the least recently used value if full
+func (c *jsonLRU) add(key, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*jsonLRUEntry).value = value
+		c.recent.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.recent.PushFront(&jsonLRUEntry{key: key, value: value})
+	for c.recent.Len() > c.capacity {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*jsonLRUEntry).key)
+	}
+}
+
+// len returns the number of cached values
+func (c *jsonLRU) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.recent.Len()
+}
+
+// jsonMapKey returns the name of a map key (the same as encoding/json)
+func jsonMapKey(key reflect.Value) (string, error) {
+	switch {
+	case key.Kind() == reflect.String:
+		return key.String(), nil
+	case key.Type().Implements(textMarshalerType):
+		if key.Kind() == reflect.Pointer && key.IsNil() {
+			return "", nil
+		}
+		text, err := key.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	case key.CanInt():
+		return strconv.FormatInt(key.Int(), 10), nil
+	case key.CanUint():
+		return strconv.FormatUint(key.Uint(), 10), nil
+	default:
+		return "", &json.UnsupportedTypeError{Type: key.Type()}
+	}
+}
+
+// hasCustomJSON checks if the value has its own encoding (json.Marshaler or encoding.TextMarshaler)
+func hasCustomJSON(val reflect.Value) bool {
+	t := val.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return true
+	}
+	if val.Kind() != reflect.Pointer && val.CanAddr() {
+		t = reflect.PointerTo(t)
+		return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType)
+	}
+	return false
+}
+
+// invalidUTF8Replacement returns how encoding/json writes invalid UTF-8 (an escaped or raw U+FFFD, depending on the Go version)
+func invalidUTF8Replacement() string {
+	encoded, err := json.Marshal("\xff")
+	if err != nil || len(encoded) < 2 {
+		return `\ufffd`
+	}
+	return string(encoded[1 : len(encoded)-1])
+}
+
+// appendJSONFloat appends a float the same as encoding/json (exponents for very small and large values)
+func appendJSONFloat(b []byte, f float64, bits int) []byte {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	b = strconv.AppendFloat(b, f, format, -1, bits)
+	if format == 'e' {
+		// Clean up e-09 to e-9
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
+
+// appendJSONString appends a quoted string the same as encoding/json (escaping HTML characters, invalid UTF-8, U+2028 and U+2029)
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\b':
+				b = append(b, '\\', 'b')
+			case '\f':
+				b = append(b, '\\', 'f')
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', jsonHex[c>>4], jsonHex[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, jsonInvalidUTF8...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', jsonHex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
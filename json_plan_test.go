@@ -0,0 +1,441 @@
+package apirouter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testPlanEmbedded is embedded in testPlanValues
+type testPlanEmbedded struct {
+	Embedded string `json:"embedded"`
+	Hidden   string `json:"values"` // Loses to the shallower field
+}
+
+// testPlanValues has a field of each kind for comparing the output with encoding/json
+type testPlanValues struct {
+	*testPlanEmbedded
+
+	Any      interface{}            `json:"any"`
+	Array    [3]byte                `json:"array"`
+	Bytes    []byte                 `json:"bytes"`
+	Count    *uint16                `json:"count,string"`
+	Created  time.Time              `json:"created"`
+	Float32  float32                `json:"float32"`
+	Floats   []float64              `json:"floats"`
+	IntKeys  map[int]string         `json:"int_keys"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Name     string                 `json:"name,string"`
+	Next     *testPlanValues        `json:"next"`
+	Raw      json.RawMessage        `json:"raw"`
+	Skip     string                 `json:"-"`
+	Untagged bool                   // Untagged fields use the field name
+	Values   map[string]string      `json:"values"`
+}
+
+// newTestPlanValues returns values for the plan tests
+func newTestPlanValues() *testPlanValues {
+	count := uint16(7)
+	return &testPlanValues{
+		testPlanEmbedded: &testPlanEmbedded{Embedded: "yes", Hidden: "no"},
+		Any:              []interface{}{1, "two", nil, map[string]int{"b": 2, "a": 1}},
+		Array:            [3]byte{1, 2, 3},
+		Bytes:            []byte("bytes"),
+		Count:            &count,
+		Created:          time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC),
+		Float32:          3.14,
+		Floats:           []float64{0, -0.5, 1e-7, 1e21, 123456789, 1.5e300},
+		IntKeys:          map[int]string{10: "ten", 2: "two", -1: "minus"},
+		Name:             "<tag> & \"quotes\"",
+		Next:             &testPlanValues{Name: "next"},
+		Raw:              json.RawMessage(`{ "raw" : true }`),
+		Skip:             "skip",
+		Untagged:         true,
+		Values:           map[string]string{"line": "a\nb\tc \x01\b\f", "invalid": "\xff"},
+	}
+}
+
+// TestWriteAllowedJSON tests that the plans write the same output as encoding/json
+func TestWriteAllowedJSON(t *testing.T) {
+	t.Parallel()
+
+	t.Run("identical to encoding/json", func(t *testing.T) {
+		for _, v := range []interface{}{
+			newTestPlanValues(),
+			*newTestPlanValues(),
+			[]*testPlanValues{newTestPlanValues(), nil, {}},
+			map[string]*testPlanValues{"a": newTestPlanValues()},
+			"string", 42, -1.25, true, nil, []string(nil), map[string]int(nil),
+		} {
+			expected, err := json.Marshal(v)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			require.NoError(t, writeAllowedJSON(&buf, v, nil, 0, nil))
+			require.Equal(t, string(expected), buf.String())
+		}
+	})
+
+	t.Run("filtered structs are sorted for JSONEncode", func(t *testing.T) {
+		var buf bytes.Buffer
+		v := newTestPlanValues()
+		require.NoError(t, writeAllowedJSON(&buf, v, newAllowedSet([]string{"name", "embedded", "next.name", "count"}), jsonSorted, nil))
+		require.Equal(t, `{"count":"7","embedded":"yes","name":"\"\\u003ctag\\u003e \\u0026 \\\"quotes\\\"\"","next":{"name":"\"next\""}}`, buf.String())
+
+		buf.Reset()
+		require.NoError(t, writeAllowedJSON(&buf, v, newAllowedSet([]string{"name", "count"}), 0, nil))
+		require.Equal(t, `{"count":"7","name":"\"\\u003ctag\\u003e \\u0026 \\\"quotes\\\"\""}`, buf.String())
+	})
+
+	t.Run("unsupported values", func(t *testing.T) {
+		var buf bytes.Buffer
+		var unsupported *json.UnsupportedValueError
+		require.ErrorAs(t, writeAllowedJSON(&buf, math.NaN(), nil, 0, nil), &unsupported)
+		require.ErrorAs(t, writeAllowedJSON(&buf, map[string]float32{"a": float32(math.Inf(1))}, nil, 0, nil), &unsupported)
+
+		cycle := &testPlanValues{}
+		cycle.Next = cycle
+		require.ErrorAs(t, writeAllowedJSON(&buf, cycle, nil, 0, nil), &unsupported)
+
+		var unsupportedType *json.UnsupportedTypeError
+		require.ErrorAs(t, writeAllowedJSON(&buf, func() {}, nil, 0, nil), &unsupportedType)
+	})
+}
+
+// Embedded structs for the field name collision tests
+type (
+	testPlanName   struct{ Name string }
+	testPlanOther  struct{ Name string }
+	testPlanTagged struct {
+		Label string `json:"Name"`
+	}
+	testPlanDeep   struct{ testPlanName }
+	testPlanShadow struct {
+		Name string `json:"shadow"`
+	}
+	testPlanScalar int
+)
+
+// TestWriteAllowedJSON_Collisions tests that colliding names are resolved the same as encoding/json
+func TestWriteAllowedJSON_Collisions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"ambiguous names are dropped", struct {
+			testPlanName
+			testPlanOther
+			ID int
+		}{testPlanName{"a"}, testPlanOther{"b"}, 1}},
+		{"tagged name wins at the same depth", struct {
+			testPlanName
+			testPlanTagged
+		}{testPlanName{"a"}, testPlanTagged{"b"}}},
+		{"shallowest name wins", struct {
+			testPlanDeep
+			testPlanOther
+		}{testPlanDeep{testPlanName{"deep"}}, testPlanOther{"shallow"}}},
+		{"outer field wins", struct {
+			*testPlanName
+			Name string
+		}{&testPlanName{"inner"}, "outer"}},
+		{"both tagged are dropped", struct {
+			testPlanTagged
+			Other string `json:"Name"`
+		}{testPlanTagged{"a"}, "b"}},
+		{"tag names are not hidden by go names", struct {
+			testPlanShadow
+			Name string
+		}{testPlanShadow{"shadow"}, "name"}},
+		{"same type embedded twice", struct {
+			testPlanDeep
+			Other struct{ testPlanName }
+			testPlanName
+		}{testPlanDeep{testPlanName{"deep"}}, struct{ testPlanName }{testPlanName{"other"}}, testPlanName{"top"}}},
+		{"embedded scalars and nil pointers", struct {
+			testPlanScalar
+			*testPlanOther
+		}{7, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected, err := json.Marshal(tt.value)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			require.NoError(t, writeAllowedJSON(&buf, tt.value, nil, 0, nil))
+			require.Equal(t, string(expected), buf.String())
+
+			buf.Reset()
+			require.NoError(t, writeAllowedJSON(&buf, tt.value, newAllowedSet([]string{"ID", "Name", "Other", "shadow", "testPlanScalar"}), 0, nil))
+			require.Equal(t, string(expected), buf.String())
+		})
+	}
+}
+
+// TestNewAllowedSet tests compiling and caching the allowed fields
+func TestNewAllowedSet(t *testing.T) {
+	t.Parallel()
+
+	set := newAllowedSet([]string{"profile.address.city", "id", "profile.bio", "friends", "friends.id"})
+	require.Same(t, set, newAllowedSet([]string{"profile.address.city", "id", "profile.bio", "friends", "friends.id"}))
+	require.Same(t, set, newAllowedSet([]string{"id", "friends.id", "profile.bio", "friends", "id", "profile.address.city"}))
+	require.Nil(t, set.fields["friends"])
+	require.Nil(t, set.fields["id"])
+	require.Nil(t, set.fields["profile"].fields["address"].fields["city"])
+	require.Contains(t, set.fields["profile"].fields, "bio")
+
+	// The id does not depend on the order of the fields
+	other, err := toAllowedSet(AllowedKeys{
+		"friends": nil,
+		"id":      nil,
+		"profile": AllowedKeys{"bio": nil, "address": []string{"city"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, set.id, other.id)
+
+	plan := cachedJSONPlan(reflect.TypeFor[testEncodeUser](), set, jsonSorted, nil)
+	require.Equal(t, []string{"friends", "id", "profile"}, planNames(plan))
+	require.Equal(t, []string{"friends", "profile", "id"}, planNames(cachedJSONPlan(reflect.TypeFor[testEncodeUser](), other, 0, nil)))
+	require.Equal(t, &plan[0], &cachedJSONPlan(reflect.TypeFor[testEncodeUser](), other, jsonSorted, nil)[0])
+
+	_, err = toAllowedSet(AllowedKeys{"id": AllowedKeys{"bad": 1}})
+	require.ErrorIs(t, err, ErrInvalidAllowedFields)
+}
+
+// TestJSONLRU tests that the request cache evicts the least recently used values
+func TestJSONLRU(t *testing.T) {
+	t.Parallel()
+
+	cache := newJSONLRU(2)
+	cache.add("a", 1)
+	cache.add("b", 2)
+	value, ok := cache.get("a")
+	require.True(t, ok)
+	require.Equal(t, 1, value)
+
+	cache.add("c", 3)
+	require.Equal(t, 2, cache.len())
+	_, ok = cache.get("b")
+	require.False(t, ok)
+	_, ok = cache.get("a")
+	require.True(t, ok)
+
+	// The plans of new types are still cached when the plan cache is full
+	for i := range maxJSONCacheEntries {
+		jsonPlanCache.add(jsonPlanKey{allowed: strconv.Itoa(i), t: reflect.TypeFor[testEncodeUser]()}, []jsonPlanField{})
+	}
+	type newType struct{ ID int }
+	cachedJSONPlan(reflect.TypeFor[newType](), nil, 0, nil)
+	_, ok = jsonPlanCache.get(jsonPlanKey{all: true, t: reflect.TypeFor[newType]()})
+	require.True(t, ok)
+	require.Equal(t, maxJSONCacheEntries, jsonPlanCache.len())
+}
+
+// planNames returns the field names of a plan
+func planNames(plan []jsonPlanField) []string {
+	names := make([]string, 0, len(plan))
+	for _, field := range plan {
+		names = append(names, field.name)
+	}
+	return names
+}
+
+// FuzzAppendJSONString tests that strings are escaped the same as encoding/json
+func FuzzAppendJSONString(f *testing.F) {
+	for _, seed := range []string{"", "plain", "<script>&</script>", "\"\\\n\r\t\b\f\x00\x1f", "\u2028\u2029", "\xff\xfe", "emoji 🚀"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		expected, err := json.Marshal(s)
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(appendJSONString(nil, s)))
+	})
+}
+
+// benchmarkUsers returns a list response for the encoding benchmarks
+func benchmarkUsers() []*testEncodeUser {
+	users := make([]*testEncodeUser, 100)
+	for i := range users {
+		users[i] = &testEncodeUser{
+			Balance:  int64(i),
+			Nickname: "user",
+			Password: "secret",
+			Profile:  &testEncodeProfile{Address: testEncodeAddress{City: "Rome", Country: "IT"}, Bio: "hello"},
+			UserID:   uint64(i),
+		}
+	}
+	return users
+}
+
+// TestJSONEncode_Legacy tests that the benchmark baseline writes the same fields as JSONEncode
+func TestJSONEncode_Legacy(t *testing.T) {
+	t.Parallel()
+
+	var expected, actual bytes.Buffer
+	require.NoError(t, legacyJSONEncode(json.NewEncoder(&expected), benchmarkUsers(), []string{"user_id", "nickname", "profile"}))
+	require.NoError(t, JSONEncode(json.NewEncoder(&actual), benchmarkUsers(), []string{"id", "nickname", "profile"}))
+	require.JSONEq(t, strings.ReplaceAll(expected.String(), `"user_id"`, `"id"`), actual.String())
+}
+
+// BenchmarkJSONEncode benchmarks encoding a list with a cached plan
+func BenchmarkJSONEncode(b *testing.B) {
+	users := benchmarkUsers()
+	allowed := []string{"id", "nickname", "balance", "profile"}
+	e := json.NewEncoder(io.Discard)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = JSONEncode(e, users, allowed)
+	}
+}
+
+// BenchmarkJSONEncode_Legacy benchmarks the previous encoder, which built and filtered a map for every element
+func BenchmarkJSONEncode_Legacy(b *testing.B) {
+	users := benchmarkUsers()
+	allowed := []string{"user_id", "nickname", "balance", "profile"} // The previous encoder ignored the json tags
+	e := json.NewEncoder(io.Discard)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = legacyJSONEncode(e, users, allowed)
+	}
+}
+
+// BenchmarkJSONEncodeHierarchy benchmarks hierarchical filtering of a list
+func BenchmarkJSONEncodeHierarchy(b *testing.B) {
+	users := benchmarkUsers()
+	allowed := AllowedKeys{"id": nil, "nickname": nil, "profile": AllowedKeys{"address": []string{"city"}}}
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		_ = JSONEncodeHierarchy(&buf, users, allowed)
+	}
+}
+
+// legacyJSONEncode is the previous JSONEncode (filtering a map of each element), kept as the benchmark baseline
+func legacyJSONEncode(e *json.Encoder, objects interface{}, allowed []string) error {
+	var data []map[string]interface{}
+	isMulti := false
+	count := 0
+
+	if reflect.TypeOf(objects).Kind() == reflect.Slice {
+		count = reflect.ValueOf(objects).Len()
+		data = make([]map[string]interface{}, count)
+		isMulti = true
+	}
+
+	if isMulti {
+		if count == 0 {
+			return e.Encode(make([]interface{}, 0))
+		}
+
+		raw := reflect.ValueOf(objects)
+
+		obj := legacyJSONMap(raw.Index(0).Interface())
+		toRemove := make([]string, 0)
+
+		for k := range obj {
+			if FindString(k, allowed) == -1 {
+				toRemove = append(toRemove, k)
+			}
+		}
+
+		for _, k := range toRemove {
+			delete(obj, k)
+		}
+
+		if data != nil {
+			data[0] = obj
+		}
+
+		for i := 1; i < count; i++ {
+			obj = legacyJSONMap(raw.Index(i).Interface())
+
+			for _, k := range toRemove {
+				delete(obj, k)
+			}
+
+			if data != nil {
+				data[i] = obj
+			}
+		}
+
+		return e.Encode(data)
+	}
+
+	obj := legacyJSONMap(objects)
+	toRemove := make([]string, 0)
+
+	for k := range obj {
+		if FindString(k, allowed) == -1 {
+			toRemove = append(toRemove, k)
+		}
+	}
+
+	for _, k := range toRemove {
+		delete(obj, k)
+	}
+
+	return e.Encode(obj)
+}
+
+// legacyJSONMap converts an object to a map of string interfaces (the previous jsonMap)
+func legacyJSONMap(obj interface{}) map[string]interface{} {
+	fieldValues := make(map[string]interface{})
+
+	var s, stringPointer reflect.Value
+
+	// Dereference the obj if it is a pointer
+	if reflect.ValueOf(obj).Kind() == reflect.Pointer {
+		stringPointer = reflect.ValueOf(obj)
+		s = stringPointer.Elem()
+	} else {
+		s = reflect.ValueOf(obj)
+		// stringPointer = reflect.ValueOf(&obj)
+	}
+
+	typeOfT := s.Type()
+	for i := 0; i < typeOfT.NumField(); i++ {
+		structField := typeOfT.Field(i)
+		fieldName := structField.Name
+		if fieldName[0] != strings.ToUpper(string(fieldName[0]))[0] {
+			continue
+		}
+
+		// Exclude any field starting with an underscore
+		if strings.Index(fieldName, "_") == 0 {
+			continue
+		}
+		val := s.Field(i)
+		// Check for embedded types
+		if structField.Anonymous {
+			subFields := legacyJSONMap(val.Interface())
+			for k, v := range subFields {
+				fieldValues[k] = v
+			}
+			continue
+		}
+		key := SnakeCase(fieldName)
+		comps := strings.Split(key, ",")
+		key = comps[0]
+		fieldType := structField.Type
+		if fieldType.Kind() != reflect.Pointer && val.CanAddr() {
+			// fieldType = reflect.PointerTo(fieldType)
+			val = val.Addr()
+		}
+		fieldValues[key] = val.Interface()
+	}
+
+	return fieldValues
+}
@@ -0,0 +1,194 @@
+package apirouter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Localization headers and defaults
+const (
+	acceptLanguageHeader  string = "Accept-Language"
+	contentLanguageHeader string = "Content-Language"
+	defaultLanguage       string = "en"
+	languageWildcard      string = "*"
+)
+
+// languageRange is a single language range from the Accept-Language header
+type languageRange struct {
+	q   float64
+	tag string
+}
+
+// RegisterErrorMessages adds the localized public messages (by error code) for the locale to the DefaultErrorCatalog
+func RegisterErrorMessages(locale string, messages map[int]string) {
+	DefaultErrorCatalog.RegisterMessages(locale, messages)
+}
+
+// RegisterMessages adds the localized public messages by error code for the locale (IE: pt-BR), replacing any existing messages.
+// Messages are templates: {name} is replaced with the "name" key (or json field) of the error's Data.
+func (c *ErrorCatalog) RegisterMessages(locale string, messages map[int]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for code, message := range messages {
+		if c.messages[code] == nil {
+			c.messages[code] = make(map[string]string)
+		}
+		c.messages[code][locale] = message
+	}
+}
+
+// Message returns the public message for the code in the best locale of the Accept-Language header,
+// falling back to the definition's public message in the DefaultLanguage. The data is interpolated into the message.
+func (c *ErrorCatalog) Message(code int, acceptLanguage string, data interface{}) (message, locale string, ok bool) {
+	c.mu.RLock()
+	templates := make(map[string]string, len(c.messages[code])+1)
+	if definition, registered := c.definitions[code]; registered && len(definition.PublicMessage) > 0 {
+		templates[c.DefaultLanguage] = definition.PublicMessage
+	}
+	for messageLocale, template := range c.messages[code] {
+		templates[messageLocale] = template
+	}
+	c.mu.RUnlock()
+
+	locales := make([]string, 0, len(templates))
+	for messageLocale := range templates {
+		locales = append(locales, messageLocale)
+	}
+	slices.Sort(locales)
+
+	locale = matchLanguage(acceptLanguage, locales)
+	if len(locale) == 0 {
+		locale = c.DefaultLanguage
+	}
+	template, ok := templates[locale]
+	if !ok {
+		return "", "", false
+	}
+	return interpolateMessage(template, data), locale, true
+}
+
+// matchLanguage returns the available locale that best matches the Accept-Language header (empty for the default).
+// Ranges are tried in order of preference: an exact match, a more specific locale (pt matches pt-BR), then a less specific one (pt-BR matches pt).
+func matchLanguage(acceptLanguage string, locales []string) string {
+	ranges := make([]languageRange, 0, strings.Count(acceptLanguage, ",")+1)
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, q := parseQualityValue(part)
+		if len(tag) > 0 && q > 0 {
+			ranges = append(ranges, languageRange{q: q, tag: strings.ToLower(tag)})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, r := range ranges {
+		if r.tag == languageWildcard {
+			return ""
+		}
+		for _, locale := range locales {
+			if strings.EqualFold(locale, r.tag) {
+				return locale
+			}
+		}
+		for _, locale := range locales {
+			if strings.HasPrefix(strings.ToLower(locale), r.tag+"-") {
+				return locale
+			}
+		}
+		for tag := r.tag; strings.Contains(tag, "-"); {
+			tag = tag[:strings.LastIndex(tag, "-")]
+			for _, locale := range locales {
+				if strings.EqualFold(locale, tag) {
+					return locale
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// interpolateMessage replaces the {name} placeholders with the values of the data (a map or a struct using the json names).
+// Unknown placeholders are left as they are.
+func interpolateMessage(template string, data interface{}) string {
+	if data == nil || !strings.Contains(template, "{") {
+		return template
+	}
+
+	var b strings.Builder
+	v := reflect.ValueOf(data)
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		if value, ok := messageValue(v, template[start+1:end]); ok {
+			b.WriteString(template[:start])
+			b.WriteString(value)
+		} else {
+			b.WriteString(template[:end+1])
+		}
+		template = template[end+1:]
+	}
+	b.WriteString(template)
+	return b.String()
+}
+
+// messageValue returns the formatted value of the map key or struct field (json name)
+func messageValue(v reflect.Value, name string) (string, bool) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return "", false
+		}
+		value := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		if !value.IsValid() {
+			return "", false
+		}
+		return fmt.Sprint(value.Interface()), true
+	case reflect.Struct:
+		for _, field := range jsonFields(v.Type()) {
+			if field.name != name {
+				continue
+			}
+			value, err := v.FieldByIndexErr(field.index)
+			if err != nil {
+				return "", false
+			}
+			return fmt.Sprint(value.Interface()), true
+		}
+	default:
+	}
+	return "", false
+}
+
+// setContentLanguage sets the Content-Language header for a localized error
+func setContentLanguage(header http.Header, data interface{}) {
+	err, ok := data.(error)
+	if !ok {
+		return
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr != nil && len(apiErr.Locale) > 0 {
+		header.Set(contentLanguageHeader, apiErr.Locale)
+		addVary(header, acceptLanguageHeader)
+	}
+}
@@ -0,0 +1,143 @@
+package apirouter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+// testQuotaData is the error data used for message interpolation
+type testQuotaData struct {
+	Limit int    `json:"limit"`
+	Plan  string `json:"plan"`
+}
+
+// TestErrorCatalog_Message tests resolving and interpolating localized messages
+func TestErrorCatalog_Message(t *testing.T) {
+	t.Parallel()
+
+	catalog := NewErrorCatalog()
+	catalog.MustRegister(ErrorDefinition{Code: 1, Name: "quota", StatusCode: http.StatusTooManyRequests, PublicMessage: "limit of {limit} reached"})
+	catalog.RegisterMessages("de", map[int]string{1: "Limit von {limit} erreicht"})
+	catalog.RegisterMessages("pt-BR", map[int]string{1: "limite de {limit} atingido"})
+	catalog.RegisterMessages("fr", map[int]string{1: "limite de {limit} atteinte ({plan})"})
+	data := map[string]interface{}{"limit": 10}
+
+	tests := []struct {
+		acceptLanguage string
+		locale         string
+		message        string
+	}{
+		{"", "en", "limit of 10 reached"},
+		{"de", "de", "Limit von 10 erreicht"},
+		{"DE-at", "de", "Limit von 10 erreicht"},
+		{"pt", "pt-BR", "limite de 10 atingido"},
+		{"pt-br", "pt-BR", "limite de 10 atingido"},
+		{"es, de;q=0.5", "de", "Limit von 10 erreicht"},
+		{"de;q=0.2, pt-BR;q=0.8", "pt-BR", "limite de 10 atingido"},
+		{"ja", "en", "limit of 10 reached"},
+		{"*", "en", "limit of 10 reached"},
+		{"de;q=0", "en", "limit of 10 reached"},
+		{"fr", "fr", "limite de 10 atteinte ({plan})"},
+	}
+	for _, test := range tests {
+		t.Run(test.acceptLanguage, func(t *testing.T) {
+			message, locale, ok := catalog.Message(1, test.acceptLanguage, data)
+			require.True(t, ok)
+			require.Equal(t, test.locale, locale)
+			require.Equal(t, test.message, message)
+		})
+	}
+
+	t.Run("struct data", func(t *testing.T) {
+		message, _, ok := catalog.Message(1, "fr", &testQuotaData{Limit: 5, Plan: "free"})
+		require.True(t, ok)
+		require.Equal(t, "limite de 5 atteinte (free)", message)
+	})
+
+	t.Run("unknown code", func(t *testing.T) {
+		_, _, ok := catalog.Message(2, "de", nil)
+		require.False(t, ok)
+	})
+
+	t.Run("no message in the default language", func(t *testing.T) {
+		catalog.RegisterMessages("de", map[int]string{3: "nur Deutsch"})
+		_, _, ok := catalog.Message(3, "ja", nil)
+		require.False(t, ok)
+
+		message, locale, ok := catalog.Message(3, "de", nil)
+		require.True(t, ok)
+		require.Equal(t, "de", locale)
+		require.Equal(t, "nur Deutsch", message)
+	})
+}
+
+// TestErrorFromRequest_Localized tests localized errors and the Content-Language header
+func TestErrorFromRequest_Localized(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, RegisterErrorCode(ErrorDefinition{
+		Code: 4001, Name: "localized_test", StatusCode: http.StatusConflict, PublicMessage: "{name} already exists",
+	}))
+	RegisterErrorMessages("es", map[int]string{4001: "{name} ya existe"})
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/users", nil)
+	req.Header.Set(acceptLanguageHeader, "es-MX, en;q=0.5")
+
+	t.Run("error from request", func(t *testing.T) {
+		err := ErrorFromRequest(req, "duplicate user", "", 4001, 0, map[string]string{"name": "bob"})
+		require.Equal(t, "bob ya existe", err.Error())
+		require.Equal(t, "es", err.Locale)
+		require.Equal(t, http.StatusConflict, err.StatusCode)
+
+		w := httptest.NewRecorder()
+		RespondWith(w, req, err.StatusCode, err)
+		require.Equal(t, "es", w.Header().Get(contentLanguageHeader))
+		require.Equal(t, acceptLanguageHeader, w.Header().Get(varyHeaderString))
+		require.JSONEq(t, `{"error":"bob ya existe"}`, w.Body.String())
+	})
+
+	t.Run("new api error", func(t *testing.T) {
+		err := NewAPIError(req, nil, WithCode(4001), WithData(map[string]string{"name": "ana"}))
+		require.Equal(t, "ana ya existe", err.Error())
+		require.Equal(t, "es", err.Locale)
+	})
+
+	t.Run("explicit public message is not localized", func(t *testing.T) {
+		err := ErrorFromRequest(req, "", "custom", 4001, 0, nil)
+		require.Equal(t, "custom", err.Error())
+		require.Empty(t, err.Locale)
+
+		w := httptest.NewRecorder()
+		RespondWith(w, req, err.StatusCode, err)
+		require.Empty(t, w.Header().Get(contentLanguageHeader))
+	})
+
+	t.Run("error from response", func(t *testing.T) {
+		router := New()
+		router.HTTPRouter.POST("/users", router.Request(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+			err := ErrorFromResponse(w.(*APIResponseWriter), "duplicate user", "", 4001, 0, map[string]string{"name": "bob"})
+			RespondWith(w, req, err.StatusCode, err)
+		}))
+
+		rr := serveRequest(router, http.MethodPost, "/users", map[string]string{acceptLanguageHeader: "es-MX, en;q=0.5"})
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.Equal(t, "es", rr.Header().Get(contentLanguageHeader))
+		require.JSONEq(t, `{"error":"bob ya existe"}`, rr.Body.String())
+
+		err := ErrorFromResponse(setupTest(), "", "", 4001, 0, map[string]string{"name": "bob"})
+		require.Equal(t, "bob already exists", err.Error())
+		require.Equal(t, "en", err.Locale)
+	})
+
+	t.Run("problem details", func(t *testing.T) {
+		err := ErrorFromRequest(req, "", "", 4001, 0, nil)
+		w := httptest.NewRecorder()
+		RespondProblem(w, req, err.StatusCode, err)
+		require.Equal(t, "es", w.Header().Get(contentLanguageHeader))
+	})
+}
@@ -0,0 +1,343 @@
+package apirouter
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Content negotiation headers and media types
+const (
+	acceptHeader      string = "Accept"
+	cborContentType   string = "application/cbor"
+	csvContentType    string = "text/csv; charset=utf-8"
+	jsonContentType   string = "application/json; charset=utf-8"
+	xmlContentType    string = "application/xml; charset=utf-8"
+	xmlRootElement    string = "response"
+	xmlSliceElement   string = "item"
+	mediaTypeWildcard string = "*/*"
+)
+
+// ResponseEncoder encodes the response data for a media type.
+// Return ErrUnsupportedResponseData if the data cannot be represented, and the next acceptable format is tried.
+type ResponseEncoder func(data interface{}) ([]byte, error)
+
+// registeredEncoder is an encoder and the media type it produces
+type registeredEncoder struct {
+	contentType string
+	encode      ResponseEncoder
+	mediaType   string
+}
+
+// acceptRange is a single media range from the Accept header
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// Encoders in order of preference when the client has no preference (JSON is the default)
+var (
+	encoders = []registeredEncoder{
+		{contentType: jsonContentType, encode: json.Marshal, mediaType: "application/json"},
+		{contentType: xmlContentType, encode: encodeXML, mediaType: "application/xml"},
+		{contentType: "text/xml; charset=utf-8", encode: encodeXML, mediaType: "text/xml"},
+		{contentType: csvContentType, encode: encodeCSV, mediaType: "text/csv"},
+		{contentType: cborContentType, encode: MarshalCBOR, mediaType: "application/cbor"},
+	}
+	encodersMu sync.RWMutex
+)
+
+// RegisterEncoder adds an encoder for the content type (IE: "application/yaml"), replacing any existing encoder for the media type.
+// New encoders have the lowest preference when the client accepts several formats equally.
+func RegisterEncoder(contentType string, encoder ResponseEncoder) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return err
+	}
+
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+
+	entry := registeredEncoder{contentType: contentType, encode: encoder, mediaType: mediaType}
+	if i := slices.IndexFunc(encoders, func(e registeredEncoder) bool { return e.mediaType == mediaType }); i >= 0 {
+		encoders[i] = entry
+		return nil
+	}
+	encoders = append(encoders, entry)
+	return nil
+}
+
+// RespondNegotiated works like RespondWith, but encodes the data in the format the client prefers in the Accept header
+// (JSON, XML, CSV for slices of structs, CBOR or any registered encoder).
+//
+// If no acceptable format can encode the data, it responds with 406 (Not Acceptable).
+// Error responses (>= 400) fall back to JSON instead, so the error is not hidden by a 406.
+func RespondNegotiated(w http.ResponseWriter, req *http.Request, status int, data interface{}) {
+	header := w.Header()
+	addVary(header, acceptHeader)
+	status = validationStatus(status, data)
+
+	// If no content is expected, send just the status and no "body"
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		w.WriteHeader(status)
+		return
+	}
+
+	// Problem details are always JSON
+	if useProblemDetails(req, status, data) {
+		RespondWith(w, req, status, data)
+		return
+	}
+
+	setContentLanguage(header, data)
+	data = responseData(status, data)
+	for _, encoder := range negotiateEncoders(req.Header.Values(acceptHeader)) {
+		body, err := encoder.encode(data)
+		if errors.Is(err, ErrUnsupportedResponseData) {
+			continue
+		} else if err != nil {
+			RespondWith(w, req, http.StatusInternalServerError, nil)
+			return
+		}
+
+		header.Set(contentTypeHeader, encoder.contentType)
+		header.Set(contentLengthHeader, strconv.Itoa(len(body)))
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+		return
+	}
+
+	if status >= http.StatusBadRequest {
+		RespondWith(w, req, status, data)
+		return
+	}
+	RespondWith(w, req, http.StatusNotAcceptable, ErrorFromRequest(
+		req, "no encoder for accept: "+req.Header.Get(acceptHeader),
+		"unable to respond in any of the accepted formats", ErrCodeNotAcceptable, http.StatusNotAcceptable, nil,
+	))
+}
+
+// negotiateEncoders returns the acceptable encoders, ordered by the client's preference (q-value) then the registry order
+func negotiateEncoders(accept []string) []registeredEncoder {
+	encodersMu.RLock()
+	registered := slices.Clone(encoders)
+	encodersMu.RUnlock()
+
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		return registered[:1] // No preference, use the default
+	}
+
+	type candidate struct {
+		encoder registeredEncoder
+		q       float64
+	}
+	candidates := make([]candidate, 0, len(registered))
+	for _, encoder := range registered {
+		if q := acceptQuality(ranges, encoder.mediaType); q > 0 {
+			candidates = append(candidates, candidate{encoder: encoder, q: q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+
+	acceptable := make([]registeredEncoder, 0, len(candidates))
+	for _, c := range candidates {
+		acceptable = append(acceptable, c.encoder)
+	}
+	return acceptable
+}
+
+// parseAccept parses the media ranges and q-values of the Accept header
+func parseAccept(accept []string) []acceptRange {
+	var ranges []acceptRange
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, q := parseQualityValue(part)
+			if len(mediaType) == 0 {
+				continue
+			}
+			ranges = append(ranges, acceptRange{mediaType: strings.ToLower(mediaType), q: q})
+		}
+	}
+	return ranges
+}
+
+// acceptQuality returns the q-value of the most specific range that matches the media type (0 if none)
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	best, bestSpecificity := 0.0, -1
+	for _, r := range ranges {
+		specificity := -1
+		switch {
+		case r.mediaType == mediaType:
+			specificity = 2
+		case r.mediaType == mediaTypeWildcard:
+			specificity = 0
+		default:
+			if prefix, ok := strings.CutSuffix(r.mediaType, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+				specificity = 1
+			}
+		}
+		if specificity > bestSpecificity {
+			best, bestSpecificity = r.q, specificity
+		}
+	}
+	return best
+}
+
+// encodeXML encodes the data as XML inside a <response> element (maps and slices are supported)
+func encodeXML(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	if err := encodeXMLElement(encoder, xmlRootElement, reflect.ValueOf(data)); err != nil {
+		var unsupported *xml.UnsupportedTypeError
+		if errors.As(err, &unsupported) {
+			return nil, ErrUnsupportedResponseData
+		}
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeXMLElement writes the value as an element, using the keys of maps and <item> for slices
+func encodeXMLElement(encoder *xml.Encoder, name string, v reflect.Value) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return encoder.EncodeElement("", start)
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return encoder.EncodeElement("", start)
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return ErrUnsupportedResponseData
+		}
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(a.String(), b.String())
+		})
+		for _, key := range keys {
+			if err := encodeXMLElement(encoder, key.String(), v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return encoder.EncodeElement(v.Interface(), start)
+		}
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeXMLElement(encoder, xmlSliceElement, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	default:
+		return encoder.EncodeElement(v.Interface(), start)
+	}
+}
+
+// encodeCSV encodes a slice of structs as CSV with a header row (using the encoding/json field names)
+func encodeCSV(data interface{}) ([]byte, error) {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, ErrUnsupportedResponseData
+	}
+	elemType := v.Type().Elem()
+	if elemType.Kind() == reflect.Pointer {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil, ErrUnsupportedResponseData
+	}
+
+	fields := jsonFields(elemType)
+	record := make([]string, len(fields))
+	for i, field := range fields {
+		record[i] = field.name
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	_ = writer.Write(record)
+	for i := 0; i < v.Len(); i++ {
+		row := v.Index(i)
+		if row.Kind() == reflect.Pointer {
+			row = row.Elem()
+		}
+		for j, field := range fields {
+			record[j] = ""
+			if !row.IsValid() {
+				continue
+			}
+			value, err := row.FieldByIndexErr(field.index)
+			if err != nil {
+				continue
+			}
+			if record[j], err = csvValue(value); err != nil {
+				return nil, err
+			}
+		}
+		_ = writer.Write(record)
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// csvValue formats a single field (nested values are encoded as JSON)
+func csvValue(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	if marshaler, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		return string(text), err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	default:
+		encoded, err := json.Marshal(v.Interface())
+		return string(encoded), err
+	}
+}
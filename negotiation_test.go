@@ -0,0 +1,149 @@
+package apirouter
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// negotiationRow is a test model for negotiated responses
+type negotiationRow struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Note      *string   `json:"note"`
+	Secret    string    `json:"-"`
+	Tags      []string  `json:"tags"`
+}
+
+// testNegotiationRows returns rows for the negotiation tests
+func testNegotiationRows() []*negotiationRow {
+	note := `says "hi", twice`
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []*negotiationRow{
+		{CreatedAt: created, ID: 1, Name: "first", Note: &note, Secret: "s", Tags: []string{"a", "b"}},
+		{CreatedAt: created, ID: 2, Name: "second"},
+	}
+}
+
+// respondNegotiatedTest runs RespondNegotiated with the Accept header
+func respondNegotiatedTest(accept string, status int, data interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/rows", nil)
+	if len(accept) > 0 {
+		req.Header.Set(acceptHeader, accept)
+	}
+	rr := httptest.NewRecorder()
+	RespondNegotiated(rr, req, status, data)
+	return rr
+}
+
+// TestRespondNegotiated tests choosing the format from the Accept header
+func TestRespondNegotiated(t *testing.T) {
+	t.Parallel()
+
+	t.Run("json by default", func(t *testing.T) {
+		rr := respondNegotiatedTest("", http.StatusOK, map[string]string{"a": "b"})
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, jsonContentType, rr.Header().Get(contentTypeHeader))
+		require.JSONEq(t, `{"a":"b"}`, rr.Body.String())
+		require.Contains(t, rr.Header().Values(varyHeaderString), acceptHeader)
+	})
+
+	t.Run("json for any type", func(t *testing.T) {
+		rr := respondNegotiatedTest("*/*", http.StatusOK, map[string]string{"a": "b"})
+		require.Equal(t, jsonContentType, rr.Header().Get(contentTypeHeader))
+	})
+
+	t.Run("highest q-value wins", func(t *testing.T) {
+		rr := respondNegotiatedTest("application/json;q=0.5, application/xml;q=0.9", http.StatusOK, map[string]string{"a": "b"})
+		require.Equal(t, xmlContentType, rr.Header().Get(contentTypeHeader))
+		require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<response><a>b</a></response>`, rr.Body.String())
+	})
+
+	t.Run("most specific range sets the q-value", func(t *testing.T) {
+		rr := respondNegotiatedTest("application/*;q=0.8, application/json;q=0, */*;q=0.1", http.StatusOK, map[string]string{"a": "b"})
+		require.Equal(t, xmlContentType, rr.Header().Get(contentTypeHeader))
+	})
+
+	t.Run("xml for a slice of structs", func(t *testing.T) {
+		rr := respondNegotiatedTest("text/xml", http.StatusOK, testNegotiationRows()[1:])
+		require.Equal(t, "text/xml; charset=utf-8", rr.Header().Get(contentTypeHeader))
+		require.Contains(t, rr.Body.String(), "<response><item><CreatedAt>2024-01-02T03:04:05Z</CreatedAt><ID>2</ID><Name>second</Name>")
+	})
+
+	t.Run("csv for a slice of structs", func(t *testing.T) {
+		rr := respondNegotiatedTest("text/csv", http.StatusOK, testNegotiationRows())
+		require.Equal(t, csvContentType, rr.Header().Get(contentTypeHeader))
+		require.Equal(t, "created_at,id,name,note,tags\n"+
+			`2024-01-02T03:04:05Z,1,first,"says ""hi"", twice","[""a"",""b""]"`+"\n"+
+			"2024-01-02T03:04:05Z,2,second,,null\n", rr.Body.String())
+	})
+
+	t.Run("csv is skipped for a map", func(t *testing.T) {
+		rr := respondNegotiatedTest("text/csv, application/json;q=0.1", http.StatusOK, map[string]string{"a": "b"})
+		require.Equal(t, jsonContentType, rr.Header().Get(contentTypeHeader))
+	})
+
+	t.Run("cbor", func(t *testing.T) {
+		rr := respondNegotiatedTest("application/cbor", http.StatusCreated, map[string]int{"a": 1})
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, cborContentType, rr.Header().Get(contentTypeHeader))
+		require.Equal(t, "a1616101", hex.EncodeToString(rr.Body.Bytes()))
+	})
+
+	t.Run("406 when nothing matches", func(t *testing.T) {
+		rr := respondNegotiatedTest("image/png", http.StatusOK, map[string]string{"a": "b"})
+		require.Equal(t, http.StatusNotAcceptable, rr.Code)
+		require.Equal(t, jsonContentType, rr.Header().Get(contentTypeHeader))
+		require.Contains(t, rr.Body.String(), "unable to respond in any of the accepted formats")
+	})
+
+	t.Run("406 when the only match cannot encode the data", func(t *testing.T) {
+		rr := respondNegotiatedTest("text/csv", http.StatusOK, map[string]string{"a": "b"})
+		require.Equal(t, http.StatusNotAcceptable, rr.Code)
+	})
+
+	t.Run("errors fall back to json", func(t *testing.T) {
+		rr := respondNegotiatedTest("image/png", http.StatusBadRequest, errors.New("bad input"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.JSONEq(t, `{"error":"bad input"}`, rr.Body.String())
+	})
+
+	t.Run("errors are negotiated", func(t *testing.T) {
+		rr := respondNegotiatedTest("application/xml", http.StatusNotFound, nil)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Contains(t, rr.Body.String(), "<response><code>404</code><error>Not Found</error></response>")
+	})
+
+	t.Run("no content", func(t *testing.T) {
+		rr := respondNegotiatedTest("application/xml", http.StatusNoContent, nil)
+		require.Equal(t, http.StatusNoContent, rr.Code)
+		require.Empty(t, rr.Body.String())
+	})
+}
+
+// TestRegisterEncoder tests adding a custom encoder
+func TestRegisterEncoder(t *testing.T) {
+	t.Parallel()
+
+	err := RegisterEncoder("text/plain; charset=utf-8", func(data interface{}) ([]byte, error) {
+		if s, ok := data.(string); ok {
+			return []byte(strings.ToUpper(s)), nil
+		}
+		return nil, ErrUnsupportedResponseData
+	})
+	require.NoError(t, err)
+
+	rr := respondNegotiatedTest("text/plain", http.StatusOK, "hello")
+	require.Equal(t, "text/plain; charset=utf-8", rr.Header().Get(contentTypeHeader))
+	require.Equal(t, "HELLO", rr.Body.String())
+
+	require.Error(t, RegisterEncoder("not a media type;;", nil))
+}
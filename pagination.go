@@ -0,0 +1,301 @@
+package apirouter
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mrz1836/go-parameters"
+)
+
+// Pagination parameters
+const (
+	PaginationCursorParam string = "cursor"
+	PaginationLimitParam  string = "limit"
+	PaginationOffsetParam string = "offset"
+)
+
+// Pagination defaults and headers
+const (
+	defaultPageLimit    int    = 25
+	defaultMaxPageLimit int    = 100
+	linkHeader          string = "Link"
+	totalCountHeader    string = "X-Total-Count"
+)
+
+// PaginationOptions configures ParsePagination()
+//
+// Pages use limit/offset, or opaque signed cursors when the CursorSecret is set.
+type PaginationOptions struct {
+	CursorSecret string // Signs the cursors (enables cursor pagination instead of offsets)
+	DefaultLimit int    // The limit when none is requested (default 25)
+	Envelope     bool   // Wrap the data in a PageEnvelope with the pagination meta
+	MaxLimit     int    // The largest limit a client can request (default 100)
+}
+
+// Page is the page requested by the client
+type Page struct {
+	Cursor  string // The verified value of the cursor (empty for the first page, or when using offsets)
+	Limit   int    // The number of items on the page
+	Offset  int    // The number of items to skip (offset pagination)
+	options PaginationOptions
+}
+
+// PageResult describes the page of items being returned, for the Link headers and meta
+type PageResult struct {
+	HasMore    bool   // There are more items after the page (offset pagination, when the total is unknown)
+	NextCursor string // The value of the next page's cursor, signed by the Page (empty on the last page)
+	PrevCursor string // The value of the previous page's cursor, signed by the Page (empty on the first page)
+	Total      *int   // The total number of items (if known)
+}
+
+// PageMeta is the pagination meta of a PageEnvelope
+type PageMeta struct {
+	Limit      int               `json:"limit" url:"limit"`
+	Links      map[string]string `json:"links,omitempty" url:"links"`
+	NextCursor string            `json:"next_cursor,omitempty" url:"next_cursor"`
+	Offset     int               `json:"offset,omitempty" url:"offset"`
+	PrevCursor string            `json:"prev_cursor,omitempty" url:"prev_cursor"`
+	Total      *int              `json:"total,omitempty" url:"total"`
+}
+
+// PageEnvelope wraps a page of data with the pagination meta
+type PageEnvelope struct {
+	Data interface{} `json:"data" url:"data"`
+	Meta PageMeta    `json:"meta" url:"meta"`
+}
+
+// pageLink is a link relation of a page
+type pageLink struct {
+	rel string
+	url string
+}
+
+// ParsePagination parses and validates the limit and offset (or cursor) of the params
+//
+//	page, err := ParsePagination(GetParams(req), PaginationOptions{MaxLimit: 50})
+//	if err != nil {
+//		RespondWith(w, req, http.StatusUnprocessableEntity, err)
+//		return
+//	}
+//	users, total := listUsers(page.Offset, page.Limit)
+//	RespondPage(w, req, http.StatusOK, page, PageResult{Total: &total}, users)
+//
+// A limit above the MaxLimit, a negative offset, or a cursor that was not signed with the
+// CursorSecret returns a ValidationError. Offsets are rejected when using cursors, and cursors when using offsets.
+func ParsePagination(params *parameters.Params, options PaginationOptions) (*Page, error) {
+	if options.MaxLimit <= 0 {
+		options.MaxLimit = defaultMaxPageLimit
+	}
+	if options.DefaultLimit <= 0 || options.DefaultLimit > options.MaxLimit {
+		options.DefaultLimit = min(defaultPageLimit, options.MaxLimit)
+	}
+	page := &Page{Limit: options.DefaultLimit, options: options}
+
+	v := NewParamsValidator(params)
+	if limit, ok := v.integer(PaginationLimitParam, 1, options.MaxLimit); ok {
+		page.Limit = limit
+	}
+
+	if len(options.CursorSecret) == 0 {
+		if offset, ok := v.integer(PaginationOffsetParam, 0, math.MaxInt32); ok {
+			page.Offset = offset
+		}
+		_, hasCursor := v.value(PaginationCursorParam)
+		v.Check(PaginationCursorParam, RuleCursor, "is not supported, use offset", !hasCursor)
+		return page, v.Err()
+	}
+
+	_, hasOffset := v.value(PaginationOffsetParam)
+	v.Check(PaginationOffsetParam, RuleCursor, "is not supported, use cursor", !hasOffset)
+	if cursor, ok := v.value(PaginationCursorParam); ok {
+		value, valid := verifyCursor(options.CursorSecret, cursor)
+		v.Check(PaginationCursorParam, RuleCursor, "is invalid", valid)
+		page.Cursor = value
+	}
+	return page, v.Err()
+}
+
+// SetPaginationHeaders sets the RFC 8288 Link header (first, prev, next and last) and the X-Total-Count header (if known)
+//
+// The links are relative to the request, keeping its other query parameters. The last link needs the total (offset pagination).
+func SetPaginationHeaders(w http.ResponseWriter, req *http.Request, page *Page, result PageResult) {
+	links := page.links(req, result)
+	values := make([]string, 0, len(links))
+	for _, link := range links {
+		values = append(values, "<"+link.url+`>; rel="`+link.rel+`"`)
+	}
+	w.Header().Set(linkHeader, strings.Join(values, ", "))
+
+	if result.Total != nil {
+		w.Header().Set(totalCountHeader, strconv.Itoa(*result.Total))
+	}
+}
+
+// RespondPage sets the pagination headers and writes the data with RespondWith()
+// (wrapped in a PageEnvelope when the PaginationOptions Envelope is set)
+func RespondPage(w http.ResponseWriter, req *http.Request, status int, page *Page, result PageResult, data interface{}) {
+	SetPaginationHeaders(w, req, page, result)
+	if page.options.Envelope {
+		data = page.Envelope(req, result, data)
+	}
+	RespondWith(w, req, status, data)
+}
+
+// ReturnPageJSONEncode is RespondPage() with the allowed fields of JSONEncode() (the meta of an envelope is always written)
+//
+// The data is written the same as JSONEncode() with or without the envelope (nil allowed fields writes empty objects).
+func ReturnPageJSONEncode(w http.ResponseWriter, req *http.Request, status int, page *Page, result PageResult,
+	objects interface{}, allowed []string,
+) error {
+	SetPaginationHeaders(w, req, page, result)
+	w.Header().Set(contentTypeHeader, "application/json")
+	w.WriteHeader(status)
+
+	set := newAllowedSet(allowed)
+	if page.options.Envelope {
+		return writePageEnvelope(w, page.Envelope(req, result, objects), set)
+	}
+	return writeJSONEncode(w, objects, set, nil)
+}
+
+// Envelope wraps the data with the pagination meta (the links and cursors of the result)
+func (p *Page) Envelope(req *http.Request, result PageResult, data interface{}) PageEnvelope {
+	meta := PageMeta{Limit: p.Limit, Offset: p.Offset, Total: result.Total}
+	if p.cursors() {
+		meta.NextCursor = p.signCursor(result.NextCursor)
+		meta.PrevCursor = p.signCursor(result.PrevCursor)
+	}
+
+	links := p.links(req, result)
+	meta.Links = make(map[string]string, len(links))
+	for _, link := range links {
+		meta.Links[link.rel] = link.url
+	}
+	return PageEnvelope{Data: data, Meta: meta}
+}
+
+// writePageEnvelope writes the envelope with the allowed fields of the data (the output of JSONEncode) and the whole meta
+func writePageEnvelope(w io.Writer, envelope PageEnvelope, set *allowedSet) error {
+	buf := jsonBufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		jsonBufferPool.Put(buf)
+	}()
+
+	buf.WriteString(`{"data":`)
+	if err := appendJSONEncode(buf, envelope.Data, set, nil); err != nil {
+		return err
+	}
+	buf.WriteString(`,"meta":`)
+	if err := writeAllowedJSON(buf, envelope.Meta, nil, jsonEncodeMode, nil); err != nil {
+		return err
+	}
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// cursors checks if the page uses cursor pagination
+func (p *Page) cursors() bool {
+	return len(p.options.CursorSecret) > 0
+}
+
+// links returns the link relations of the result
+func (p *Page) links(req *http.Request, result PageResult) []pageLink {
+	links := []pageLink{{"first", p.pageURL(req, "", 0)}}
+
+	if p.cursors() {
+		if len(result.PrevCursor) > 0 {
+			links = append(links, pageLink{"prev", p.pageURL(req, p.signCursor(result.PrevCursor), 0)})
+		}
+		if len(result.NextCursor) > 0 {
+			links = append(links, pageLink{"next", p.pageURL(req, p.signCursor(result.NextCursor), 0)})
+		}
+		return links
+	}
+
+	if p.Offset > 0 {
+		links = append(links, pageLink{"prev", p.pageURL(req, "", max(p.Offset-p.Limit, 0))})
+	}
+	if result.HasMore || (result.Total != nil && p.Offset+p.Limit < *result.Total) {
+		links = append(links, pageLink{"next", p.pageURL(req, "", p.Offset+p.Limit)})
+	}
+	if result.Total != nil {
+		links = append(links, pageLink{"last", p.pageURL(req, "", max(*result.Total-1, 0)/p.Limit*p.Limit)})
+	}
+	return links
+}
+
+// pageURL returns the request URL (relative) with the limit and the cursor or offset of a page
+func (p *Page) pageURL(req *http.Request, cursor string, offset int) string {
+	query := req.URL.Query()
+	query.Set(PaginationLimitParam, strconv.Itoa(p.Limit))
+	query.Del(PaginationCursorParam)
+	query.Del(PaginationOffsetParam)
+	if len(cursor) > 0 {
+		query.Set(PaginationCursorParam, cursor)
+	} else if offset > 0 {
+		query.Set(PaginationOffsetParam, strconv.Itoa(offset))
+	}
+
+	u := *req.URL
+	u.Scheme, u.Host, u.User, u.RawQuery, u.Fragment = "", "", nil, query.Encode(), ""
+	return u.String()
+}
+
+// signCursor signs the value of a cursor (empty for an empty value)
+func (p *Page) signCursor(value string) string {
+	if len(value) == 0 {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(value)) + "." +
+		base64.RawURLEncoding.EncodeToString(cursorSignature(p.options.CursorSecret, value))
+}
+
+// verifyCursor returns the value of a signed cursor, false if the signature is invalid
+func verifyCursor(secret, cursor string) (string, bool) {
+	payload, signature, found := strings.Cut(cursor, ".")
+	if !found {
+		return "", false
+	}
+	value, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || len(value) == 0 {
+		return "", false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, cursorSignature(secret, string(value))) {
+		return "", false
+	}
+	return string(value), true
+}
+
+// cursorSignature returns the HMAC-SHA256 of the cursor value
+func cursorSignature(secret, value string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// integer returns the key (if present) as an integer between min and max, adding a field error if it is not
+func (v *ParamsValidator) integer(key string, minValue, maxValue int) (int, bool) {
+	value, ok := v.value(key)
+	if !ok {
+		return 0, false
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		v.validation.Add(paramPointer(key), RuleType, "must be an integer", nil)
+		return 0, false
+	}
+
+	fields := len(v.validation.Fields)
+	v.Range(key, float64(minValue), float64(maxValue))
+	return number, len(v.validation.Fields) == fields
+}
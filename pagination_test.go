@@ -0,0 +1,218 @@
+package apirouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mrz1836/go-parameters"
+	"github.com/stretchr/testify/require"
+)
+
+// testCursorSecret is the cursor secret for the pagination tests
+const testCursorSecret = "cursor-secret"
+
+// pageParams returns the params for the pagination tests
+func pageParams(values map[string]interface{}) *parameters.Params {
+	return &parameters.Params{Values: values}
+}
+
+// TestParsePagination tests parsing and validating the limit, offset and cursor
+func TestParsePagination(t *testing.T) {
+	t.Parallel()
+
+	t.Run("defaults", func(t *testing.T) {
+		page, err := ParsePagination(pageParams(nil), PaginationOptions{})
+		require.NoError(t, err)
+		require.Equal(t, defaultPageLimit, page.Limit)
+		require.Equal(t, 0, page.Offset)
+
+		page, err = ParsePagination(nil, PaginationOptions{MaxLimit: 10})
+		require.NoError(t, err)
+		require.Equal(t, 10, page.Limit)
+	})
+
+	t.Run("limit and offset", func(t *testing.T) {
+		page, err := ParsePagination(pageParams(map[string]interface{}{"limit": "50", "offset": float64(100)}), PaginationOptions{})
+		require.NoError(t, err)
+		require.Equal(t, 50, page.Limit)
+		require.Equal(t, 100, page.Offset)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			values map[string]interface{}
+			field  string
+			rule   string
+		}{
+			{"limit above the max", map[string]interface{}{"limit": "101"}, "/limit", RuleRange},
+			{"zero limit", map[string]interface{}{"limit": "0"}, "/limit", RuleRange},
+			{"decimal limit", map[string]interface{}{"limit": "1.5"}, "/limit", RuleType},
+			{"negative offset", map[string]interface{}{"offset": "-1"}, "/offset", RuleRange},
+			{"text offset", map[string]interface{}{"offset": "ten"}, "/offset", RuleType},
+			{"cursor without a secret", map[string]interface{}{"cursor": "abc"}, "/cursor", RuleCursor},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := ParsePagination(pageParams(tt.values), PaginationOptions{})
+				var validationErr *ValidationError
+				require.ErrorAs(t, err, &validationErr)
+				require.Len(t, validationErr.Fields, 1)
+				require.Equal(t, tt.field, validationErr.Fields[0].Field)
+				require.Equal(t, tt.rule, validationErr.Fields[0].Rule)
+			})
+		}
+	})
+
+	t.Run("cursors", func(t *testing.T) {
+		options := PaginationOptions{CursorSecret: testCursorSecret}
+		first, err := ParsePagination(pageParams(nil), options)
+		require.NoError(t, err)
+		require.Empty(t, first.Cursor)
+
+		page, err := ParsePagination(pageParams(map[string]interface{}{"cursor": first.signCursor("user_42")}), options)
+		require.NoError(t, err)
+		require.Equal(t, "user_42", page.Cursor)
+
+		for _, cursor := range []string{
+			"user_42",
+			first.signCursor("user_42") + "x",
+			"dXNlcl80Mw." + first.signCursor("user_42")[len("dXNlcl80Mg."):], // Tampered value (user_43)
+			(&Page{options: PaginationOptions{CursorSecret: "other"}}).signCursor("user_42"),
+		} {
+			_, err = ParsePagination(pageParams(map[string]interface{}{"cursor": cursor}), options)
+			require.ErrorAs(t, err, new(*ValidationError), cursor)
+		}
+
+		_, err = ParsePagination(pageParams(map[string]interface{}{"offset": "10"}), options)
+		require.ErrorAs(t, err, new(*ValidationError))
+	})
+}
+
+// TestSetPaginationHeaders tests the Link and X-Total-Count headers
+func TestSetPaginationHeaders(t *testing.T) {
+	t.Parallel()
+
+	headers := func(target string, options PaginationOptions, result PageResult) http.Header {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, target, nil)
+		params := parameters.ParseParams(req)
+		page, err := ParsePagination(params, options)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		SetPaginationHeaders(w, req, page, result)
+		return w.Header()
+	}
+
+	t.Run("offsets with a total", func(t *testing.T) {
+		total := 95
+		h := headers("/users?limit=20&offset=40&sort=name", PaginationOptions{}, PageResult{Total: &total})
+		require.Equal(t, `</users?limit=20&sort=name>; rel="first", `+
+			`</users?limit=20&offset=20&sort=name>; rel="prev", `+
+			`</users?limit=20&offset=60&sort=name>; rel="next", `+
+			`</users?limit=20&offset=80&sort=name>; rel="last"`, h.Get(linkHeader))
+		require.Equal(t, "95", h.Get(totalCountHeader))
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		total := 40
+		h := headers("/users?limit=20&offset=20", PaginationOptions{}, PageResult{Total: &total})
+		require.Equal(t, `</users?limit=20>; rel="first", </users?limit=20>; rel="prev", </users?limit=20&offset=20>; rel="last"`, h.Get(linkHeader))
+
+		total = 0
+		h = headers("/users", PaginationOptions{}, PageResult{Total: &total})
+		require.Equal(t, `</users?limit=25>; rel="first", </users?limit=25>; rel="last"`, h.Get(linkHeader))
+		require.Equal(t, "0", h.Get(totalCountHeader))
+	})
+
+	t.Run("unknown total", func(t *testing.T) {
+		h := headers("/users?limit=10", PaginationOptions{}, PageResult{HasMore: true})
+		require.Equal(t, `</users?limit=10>; rel="first", </users?limit=10&offset=10>; rel="next"`, h.Get(linkHeader))
+		require.Empty(t, h.Values(totalCountHeader))
+	})
+
+	t.Run("cursors", func(t *testing.T) {
+		options := PaginationOptions{CursorSecret: testCursorSecret}
+		page := &Page{options: options}
+		h := headers("/users?limit=10", options, PageResult{NextCursor: "11", PrevCursor: "1"})
+		require.Equal(t, `</users?limit=10>; rel="first", `+
+			`</users?cursor=`+page.signCursor("1")+`&limit=10>; rel="prev", `+
+			`</users?cursor=`+page.signCursor("11")+`&limit=10>; rel="next"`, h.Get(linkHeader))
+	})
+}
+
+// TestRespondPage tests writing a page with and without the meta envelope
+func TestRespondPage(t *testing.T) {
+	t.Parallel()
+
+	users := []*testEncodeUser{{Nickname: "a", Password: "secret", UserID: 1}, {Nickname: "b", UserID: 2}}
+	total := 2
+	respond := func(options PaginationOptions, encode bool, allowed []string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/users?limit=2", nil)
+		page, err := ParsePagination(parameters.ParseParams(req), options)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		if !encode {
+			RespondPage(w, req, http.StatusOK, page, PageResult{Total: &total}, users)
+		} else {
+			require.NoError(t, ReturnPageJSONEncode(w, req, http.StatusOK, page, PageResult{Total: &total}, users, allowed))
+		}
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "2", w.Header().Get(totalCountHeader))
+		require.NotEmpty(t, w.Header().Get(linkHeader))
+		return w
+	}
+
+	t.Run("data", func(t *testing.T) {
+		expected, err := json.Marshal(users)
+		require.NoError(t, err)
+		require.JSONEq(t, string(expected), respond(PaginationOptions{}, false, nil).Body.String())
+	})
+
+	t.Run("envelope", func(t *testing.T) {
+		var envelope struct {
+			Data []*testEncodeUser `json:"data"`
+			Meta PageMeta          `json:"meta"`
+		}
+		require.NoError(t, json.Unmarshal(respond(PaginationOptions{Envelope: true}, false, nil).Body.Bytes(), &envelope))
+		require.Len(t, envelope.Data, 2)
+		require.Equal(t, 2, envelope.Meta.Limit)
+		require.Equal(t, &total, envelope.Meta.Total)
+		require.Equal(t, map[string]string{"first": "/users?limit=2", "last": "/users?limit=2"}, envelope.Meta.Links)
+	})
+
+	t.Run("allowed fields", func(t *testing.T) {
+		require.JSONEq(t, `[{"id":1,"nickname":"a"},{"id":2,"nickname":"b"}]`,
+			respond(PaginationOptions{}, true, []string{"id", "nickname"}).Body.String())
+
+		require.JSONEq(t,
+			`{"data":[{"id":1},{"id":2}],"meta":{"limit":2,"links":{"first":"/users?limit=2","last":"/users?limit=2"},"total":2}}`,
+			respond(PaginationOptions{Envelope: true}, true, []string{"id"}).Body.String(),
+		)
+	})
+
+	t.Run("allowed fields are written the same in both modes", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, JSONEncode(json.NewEncoder(&buf), users, []string{"nickname", "id"}))
+		require.Equal(t, `[{"id":1,"nickname":"a"},{"id":2,"nickname":"b"}]`+"\n", buf.String())
+		require.Equal(t, buf.String(), respond(PaginationOptions{}, true, []string{"nickname", "id"}).Body.String())
+		require.Equal(t,
+			`{"data":[{"id":1,"nickname":"a"},{"id":2,"nickname":"b"}],`+
+				`"meta":{"limit":2,"links":{"first":"/users?limit=2","last":"/users?limit=2"},"total":2}}`+"\n",
+			respond(PaginationOptions{Envelope: true}, true, []string{"nickname", "id"}).Body.String(),
+		)
+	})
+
+	t.Run("nil allowed fields", func(t *testing.T) {
+		require.Equal(t, "[{},{}]\n", respond(PaginationOptions{}, true, nil).Body.String())
+		require.JSONEq(t,
+			`{"data":[{},{}],"meta":{"limit":2,"links":{"first":"/users?limit=2","last":"/users?limit=2"},"total":2}}`,
+			respond(PaginationOptions{Envelope: true}, true, nil).Body.String(),
+		)
+	})
+}
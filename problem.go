@@ -0,0 +1,140 @@
+package apirouter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Problem details media type and defaults (RFC 9457)
+const (
+	problemJSONContentType string = "application/problem+json"
+	problemTypeBlank       string = "about:blank"
+)
+
+// ProblemType is the problem type URI and title registered for an error code
+type ProblemType struct {
+	Title string `json:"title" url:"title"` // Short summary of the problem type (default is the HTTP status text)
+	Type  string `json:"type" url:"type"`   // URI identifying the problem type (IE: https://example.com/problems/out-of-credit)
+}
+
+// ProblemDetails is an RFC 9457 problem details object, with the request_guid and code extension members
+type ProblemDetails struct {
+	Code        int                    `json:"code,omitempty" url:"code"`                 // Associated error code (extension)
+	Detail      string                 `json:"detail,omitempty" url:"detail"`             // Explanation specific to this occurrence
+	Extensions  map[string]interface{} `json:"-" url:"-"`                                 // Additional extension members
+	Instance    string                 `json:"instance,omitempty" url:"instance"`         // URI of this occurrence (the request path)
+	RequestGUID string                 `json:"request_guid,omitempty" url:"request_guid"` // Unique Request ID for tracking (extension)
+	Status      int                    `json:"status" url:"status"`                       // HTTP status code
+	Title       string                 `json:"title" url:"title"`                         // Short summary of the problem type
+	Type        string                 `json:"type" url:"type"`                           // URI identifying the problem type
+}
+
+// Problem types by error code
+var (
+	problemTypes   = make(map[int]ProblemType)
+	problemTypesMu sync.RWMutex
+)
+
+// RegisterProblemType maps an error code (APIError.Code) to a problem type URI and title
+func RegisterProblemType(code int, problemType ProblemType) {
+	problemTypesMu.Lock()
+	defer problemTypesMu.Unlock()
+	problemTypes[code] = problemType
+}
+
+// NewProblemDetails creates the problem details for an error response.
+// An *APIError provides the detail (public message), code and request_guid, any other error provides the detail.
+// The field errors of a ValidationError are added as the "fields" extension member.
+func NewProblemDetails(req *http.Request, status int, err error) *ProblemDetails {
+	problem := &ProblemDetails{Status: status}
+	if req != nil {
+		problem.Instance = req.URL.Path
+		problem.RequestGUID, _ = GetRequestID(req)
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr != nil {
+			problem.Code = apiErr.Code
+			problem.Detail = apiErr.PublicMessage
+			if len(apiErr.RequestGUID) > 0 {
+				problem.RequestGUID = apiErr.RequestGUID
+			}
+		}
+	} else if err != nil {
+		problem.Detail = err.Error()
+	}
+	if validationErr, ok := validationError(err); ok {
+		problem.Extensions = map[string]interface{}{validationFieldsJSONField: validationErr.Fields}
+	}
+
+	problemTypesMu.RLock()
+	problemType, ok := problemTypes[problem.Code]
+	problemTypesMu.RUnlock()
+	if ok && problem.Code != 0 {
+		problem.Type, problem.Title = problemType.Type, problemType.Title
+	}
+	if len(problem.Type) == 0 {
+		problem.Type = problemTypeBlank
+	}
+	if len(problem.Title) == 0 {
+		problem.Title = http.StatusText(status)
+	}
+	return problem
+}
+
+// MarshalJSON encodes the problem with any extension members (the standard members take precedence)
+func (p *ProblemDetails) MarshalJSON() ([]byte, error) {
+	type problemDetails ProblemDetails // Without the MarshalJSON method
+	if len(p.Extensions) == 0 {
+		return json.Marshal((*problemDetails)(p))
+	}
+
+	members := make(map[string]interface{}, len(p.Extensions)+8)
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+	standard, err := json.Marshal((*problemDetails)(p))
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(standard, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+// RespondProblem writes the error as application/problem+json (RFC 9457)
+func RespondProblem(w http.ResponseWriter, req *http.Request, status int, err error) {
+	setContentLanguage(w.Header(), err)
+	writeProblem(w, NewProblemDetails(req, status, err))
+}
+
+// writeProblem writes the problem details with its status
+func writeProblem(w http.ResponseWriter, problem *ProblemDetails) {
+	body, err := json.Marshal(problem)
+	if err != nil {
+		body = []byte(`{"type":"about:blank","title":"Internal Server Error","status":500}`)
+		problem.Status = http.StatusInternalServerError
+	}
+
+	w.Header().Set(contentTypeHeader, problemJSONContentType)
+	w.Header().Set(contentLengthHeader, strconv.Itoa(len(body)))
+	w.WriteHeader(problem.Status)
+	_, _ = w.Write(body)
+}
+
+// useProblemDetails checks if the router enabled problem details for the request and this is an error response
+func useProblemDetails(req *http.Request, status int, data interface{}) bool {
+	if req == nil || status < http.StatusBadRequest {
+		return false
+	}
+	if enabled, _ := req.Context().Value(problemDetailsKey).(bool); !enabled {
+		return false
+	}
+	_, isError := data.(error)
+	return data == nil || isError
+}
@@ -0,0 +1,141 @@
+package apirouter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+// problemRequest returns a request with problem details enabled (as done by Request())
+func problemRequest() *http.Request {
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/accounts/1?token=secret", nil)
+	req = SetOnRequest(req, requestIDKey, "request-123")
+	return SetOnRequest(req, problemDetailsKey, true)
+}
+
+// TestRespondWith_ProblemDetails tests error responses when problem details are enabled
+func TestRespondWith_ProblemDetails(t *testing.T) {
+	t.Parallel()
+
+	t.Run("api error", func(t *testing.T) {
+		RegisterProblemType(9001, ProblemType{Title: "Out of credit", Type: "https://example.com/problems/out-of-credit"})
+
+		req := problemRequest()
+		apiErr := ErrorFromRequest(req, "balance is 0", "your balance is too low", 9001, http.StatusForbidden, nil)
+		rr := httptest.NewRecorder()
+		RespondWith(rr, req, http.StatusForbidden, apiErr)
+
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Equal(t, problemJSONContentType, rr.Header().Get(contentTypeHeader))
+		require.JSONEq(t, `{
+			"type": "https://example.com/problems/out-of-credit",
+			"title": "Out of credit",
+			"status": 403,
+			"detail": "your balance is too low",
+			"instance": "/accounts/1",
+			"request_guid": "request-123",
+			"code": 9001
+		}`, rr.Body.String())
+		require.NotContains(t, rr.Body.String(), "balance is 0")
+	})
+
+	t.Run("unregistered code", func(t *testing.T) {
+		req := problemRequest()
+		rr := httptest.NewRecorder()
+		RespondWith(rr, req, http.StatusRequestEntityTooLarge, &APIError{Code: ErrCodeBodyTooLarge, PublicMessage: "too big"})
+
+		var problem map[string]interface{}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+		require.Equal(t, problemTypeBlank, problem["type"])
+		require.Equal(t, "Request Entity Too Large", problem["title"])
+		require.InDelta(t, 601, problem["code"], 0)
+	})
+
+	t.Run("plain error", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		RespondWith(rr, problemRequest(), http.StatusBadRequest, errors.New("missing name"))
+		require.JSONEq(t, `{
+			"type": "about:blank",
+			"title": "Bad Request",
+			"status": 400,
+			"detail": "missing name",
+			"instance": "/accounts/1",
+			"request_guid": "request-123"
+		}`, rr.Body.String())
+	})
+
+	t.Run("nil data", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		RespondWith(rr, problemRequest(), http.StatusNotFound, nil)
+		require.Equal(t, problemJSONContentType, rr.Header().Get(contentTypeHeader))
+		require.Contains(t, rr.Body.String(), `"title":"Not Found"`)
+	})
+
+	t.Run("typed nil api error", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		var apiErr *APIError
+		RespondWith(rr, problemRequest(), http.StatusInternalServerError, apiErr)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), `"title":"Internal Server Error"`)
+	})
+
+	t.Run("non-error data is unchanged", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		RespondWith(rr, problemRequest(), http.StatusBadRequest, map[string]string{"field": "name"})
+		require.Equal(t, "application/json; charset=utf-8", rr.Header().Get(contentTypeHeader))
+		require.JSONEq(t, `{"field":"name"}`, rr.Body.String())
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil)
+		rr := httptest.NewRecorder()
+		RespondWith(rr, req, http.StatusBadRequest, errors.New("missing name"))
+		require.JSONEq(t, `{"error":"missing name"}`, rr.Body.String())
+	})
+}
+
+// TestRouter_ProblemDetails tests enabling problem details on the router
+func TestRouter_ProblemDetails(t *testing.T) {
+	t.Parallel()
+
+	router := New()
+	router.ProblemDetails = true
+	handler := router.Request(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		RespondNegotiated(w, req, http.StatusConflict, ErrorFromRequest(req, "duplicate", "already exists", ErrCodeUnknown, http.StatusConflict, nil))
+	})
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/accounts", nil)
+	req.Header.Set(acceptHeader, "application/xml")
+	rr := httptest.NewRecorder()
+	handler(rr, req, nil)
+
+	require.Equal(t, http.StatusConflict, rr.Code)
+	require.Equal(t, problemJSONContentType, rr.Header().Get(contentTypeHeader))
+
+	var problem ProblemDetails
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+	require.Equal(t, "already exists", problem.Detail)
+	require.NotEmpty(t, problem.RequestGUID)
+	require.Equal(t, "/accounts", problem.Instance)
+}
+
+// TestProblemDetails_MarshalJSON tests extension members
+func TestProblemDetails_MarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	problem := &ProblemDetails{
+		Extensions: map[string]interface{}{"balance": 30, "status": "ignored"},
+		Status:     http.StatusForbidden,
+		Title:      "Forbidden",
+		Type:       problemTypeBlank,
+	}
+	data, err := json.Marshal(problem)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"balance":30,"status":403,"title":"Forbidden","type":"about:blank"}`, string(data))
+}
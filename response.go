@@ -7,7 +7,6 @@ import (
 	"net/http"
 	"reflect"
 	"strconv"
-	"strings"
 
 	"github.com/matryer/respond"
 )
@@ -43,179 +42,88 @@ func ReturnJSONEncode(w http.ResponseWriter, code int, e *json.Encoder, objects
 }
 
 // JSONEncodeHierarchy will execute JSONEncode for multiple nested objects
+//
+// The allowed fields are either a []string (see JSONEncode), a *Fieldset (see SparseFields) or an AllowedKeys tree, where each key is
+// the json name of a field (or map key) and the value is the allowed fields of that value (nil allows the whole value).
+// Slices and arrays filter each element, pointers and interfaces filter the value they point to, and values with
+// a custom encoding (json.Marshaler or encoding.TextMarshaler) are written whole. The structs filtered by an AllowedKeys
+// tree are the same as encoding/json for the allowed fields (untagged fields use the field name, IE: "FirstName"), while
+// a []string or *Fieldset is written the same as JSONEncode (sorted, and untagged fields use the SnakeCase name).
+// An unsupported allowed type writes nothing.
 func JSONEncodeHierarchy(w io.Writer, objects, allowed interface{}) error {
-	if allowed == nil {
+	switch allowed.(type) {
+	case nil:
 		return json.NewEncoder(w).Encode(objects)
+	case []string, *Fieldset, AllowedKeys, map[string]interface{}:
+	default:
+		return nil // Unsupported allowed types have always written nothing
 	}
 
-	if slice, ok := allowed.([]string); ok {
-		return JSONEncode(json.NewEncoder(w), objects, slice)
-	} else if obj, found := allowed.(AllowedKeys); found {
-		val := reflect.ValueOf(objects)
-		if val.Kind() == reflect.Pointer {
-			val = val.Elem()
-		}
-		data := val.Interface()
-		t := reflect.TypeOf(data)
-		v := reflect.ValueOf(data)
-		numFields := t.NumField()
-
-		fieldOutputs := make([]string, 0, numFields)
-
-		for i := 0; i < numFields; i++ {
-			field := t.Field(i)
-			jsonTag := field.Tag.Get("json")
-			if jsonTag == "" {
-				jsonTag = field.Name
-			}
-			keys, good := obj[jsonTag]
-			if !good {
-				continue
-			}
-
-			var buf bytes.Buffer
-			buf.WriteString(`"`)
-			buf.WriteString(jsonTag)
-			buf.WriteString(`": `)
-
-			fieldValue := v.Field(i)
-			fieldInterface := fieldValue.Interface()
-			if fieldValue.Kind() == reflect.Struct && fieldValue.CanAddr() {
-				fieldInterface = fieldValue.Addr().Interface()
-			}
-
-			var sub bytes.Buffer
-			err := JSONEncodeHierarchy(&sub, fieldInterface, keys)
-			if err != nil {
-				return err
-			}
-			buf.Write(sub.Bytes())
-
-			fieldOutputs = append(fieldOutputs, buf.String())
-		}
+	set, err := toAllowedSet(allowed)
+	if err != nil {
+		return err
+	}
 
-		_, _ = w.Write([]byte("{"))
-		_, _ = w.Write([]byte(strings.Join(fieldOutputs, ",")))
-		_, _ = w.Write([]byte("}"))
+	buf := jsonBufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		jsonBufferPool.Put(buf)
+	}()
+	if err = writeAllowedJSON(buf, objects, set, 0, nil); err != nil {
+		return err
 	}
-	return nil
+	buf.WriteByte('\n')
+	_, err = w.Write(buf.Bytes())
+	return err
 }
 
 // JSONEncode will encode only the allowed fields of the models
+//
+// Fields are named by their json tags, or the SnakeCase field name when untagged (IE: UserID is "user_id"),
+// honoring "-", omitempty and the string option. Values allowed whole are written the same as encoding/json. A dotted path allows a nested field
+// (IE: "profile.address.city" only keeps the city of the profile's address, while "profile" keeps the whole profile).
+// The filtered objects are sorted by field name and written directly using a plan compiled once per type and allowed fields.
 func JSONEncode(e *json.Encoder, objects interface{}, allowed []string) error {
-	var data []map[string]interface{}
-	isMulti := false
-	count := 0
-
-	if reflect.TypeOf(objects).Kind() == reflect.Slice {
-		count = reflect.ValueOf(objects).Len()
-		data = make([]map[string]interface{}, count)
-		isMulti = true
-	}
-
-	if isMulti {
-		if count == 0 {
-			return e.Encode(make([]interface{}, 0))
-		}
-
-		raw := reflect.ValueOf(objects)
-
-		obj := jsonMap(raw.Index(0).Interface())
-		toRemove := make([]string, 0)
-
-		for k := range obj {
-			if FindString(k, allowed) == -1 {
-				toRemove = append(toRemove, k)
-			}
-		}
-
-		for _, k := range toRemove {
-			delete(obj, k)
-		}
-
-		if data != nil {
-			data[0] = obj
-		}
-
-		for i := 1; i < count; i++ {
-			obj = jsonMap(raw.Index(i).Interface())
-
-			for _, k := range toRemove {
-				delete(obj, k)
-			}
-
-			if data != nil {
-				data[i] = obj
-			}
-		}
-
-		return e.Encode(data)
-	}
-
-	obj := jsonMap(objects)
-	toRemove := make([]string, 0)
-
-	for k := range obj {
-		if FindString(k, allowed) == -1 {
-			toRemove = append(toRemove, k)
-		}
-	}
+	return jsonEncode(e, objects, newAllowedSet(allowed), nil)
+}
 
-	for _, k := range toRemove {
-		delete(obj, k)
+// jsonEncode encodes the allowed fields (visible to the roles) of the models with the Encoder.
+// The Encoder's writer is not accessible, so the output goes through Encode() as a json.RawMessage,
+// which applies the Encoder's SetIndent() settings at the cost of scanning the output again (see writeJSONEncode).
+func jsonEncode(e *json.Encoder, objects interface{}, set *allowedSet, roles *roleSet) error {
+	buf := jsonBufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		jsonBufferPool.Put(buf)
+	}()
+	if err := appendJSONEncode(buf, objects, set, roles); err != nil {
+		return err
 	}
-
-	return e.Encode(obj)
+	return e.Encode(json.RawMessage(buf.Bytes()))
 }
 
-// jsonMap converts an object to a map of string interfaces
-func jsonMap(obj interface{}) map[string]interface{} {
-	fieldValues := make(map[string]interface{})
-
-	var s, stringPointer reflect.Value
-
-	// Dereference the obj if it is a pointer
-	if reflect.ValueOf(obj).Kind() == reflect.Pointer {
-		stringPointer = reflect.ValueOf(obj)
-		s = stringPointer.Elem()
-	} else {
-		s = reflect.ValueOf(obj)
-		// stringPointer = reflect.ValueOf(&obj)
+// writeJSONEncode writes the output of JSONEncode (with a trailing newline) directly to the writer
+func writeJSONEncode(w io.Writer, objects interface{}, set *allowedSet, roles *roleSet) error {
+	buf := jsonBufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		jsonBufferPool.Put(buf)
+	}()
+	if err := appendJSONEncode(buf, objects, set, roles); err != nil {
+		return err
 	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
 
-	typeOfT := s.Type()
-	for i := 0; i < typeOfT.NumField(); i++ {
-		structField := typeOfT.Field(i)
-		fieldName := structField.Name
-		if fieldName[0] != strings.ToUpper(string(fieldName[0]))[0] {
-			continue
-		}
-
-		// Exclude any field starting with an underscore
-		if strings.Index(fieldName, "_") == 0 {
-			continue
-		}
-		val := s.Field(i)
-		// Check for embedded types
-		if structField.Anonymous {
-			subFields := jsonMap(val.Interface())
-			for k, v := range subFields {
-				fieldValues[k] = v
-			}
-			continue
-		}
-		key := SnakeCase(fieldName)
-		comps := strings.Split(key, ",")
-		key = comps[0]
-		fieldType := structField.Type
-		if fieldType.Kind() != reflect.Pointer && val.CanAddr() {
-			// fieldType = reflect.PointerTo(fieldType)
-			val = val.Addr()
-		}
-		fieldValues[key] = val.Interface()
+// appendJSONEncode writes the allowed fields (visible to the roles) of the models, an empty list is always []
+func appendJSONEncode(buf *bytes.Buffer, objects interface{}, set *allowedSet, roles *roleSet) error {
+	if val := reflect.ValueOf(objects); val.Kind() == reflect.Slice && val.Len() == 0 {
+		buf.WriteString("[]")
+		return nil
 	}
-
-	return fieldValues
+	return writeAllowedJSON(buf, objects, set, jsonEncodeMode, roles)
 }
 
 // RespondWith writes a JSON response with the specified status code and data to the ResponseWriter.
@@ -224,29 +132,35 @@ func jsonMap(obj interface{}) map[string]interface{} {
 // If data is an error, it responds with a JSON object {"error": <error message>}.
 // If data is nil and the status is an error (>= 400), it responds with {"error": <StatusText>, "code": <status>}.
 // If the status is 204 (No Content) or 304 (Not Modified), no response body is sent.
+// A localized *APIError (see ErrorCatalog.RegisterMessages) sets the Content-Language header.
+// A *ValidationError (or an error wrapping one) responds with 422 and {"error": <message>, "fields": [...]}.
+//
+// If the Router has ProblemDetails enabled, errors (and nil data) with an error status are written
+// as application/problem+json (RFC 9457) instead.
 //
 // This function ensures a single response per request and is safe for use in HTTP handlers.
-func RespondWith(w http.ResponseWriter, _ *http.Request, status int, data interface{}) {
+func RespondWith(w http.ResponseWriter, req *http.Request, status int, data interface{}) {
 	// If no content is expected, send just the status and no "body"
 	if status == http.StatusNoContent || status == http.StatusNotModified {
 		w.WriteHeader(status)
 		return
 	}
 
-	// Convert error to a JSON error payload for better readability
-	if err, ok := data.(error); ok && err != nil {
-		data = map[string]interface{}{errorJSONField: err.Error()}
-	}
-	// Provide a default body for error status codes with no data
-	if data == nil && status >= 400 {
-		data = map[string]interface{}{
-			errorJSONField: http.StatusText(status),
-			"code":         status,
-		}
+	// Localized errors set the language
+	setContentLanguage(w.Header(), data)
+
+	// Validation errors are always unprocessable
+	status = validationStatus(status, data)
+
+	// Use problem details for errors (if enabled)
+	if useProblemDetails(req, status, data) {
+		err, _ := data.(error)
+		RespondProblem(w, req, status, err)
+		return
 	}
 
 	// Serialize data to JSON
-	responseBody, err := json.Marshal(data)
+	responseBody, err := json.Marshal(responseData(status, data))
 	if err != nil {
 		// If serialization fails, respond with a generic error message
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -261,3 +175,22 @@ func RespondWith(w http.ResponseWriter, _ *http.Request, status int, data interf
 	w.WriteHeader(status)
 	_, _ = w.Write(responseBody)
 }
+
+// responseData converts errors to an error payload and provides a default body for error status codes with no data
+func responseData(status int, data interface{}) interface{} {
+	// Convert error to a JSON error payload for better readability
+	if err, ok := data.(error); ok && err != nil {
+		if validationErr, found := validationError(err); found {
+			return map[string]interface{}{errorJSONField: err.Error(), validationFieldsJSONField: validationErr.Fields}
+		}
+		return map[string]interface{}{errorJSONField: err.Error()}
+	}
+	// Provide a default body for error status codes with no data
+	if data == nil && status >= 400 {
+		return map[string]interface{}{
+			errorJSONField: http.StatusText(status),
+			"code":         status,
+		}
+	}
+	return data
+}
@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -383,6 +384,233 @@ func TestJSONEncode(t *testing.T) {
 	})
 }
 
+// testEncodeAddress is a nested struct for the json tag tests
+type testEncodeAddress struct {
+	City    string `json:"city"`
+	Country string `json:"country"`
+}
+
+// testEncodeProfile is a nested struct for the json tag tests
+type testEncodeProfile struct {
+	Address testEncodeAddress `json:"address"`
+	Bio     string            `json:"bio"`
+}
+
+// testEncodeUser is the struct for the json tag tests
+type testEncodeUser struct {
+	Balance  int64               `json:"balance,string"`
+	Friends  []*testEncodeUser   `json:"friends,omitempty"`
+	Nickname string              `json:"nickname,omitempty"`
+	Password string              `json:"-"`
+	Profile  *testEncodeProfile  `json:"profile"`
+	Previous []testEncodeProfile `json:"previous"`
+	UserID   uint64              `json:"id"`
+	Verified *bool               `json:"verified,string"`
+}
+
+// TestJSONEncode_Tags tests that JSONEncode honors the json tags and dotted paths
+func TestJSONEncode_Tags(t *testing.T) {
+	t.Parallel()
+
+	verified := true
+	newUser := func() *testEncodeUser {
+		return &testEncodeUser{
+			Balance:  250,
+			Password: "secret",
+			Profile:  &testEncodeProfile{Address: testEncodeAddress{City: "Rome", Country: "IT"}, Bio: "hello"},
+			Previous: []testEncodeProfile{{Address: testEncodeAddress{City: "Paris", Country: "FR"}, Bio: "old"}},
+			UserID:   7,
+			Verified: &verified,
+		}
+	}
+	encode := func(t *testing.T, objects interface{}, allowed []string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		require.NoError(t, JSONEncode(json.NewEncoder(&buf), objects, allowed))
+		return buf.String()
+	}
+
+	t.Run("tag names, ignored fields and options", func(t *testing.T) {
+		require.JSONEq(t,
+			`{"balance":"250","id":7,"verified":"true"}`,
+			encode(t, newUser(), []string{"balance", "friends", "id", "nickname", "password", "Password", "user_id", "verified"}),
+		)
+	})
+
+	t.Run("omitempty keeps non-empty values", func(t *testing.T) {
+		user := newUser()
+		user.Nickname = "sam"
+		user.Verified = nil
+		require.JSONEq(t, `{"nickname":"sam","verified":null}`, encode(t, user, []string{"nickname", "verified"}))
+	})
+
+	t.Run("dotted paths", func(t *testing.T) {
+		require.JSONEq(t,
+			`{"id":7,"profile":{"address":{"city":"Rome"}},"previous":[{"bio":"old"}]}`,
+			encode(t, newUser(), []string{"id", "profile.address.city", "previous.bio"}),
+		)
+	})
+
+	t.Run("whole field wins over its paths", func(t *testing.T) {
+		expected := `{"profile":{"address":{"city":"Rome","country":"IT"},"bio":"hello"}}`
+		require.JSONEq(t, expected, encode(t, newUser(), []string{"profile.bio", "profile"}))
+		require.JSONEq(t, expected, encode(t, newUser(), []string{"profile", "profile.bio"}))
+	})
+
+	t.Run("dotted paths of a slice and nil values", func(t *testing.T) {
+		user := newUser()
+		user.Friends = []*testEncodeUser{{UserID: 8, Password: "secret"}, nil}
+		other := newUser()
+		other.Profile = nil
+		require.JSONEq(t,
+			`[{"friends":[{"id":8},null],"profile":{"bio":"hello"}},{"profile":null}]`,
+			encode(t, []*testEncodeUser{user, other}, []string{"friends.id", "profile.bio"}),
+		)
+	})
+
+	t.Run("untagged fields use snake case names", func(t *testing.T) {
+		type account struct {
+			AccountID int
+			Owner     *testEncodeUser
+			Settings  struct {
+				DarkMode bool
+				Language string `json:"lang"`
+			}
+		}
+		item := &account{AccountID: 3, Owner: newUser()}
+		item.Settings.DarkMode = true
+		item.Settings.Language = "en"
+
+		require.JSONEq(t,
+			`{"account_id":3,"owner":{"id":7},"settings":{"dark_mode":true}}`,
+			encode(t, item, []string{"account_id", "AccountID", "owner.id", "settings.dark_mode"}),
+		)
+
+		// Values allowed whole are written as encoding/json writes them
+		require.JSONEq(t, `{"settings":{"DarkMode":true,"lang":"en"}}`, encode(t, item, []string{"settings"}))
+
+		// AllowedKeys trees use the field names of encoding/json, and their []string values the names of JSONEncode
+		var buf bytes.Buffer
+		require.NoError(t, JSONEncodeHierarchy(&buf, item, AllowedKeys{"AccountID": nil, "account_id": nil, "Settings": []string{"lang", "dark_mode"}}))
+		require.Equal(t, `{"AccountID":3,"Settings":{"dark_mode":true,"lang":"en"}}`+"\n", buf.String())
+
+		buf.Reset()
+		require.NoError(t, JSONEncodeHierarchy(&buf, item, []string{"settings.lang", "account_id"}))
+		require.Equal(t, `{"account_id":3,"settings":{"lang":"en"}}`+"\n", buf.String())
+	})
+
+	t.Run("hierarchy keeps the names of untagged fields", func(t *testing.T) {
+		type person struct {
+			FirstName string
+			ID        int `json:"id"`
+		}
+		var buf bytes.Buffer
+		require.NoError(t, JSONEncodeHierarchy(&buf, &person{FirstName: "Ana", ID: 1}, AllowedKeys{"FirstName": nil, "id": nil}))
+		require.Equal(t, `{"FirstName":"Ana","id":1}`+"\n", buf.String())
+	})
+
+	t.Run("hierarchy", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, JSONEncodeHierarchy(&buf, newUser(), AllowedKeys{
+			"balance":  nil,
+			"id":       nil,
+			"password": nil,
+			"profile":  []string{"address.country"},
+		}))
+		require.JSONEq(t, `{"balance":"250","id":7,"profile":{"address":{"country":"IT"}}}`, buf.String())
+
+		buf.Reset()
+		require.NoError(t, JSONEncodeHierarchy(&buf, newUser(), []string{"id", "profile.bio"}))
+		require.JSONEq(t, `{"id":7,"profile":{"bio":"hello"}}`, buf.String())
+	})
+}
+
+// errTestWrite is returned by testFailingWriter
+var errTestWrite = errors.New("write failed")
+
+// testFailingWriter is a writer that always fails
+type testFailingWriter struct{}
+
+// Write returns errTestWrite
+func (testFailingWriter) Write([]byte) (int, error) {
+	return 0, errTestWrite
+}
+
+// TestJSONEncodeHierarchy_Values tests hierarchical filtering of slices, maps, pointers, interfaces and nil values
+func TestJSONEncodeHierarchy_Values(t *testing.T) {
+	t.Parallel()
+
+	type Item struct {
+		Created time.Time   `json:"created"`
+		Data    []byte      `json:"data"`
+		Extra   interface{} `json:"extra"`
+		ID      int         `json:"id"`
+		Name    string      `json:"name,omitempty"`
+		Price   float64     `json:"price,string"`
+	}
+
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	items := []*Item{
+		{Created: created, Data: []byte("hi"), Extra: &Item{ID: 9, Name: "<b>"}, ID: 1, Name: "a&b", Price: 1.5},
+		nil,
+		{ID: 2},
+	}
+	encode := func(t *testing.T, objects, allowed interface{}) string {
+		t.Helper()
+		var buf bytes.Buffer
+		require.NoError(t, JSONEncodeHierarchy(&buf, objects, allowed))
+		return buf.String()
+	}
+	marshal := func(t *testing.T, v interface{}) string {
+		t.Helper()
+		var buf bytes.Buffer
+		require.NoError(t, json.NewEncoder(&buf).Encode(v))
+		return buf.String()
+	}
+
+	t.Run("identical to encoding/json when everything is allowed", func(t *testing.T) {
+		allowed := AllowedKeys{"created": nil, "data": nil, "extra": nil, "id": nil, "name": nil, "price": nil}
+		require.Equal(t, marshal(t, items), encode(t, items, allowed))
+		require.Equal(t, marshal(t, items[0]), encode(t, items[0], []string{"created", "data", "extra", "id", "name", "price"}))
+	})
+
+	t.Run("slices filter each element", func(t *testing.T) {
+		require.Equal(t, "[{\"id\":1,\"name\":\"a\\u0026b\"},null,{\"id\":2}]\n", encode(t, items, []string{"id", "name"}))
+	})
+
+	t.Run("interfaces and pointers", func(t *testing.T) {
+		require.Equal(t,
+			"{\"extra\":{\"name\":\"\\u003cb\\u003e\"},\"id\":1}\n",
+			encode(t, items[0], AllowedKeys{"extra": []string{"name"}, "id": nil}),
+		)
+		require.Equal(t, "null\n", encode(t, (*Item)(nil), AllowedKeys{"id": nil}))
+		require.Equal(t, "null\n", encode(t, nil, AllowedKeys{"id": nil}))
+		require.Equal(t, "{\"extra\":null}\n", encode(t, items[2], AllowedKeys{"extra": AllowedKeys{"id": nil}}))
+	})
+
+	t.Run("maps filter their keys", func(t *testing.T) {
+		byName := map[string]*Item{"first": items[0], "second": items[2], "hidden": {ID: 3}}
+		require.Equal(t,
+			"{\"first\":{\"id\":1},\"second\":{\"id\":2}}\n",
+			encode(t, byName, AllowedKeys{"second": []string{"id"}, "first": map[string]interface{}{"id": nil}}),
+		)
+		require.Equal(t, marshal(t, map[int]string{2: "b", 10: "c"}), encode(t, map[int]string{1: "a", 2: "b", 10: "c"}, []string{"2", "10"}))
+		require.Equal(t, "null\n", encode(t, map[string]int(nil), []string{"a"}))
+	})
+
+	t.Run("errors instead of panics", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.ErrorIs(t, JSONEncodeHierarchy(&buf, items[0], AllowedKeys{"id": 123}), ErrInvalidAllowedFields)
+
+		var unsupported *json.UnsupportedTypeError
+		require.ErrorAs(t, JSONEncodeHierarchy(&buf, map[string]interface{}{"c": make(chan int)}, []string{"c"}), &unsupported)
+		require.ErrorAs(t, JSONEncodeHierarchy(&buf, map[[2]int]int{{1, 2}: 3}, []string{"x"}), &unsupported)
+		require.Empty(t, buf.String())
+
+		require.ErrorIs(t, JSONEncodeHierarchy(testFailingWriter{}, items, []string{"id"}), errTestWrite)
+	})
+}
+
 // TestRespondWith tests the RespondWith function
 func TestRespondWith(t *testing.T) {
 	tests := []struct {
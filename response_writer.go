@@ -1,17 +1,31 @@
 package apirouter
 
 import (
+	"bufio"
 	"bytes"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/julienschmidt/httprouter"
 )
 
 // APIResponseWriter wraps the ResponseWriter and stores the status of the request.
 // It is used by the LogRequest middleware
+//
+// The optional http.Flusher, http.Hijacker and io.ReaderFrom interfaces are passed through to the
+// underlying writer, and Unwrap() allows the use of http.ResponseController.
+//
+// The methods are always present, so a w.(http.Flusher) or w.(http.Hijacker) check is always true. Check the support with
+// http.NewResponseController(w) instead: its Flush() and Hijack() return an error wrapping http.ErrNotSupported when the
+// underlying writer cannot flush or be hijacked. Flush() does nothing in that case, use FlushError() to get the error.
 type APIResponseWriter struct {
 	http.ResponseWriter
 
 	Buffer          bytes.Buffer  `json:"-" url:"-"`
+	BytesWritten    int64         `json:"bytes_written" url:"bytes_written"`
 	CacheIdentifier []string      `json:"cache_identifier" url:"cache_identifier"`
 	CacheTTL        time.Duration `json:"cache_ttl" url:"cache_ttl"`
 	IPAddress       string        `json:"ip_address" url:"ip_address"`
@@ -19,8 +33,25 @@ type APIResponseWriter struct {
 	NoWrite         bool          `json:"no_write" url:"no_write"`
 	RequestID       string        `json:"request_id" url:"request_id"`
 	Status          int           `json:"status" url:"status"`
+	TimeToFirstByte time.Duration `json:"time_to_first_byte" url:"time_to_first_byte"`
 	URL             string        `json:"url" url:"url"`
 	UserAgent       string        `json:"user_agent" url:"user_agent"`
+	acceptLanguage  string        // The Accept-Language of the request, for the public messages of ErrorFromResponse()
+	compressor      *responseCompressor
+	errorLogger     *errorLogger
+	headerHooks     []func(status int)
+	hijacked        bool
+	start           time.Time
+	statusSet       bool
+	wroteHeader     bool
+}
+
+// writeFunc adapts a function to io.Writer
+type writeFunc func(data []byte) (int, error)
+
+// Write calls the function
+func (f writeFunc) Write(data []byte) (int, error) {
+	return f(data)
 }
 
 // AddCacheIdentifier add cache identifier to the response writer
@@ -41,12 +72,33 @@ func (r *APIResponseWriter) Header() http.Header {
 	return r.ResponseWriter.Header()
 }
 
-// WriteHeader will write the header to the client, setting the status code
+// WriteHeader will write the header to the client, setting the status code.
+// Only the first call sets the status (matching net/http), except for informational (1xx) responses.
 func (r *APIResponseWriter) WriteHeader(status int) {
+	// Informational responses (IE: 103 Early Hints) can be sent before the final status
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		if !r.NoWrite && !r.wroteHeader {
+			r.ResponseWriter.WriteHeader(status)
+		}
+		return
+	}
+
+	if r.statusSet {
+		return
+	}
 	r.Status = status
-	if !r.NoWrite {
-		r.ResponseWriter.WriteHeader(status)
+	r.statusSet = true
+	if r.NoWrite || r.hijacked {
+		return
+	}
+
+	// Compression may need to see the body before the headers can be sent
+	if r.compressor != nil && !r.compressor.decided {
+		_ = r.commitCompression(false)
+		return
 	}
+
+	r.sendHeader()
 }
 
 // Write writes the data out to the client, if WriteHeader was not called, it will write status http.StatusOK (200)
@@ -54,10 +106,259 @@ func (r *APIResponseWriter) Write(data []byte) (int, error) {
 	if r.Status == 0 {
 		r.Status = http.StatusOK
 	}
+	r.statusSet = true
 
 	if r.NoWrite {
 		return r.Buffer.Write(data)
 	}
 
-	return r.ResponseWriter.Write(data)
+	if c := r.compressor; c != nil {
+		// Buffer until we know if compression is worthwhile
+		if !c.decided {
+			c.pending = append(c.pending, data...)
+			return len(data), r.commitCompression(false)
+		}
+		if c.writer != nil {
+			return c.writer.Write(data)
+		}
+	}
+
+	// The underlying writer sends the headers on the first write
+	r.markHeaderSent(r.Status)
+	return r.writeBody(data)
+}
+
+// Flush sends any buffered data to the client (http.Flusher), doing nothing if the underlying writer cannot flush
+// (see FlushError)
+func (r *APIResponseWriter) Flush() {
+	_ = r.FlushError()
+}
+
+// FlushError sends any buffered data to the client and returns an error if the underlying writer cannot flush.
+// A pending compression decision is made immediately, since the response is being streamed.
+func (r *APIResponseWriter) FlushError() error {
+	if r.NoWrite || r.hijacked {
+		return nil
+	}
+
+	// Flushing commits the headers (200 if not set)
+	if r.Status == 0 {
+		r.Status = http.StatusOK
+	}
+	r.statusSet = true
+
+	if c := r.compressor; c != nil {
+		if !c.decided {
+			if err := r.commitCompression(true); err != nil {
+				return err
+			}
+		}
+		if c.writer != nil {
+			if err := c.writer.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	r.sendHeader()
+	return http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// Hijack lets the caller take over the connection (http.Hijacker), IE: WebSocket upgrades.
+// An error wrapping http.ErrNotSupported is returned if the underlying writer cannot be hijacked.
+func (r *APIResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The connection now belongs to the caller, so nothing else will be written
+	r.hijacked = true
+	r.compressor = nil
+	if r.Status == 0 {
+		r.Status = http.StatusSwitchingProtocols
+	}
+	r.statusSet = true
+	r.markHeaderSent(r.Status)
+	return conn, rw, nil
+}
+
+// ReadFrom copies the reader to the response (io.ReaderFrom), using the underlying writer's ReadFrom
+// (IE: sendfile) when the response is not being buffered or compressed
+func (r *APIResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	readerFrom, ok := r.ResponseWriter.(io.ReaderFrom)
+	if !ok || r.NoWrite || (r.compressor != nil && (!r.compressor.decided || r.compressor.writer != nil)) {
+		// Hide ReadFrom from io.Copy so it uses Write
+		return io.Copy(writeFunc(r.Write), src)
+	}
+
+	if r.Status == 0 {
+		r.Status = http.StatusOK
+	}
+	r.statusSet = true
+	r.sendHeader()
+
+	n, err := readerFrom.ReadFrom(src)
+	r.BytesWritten += n
+	return n, err
+}
+
+// Unwrap returns the underlying writer (used by http.ResponseController)
+func (r *APIResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// commitCompression decides if the response will be compressed, then sends the headers and any pending data.
+// Unless final is set, the decision is deferred while the response size is unknown and under the minimum size.
+func (r *APIResponseWriter) commitCompression(final bool) error {
+	c := r.compressor
+	header := r.Header()
+
+	// The size is known up front if the handler set the Content-Length (IE: RespondWith)
+	size, sizeKnown := len(c.pending), false
+	if length, err := strconv.Atoi(header.Get(contentLengthHeader)); err == nil {
+		size, sizeKnown = length, true
+	}
+
+	// Skip responses without a body or that are already encoded
+	compress := r.Status >= http.StatusOK &&
+		r.Status != http.StatusNoContent &&
+		r.Status != http.StatusNotModified &&
+		len(header.Get(contentEncodingHeader)) == 0
+
+	if compress && size < c.minSize {
+		if !final && !sizeKnown {
+			return nil
+		}
+		compress = false
+	}
+
+	if compress {
+		// Sniff the content type now, net/http cannot once the body is compressed
+		if len(header.Get(contentTypeHeader)) == 0 {
+			if len(c.pending) == 0 && !final {
+				return nil
+			}
+			header.Set(contentTypeHeader, http.DetectContentType(c.pending))
+		}
+		compress = matchContentType(header.Get(contentTypeHeader), c.contentTypes)
+	}
+
+	// Send the headers
+	c.decided = true
+	if compress {
+		header.Del(contentLengthHeader)
+		header.Set(contentEncodingHeader, c.encoding)
+		c.writer = getCompressWriter(c.encoding, c.level, writeFunc(r.writeBody))
+	}
+	r.sendHeader()
+
+	// Send anything that was buffered
+	pending := c.pending
+	c.pending = nil
+	if len(pending) == 0 {
+		return nil
+	}
+	var err error
+	if c.writer != nil {
+		_, err = c.writer.Write(pending)
+	} else {
+		_, err = r.writeBody(pending)
+	}
+	return err
+}
+
+// sendHeader sends the status to the client once
+func (r *APIResponseWriter) sendHeader() {
+	if !r.markHeaderSent(r.Status) {
+		r.ResponseWriter.WriteHeader(r.Status)
+	}
+}
+
+// writeBody writes to the underlying writer and counts the bytes sent
+func (r *APIResponseWriter) writeBody(data []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(data)
+	r.BytesWritten += int64(n)
+	return n, err
+}
+
+// onWriteHeader registers a hook that runs once, right before the headers are sent to the client
+func (r *APIResponseWriter) onWriteHeader(hook func(status int)) {
+	r.headerHooks = append(r.headerHooks, hook)
+}
+
+// markHeaderSent runs the header hooks the first time the headers are sent and reports if they were already sent
+func (r *APIResponseWriter) markHeaderSent(status int) (alreadySent bool) {
+	if r.wroteHeader {
+		return true
+	}
+	r.wroteHeader = true
+	if !r.start.IsZero() {
+		r.TimeToFirstByte = time.Since(r.start)
+	}
+
+	hooks := r.headerHooks
+	r.headerHooks = nil
+	for _, hook := range hooks {
+		hook(status)
+	}
+	return false
+}
+
+// finish sends any buffered data and releases the compressor once the handler has returned
+func (r *APIResponseWriter) finish() {
+	c := r.compressor
+	if c == nil {
+		return
+	}
+
+	// Nothing was written if there is no status
+	if !c.decided && r.Status != 0 {
+		_ = r.commitCompression(true)
+	}
+
+	if c.writer != nil {
+		_ = c.writer.Close()
+		putCompressWriter(c.encoding, c.level, c.writer)
+		c.writer = nil
+	}
+	r.compressor = nil
+}
+
+// bufferResponse runs the handler with writing disabled and returns the status and body it produced.
+// The writer is restored afterward, leaving the caller to decide what gets written to the client.
+func (r *APIResponseWriter) bufferResponse(h httprouter.Handle, req *http.Request, ps httprouter.Params) (int, []byte) {
+	// Save the state of the writer (an outer middleware might be buffering as well)
+	noWrite, status, statusSet, buffer := r.NoWrite, r.Status, r.statusSet, r.Buffer
+	r.NoWrite, r.Status, r.statusSet, r.Buffer = true, 0, false, bytes.Buffer{}
+
+	// Restore the writer, even if the handler panics
+	defer func() {
+		r.NoWrite, r.statusSet, r.Buffer = noWrite, statusSet, buffer
+	}()
+
+	h(r, req, ps)
+
+	bufferedStatus := r.Status
+	r.Status = status
+	return bufferedStatus, r.Buffer.Bytes()
+}
+
+// writeBuffered writes a buffered status and body through the writer
+func (r *APIResponseWriter) writeBuffered(status int, body []byte) {
+	if status == 0 {
+		return
+	}
+	r.WriteHeader(status)
+	if len(body) > 0 {
+		_, _ = r.Write(body)
+	}
+}
+
+// responseWriterFor returns the APIResponseWriter, wrapping the writer if needed (IE: used outside Request())
+func responseWriterFor(w http.ResponseWriter) *APIResponseWriter {
+	if writer, ok := w.(*APIResponseWriter); ok {
+		return writer
+	}
+	return &APIResponseWriter{ResponseWriter: w}
 }
@@ -1,8 +1,15 @@
 package apirouter
 
 import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -115,3 +122,195 @@ func TestAPIResponseWriter_Write(t *testing.T) {
 		mockWriter.AssertExpectations(t)
 	})
 }
+
+// hijackableRecorder is a ResponseRecorder that supports Hijack and ReadFrom
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+
+	conn     net.Conn
+	readFrom bool
+}
+
+// Hijack returns the test connection
+func (h *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.conn, bufio.NewReadWriter(bufio.NewReader(h.conn), bufio.NewWriter(h.conn)), nil
+}
+
+// ReadFrom records that the optimized path was used
+func (h *hijackableRecorder) ReadFrom(src io.Reader) (int64, error) {
+	h.readFrom = true
+	return io.Copy(h.ResponseRecorder, src)
+}
+
+// TestAPIResponseWriter_WriteHeaderOnce tests that only the first status is sent
+func TestAPIResponseWriter_WriteHeaderOnce(t *testing.T) {
+	t.Parallel()
+
+	t.Run("second call is ignored", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		w := &APIResponseWriter{ResponseWriter: rr}
+		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(http.StatusInternalServerError)
+		require.Equal(t, http.StatusCreated, w.Status)
+		require.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("write header after write is ignored", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		w := &APIResponseWriter{ResponseWriter: rr}
+		_, err := w.Write([]byte("body"))
+		require.NoError(t, err)
+		w.WriteHeader(http.StatusBadRequest)
+		require.Equal(t, http.StatusOK, w.Status)
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("informational responses do not set the status", func(t *testing.T) {
+		mockWriter := &MockResponseWriter{}
+		mockWriter.On("WriteHeader", http.StatusEarlyHints).Return()
+		mockWriter.On("WriteHeader", http.StatusAccepted).Return()
+
+		w := &APIResponseWriter{ResponseWriter: mockWriter}
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusAccepted)
+		require.Equal(t, http.StatusAccepted, w.Status)
+		mockWriter.AssertExpectations(t)
+	})
+}
+
+// TestAPIResponseWriter_BytesWritten tests the byte count and time to first byte
+func TestAPIResponseWriter_BytesWritten(t *testing.T) {
+	t.Parallel()
+
+	rr := httptest.NewRecorder()
+	w := &APIResponseWriter{ResponseWriter: rr, start: time.Now().Add(-time.Second)}
+	_, err := w.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte(" world"))
+	require.NoError(t, err)
+
+	require.Equal(t, int64(11), w.BytesWritten)
+	require.GreaterOrEqual(t, w.TimeToFirstByte, time.Second)
+}
+
+// TestAPIResponseWriter_Flush tests Flush() and FlushError()
+func TestAPIResponseWriter_Flush(t *testing.T) {
+	t.Parallel()
+
+	t.Run("flushes the underlying writer", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		w := &APIResponseWriter{ResponseWriter: rr}
+		_, err := w.Write([]byte("data"))
+		require.NoError(t, err)
+
+		var flusher http.Flusher = w
+		flusher.Flush()
+		require.True(t, rr.Flushed)
+	})
+
+	t.Run("flush sends the headers", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		w := &APIResponseWriter{ResponseWriter: rr}
+		require.NoError(t, http.NewResponseController(w).Flush())
+		require.Equal(t, http.StatusOK, w.Status)
+		require.True(t, rr.Flushed)
+	})
+
+	t.Run("flush is not supported", func(t *testing.T) {
+		mockWriter := &MockResponseWriter{}
+		mockWriter.On("WriteHeader", http.StatusOK).Return()
+		w := &APIResponseWriter{ResponseWriter: mockWriter}
+		require.ErrorIs(t, w.FlushError(), http.ErrNotSupported)
+		require.ErrorIs(t, http.NewResponseController(w).Flush(), http.ErrNotSupported)
+	})
+
+	t.Run("flush streams compressed data", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		w := &APIResponseWriter{ResponseWriter: rr, compressor: &responseCompressor{
+			contentTypes: []string{"text/plain"},
+			encoding:     encodingGzip,
+			level:        gzip.DefaultCompression,
+		}}
+		w.Header().Set(contentTypeHeader, "text/plain")
+		_, err := w.Write([]byte("streamed"))
+		require.NoError(t, err)
+		w.Flush()
+		require.Equal(t, encodingGzip, rr.Header().Get(contentEncodingHeader))
+		require.Positive(t, rr.Body.Len())
+		require.Equal(t, int64(rr.Body.Len()), w.BytesWritten)
+
+		w.finish()
+		gz, err := gzip.NewReader(rr.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		require.Equal(t, "streamed", string(body))
+	})
+}
+
+// TestAPIResponseWriter_Hijack tests Hijack()
+func TestAPIResponseWriter_Hijack(t *testing.T) {
+	t.Parallel()
+
+	t.Run("hijack is not supported", func(t *testing.T) {
+		w := &APIResponseWriter{ResponseWriter: httptest.NewRecorder()}
+		_, _, err := w.Hijack()
+		require.ErrorIs(t, err, http.ErrNotSupported)
+	})
+
+	t.Run("hijack passes through", func(t *testing.T) {
+		server, client := net.Pipe()
+		defer func() {
+			_ = server.Close()
+			_ = client.Close()
+		}()
+
+		w := &APIResponseWriter{ResponseWriter: &hijackableRecorder{ResponseRecorder: httptest.NewRecorder(), conn: server}}
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		require.NoError(t, err)
+		require.Equal(t, server, conn)
+		require.NotNil(t, rw)
+		require.Equal(t, http.StatusSwitchingProtocols, w.Status)
+
+		// Nothing else is written once hijacked
+		w.WriteHeader(http.StatusOK)
+		require.Equal(t, http.StatusSwitchingProtocols, w.Status)
+	})
+}
+
+// TestAPIResponseWriter_ReadFrom tests ReadFrom()
+func TestAPIResponseWriter_ReadFrom(t *testing.T) {
+	t.Parallel()
+
+	t.Run("uses the underlying ReadFrom", func(t *testing.T) {
+		underlying := &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}
+		w := &APIResponseWriter{ResponseWriter: underlying}
+		n, err := w.ReadFrom(strings.NewReader("copied"))
+		require.NoError(t, err)
+		require.Equal(t, int64(6), n)
+		require.True(t, underlying.readFrom)
+		require.Equal(t, int64(6), w.BytesWritten)
+		require.Equal(t, "copied", underlying.Body.String())
+	})
+
+	t.Run("falls back to write when buffering", func(t *testing.T) {
+		underlying := &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}
+		w := &APIResponseWriter{ResponseWriter: underlying, NoWrite: true}
+		_, err := w.ReadFrom(strings.NewReader("buffered"))
+		require.NoError(t, err)
+		require.False(t, underlying.readFrom)
+		require.Equal(t, "buffered", w.Buffer.String())
+	})
+}
+
+// TestAPIResponseWriter_Unwrap tests Unwrap()
+func TestAPIResponseWriter_Unwrap(t *testing.T) {
+	t.Parallel()
+
+	rr := httptest.NewRecorder()
+	w := &APIResponseWriter{ResponseWriter: rr}
+	require.Equal(t, rr, w.Unwrap())
+
+	// The controller reaches the underlying writer through Unwrap()
+	require.ErrorIs(t, http.NewResponseController(w).SetWriteDeadline(time.Time{}), http.ErrNotSupported)
+}
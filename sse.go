@@ -0,0 +1,181 @@
+package apirouter
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server-Sent Events headers and defaults
+const (
+	eventStreamContentType string = "text/event-stream"
+	lastEventIDHeader      string = "Last-Event-ID"
+	lastEventIDParam       string = "lastEventId"
+	xAccelBufferingHeader  string = "X-Accel-Buffering"
+	defaultSSEHeartbeat           = 15 * time.Second
+	sseCacheControl        string = "no-cache"
+	sseHeartbeatComment    string = ": heartbeat\n\n"
+	sseLineBreaks          string = "\r\n"
+)
+
+// SSEEvent is a single Server-Sent Event
+type SSEEvent struct {
+	Data  string        `json:"data" url:"data"`   // Event payload (may contain multiple lines)
+	Event string        `json:"event" url:"event"` // Event name (IE: progress), empty is "message"
+	ID    string        `json:"id" url:"id"`       // Event id, sent back by the client as Last-Event-ID when reconnecting
+	Retry time.Duration `json:"retry" url:"retry"` // Reconnection delay for the client
+}
+
+// SSEOptions is the configuration for an SSEStream
+type SSEOptions struct {
+	Heartbeat time.Duration `json:"heartbeat" url:"heartbeat"` // Interval for keep-alive comments in Stream() (default 15s, negative disables)
+	Retry     time.Duration `json:"retry" url:"retry"`         // Reconnection delay sent when the stream opens
+}
+
+// SSEStream writes Server-Sent Events to the client.
+// Use it inside a handler wrapped by Router.Request() and the stream is logged as a single long-lived request.
+type SSEStream struct {
+	controller  *http.ResponseController
+	heartbeat   time.Duration
+	lastEventID string
+	mu          sync.Mutex
+	req         *http.Request
+	w           http.ResponseWriter
+}
+
+// NewSSEStream starts an event stream by sending the headers (and optional retry) to the client.
+// ErrStreamingNotSupported is returned if the response writer cannot be flushed.
+func NewSSEStream(w http.ResponseWriter, req *http.Request, options SSEOptions) (*SSEStream, error) {
+	s := &SSEStream{
+		controller:  http.NewResponseController(w),
+		heartbeat:   options.Heartbeat,
+		lastEventID: req.Header.Get(lastEventIDHeader),
+		req:         req,
+		w:           w,
+	}
+	if s.heartbeat == 0 {
+		s.heartbeat = defaultSSEHeartbeat
+	}
+
+	// Polyfills that cannot set headers pass the last id in the query string
+	if len(s.lastEventID) == 0 {
+		s.lastEventID = req.URL.Query().Get(lastEventIDParam)
+	}
+
+	header := w.Header()
+	header.Set(contentTypeHeader, eventStreamContentType)
+	header.Set(cacheControlHeader, sseCacheControl)
+	header.Set(xAccelBufferingHeader, "no") // Disable proxy buffering (nginx)
+	header.Del(contentLengthHeader)
+
+	// The stream is long-lived, so remove any server write timeout (if supported)
+	_ = s.controller.SetWriteDeadline(time.Time{})
+
+	w.WriteHeader(http.StatusOK)
+	if options.Retry > 0 {
+		if _, err := w.Write([]byte("retry: " + strconv.FormatInt(options.Retry.Milliseconds(), 10) + "\n\n")); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.controller.Flush(); err != nil {
+		return nil, ErrStreamingNotSupported
+	}
+	return s, nil
+}
+
+// LastEventID returns the id of the last event the client received (for resuming the stream)
+func (s *SSEStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Send writes the event to the client and flushes it
+func (s *SSEStream) Send(event SSEEvent) error {
+	if strings.ContainsAny(event.ID, sseLineBreaks) || strings.ContainsAny(event.Event, sseLineBreaks) {
+		return ErrInvalidEventField
+	}
+
+	var b strings.Builder
+	if len(event.ID) > 0 {
+		b.WriteString("id: ")
+		b.WriteString(event.ID)
+		b.WriteString("\n")
+	}
+	if len(event.Event) > 0 {
+		b.WriteString("event: ")
+		b.WriteString(event.Event)
+		b.WriteString("\n")
+	}
+	if event.Retry > 0 {
+		b.WriteString("retry: ")
+		b.WriteString(strconv.FormatInt(event.Retry.Milliseconds(), 10))
+		b.WriteString("\n")
+	}
+
+	// Each line of data is its own field, the client joins them back with "\n"
+	data := strings.ReplaceAll(event.Data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	return s.write(b.String())
+}
+
+// SendJSON writes an event with the value encoded as JSON
+func (s *SSEStream) SendJSON(id, event string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.Send(SSEEvent{Data: string(data), Event: event, ID: id})
+}
+
+// Stream sends events from the channel until it is closed or the request is cancelled,
+// sending heartbeat comments while idle so proxies keep the connection open.
+// It returns nil once the channel is closed, or the context error if the client went away.
+func (s *SSEStream) Stream(events <-chan SSEEvent) error {
+	var heartbeat <-chan time.Time
+	if s.heartbeat > 0 {
+		ticker := time.NewTicker(s.heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-s.req.Context().Done():
+			return s.req.Context().Err()
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := s.Send(event); err != nil {
+				return err
+			}
+		case <-heartbeat:
+			if err := s.write(sseHeartbeatComment); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// write sends the raw text to the client and flushes it
+func (s *SSEStream) write(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.req.Context().Err(); err != nil {
+		return err
+	}
+	if _, err := s.w.Write([]byte(text)); err != nil {
+		return err
+	}
+	return s.controller.Flush()
+}
@@ -0,0 +1,154 @@
+package apirouter
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+// readSSE reads lines from the stream until the blank line ending an event
+func readSSE(t *testing.T, reader *bufio.Reader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if len(line) == 0 {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+// TestSSEStream_Send tests the event wire format
+func TestSSEStream_Send(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/events", nil)
+	rr := httptest.NewRecorder()
+
+	stream, err := NewSSEStream(rr, req, SSEOptions{Retry: 3 * time.Second})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, eventStreamContentType, rr.Header().Get(contentTypeHeader))
+	require.Equal(t, sseCacheControl, rr.Header().Get(cacheControlHeader))
+	require.True(t, rr.Flushed)
+
+	require.NoError(t, stream.Send(SSEEvent{ID: "7", Event: "progress", Data: "line one\nline two\r\nline three"}))
+	require.NoError(t, stream.Send(SSEEvent{Data: ""}))
+	require.NoError(t, stream.SendJSON("8", "done", map[string]int{"percent": 100}))
+
+	expected := "retry: 3000\n\n" +
+		"id: 7\nevent: progress\ndata: line one\ndata: line two\ndata: line three\n\n" +
+		"data: \n\n" +
+		"id: 8\nevent: done\ndata: {\"percent\":100}\n\n"
+	require.Equal(t, expected, rr.Body.String())
+
+	require.ErrorIs(t, stream.Send(SSEEvent{ID: "bad\nid"}), ErrInvalidEventField)
+	require.ErrorIs(t, stream.Send(SSEEvent{Event: "bad\revent"}), ErrInvalidEventField)
+}
+
+// TestSSEStream_LastEventID tests resuming from the Last-Event-ID
+func TestSSEStream_LastEventID(t *testing.T) {
+	t.Parallel()
+
+	t.Run("from the header", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/events", nil)
+		req.Header.Set(lastEventIDHeader, "42")
+		stream, err := NewSSEStream(httptest.NewRecorder(), req, SSEOptions{})
+		require.NoError(t, err)
+		require.Equal(t, "42", stream.LastEventID())
+	})
+
+	t.Run("from the query string", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/events?lastEventId=9", nil)
+		stream, err := NewSSEStream(httptest.NewRecorder(), req, SSEOptions{})
+		require.NoError(t, err)
+		require.Equal(t, "9", stream.LastEventID())
+	})
+}
+
+// TestNewSSEStream_NotSupported tests a writer that cannot flush
+func TestNewSSEStream_NotSupported(t *testing.T) {
+	t.Parallel()
+
+	mockWriter := &MockResponseWriter{}
+	mockWriter.On("WriteHeader", http.StatusOK).Return()
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/events", nil)
+
+	_, err := NewSSEStream(mockWriter, req, SSEOptions{})
+	require.ErrorIs(t, err, ErrStreamingNotSupported)
+}
+
+// TestSSEStream_Stream tests streaming through the Router with heartbeats and cancellation
+func TestSSEStream_Stream(t *testing.T) {
+	t.Parallel()
+
+	streamErr := make(chan error, 1)
+	router := New()
+	router.HTTPRouter.GET("/events", router.Request(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		stream, err := NewSSEStream(w, req, SSEOptions{Heartbeat: 10 * time.Millisecond})
+		if err != nil {
+			streamErr <- err
+			return
+		}
+
+		events := make(chan SSEEvent, 1)
+		events <- SSEEvent{ID: "1", Event: "job", Data: "started " + stream.LastEventID()}
+		streamErr <- stream.Stream(events)
+	}))
+
+	server := httptest.NewServer(router.HTTPRouter)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events", nil)
+	require.NoError(t, err)
+	req.Header.Set(lastEventIDHeader, "0")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	require.Equal(t, eventStreamContentType, resp.Header.Get(contentTypeHeader))
+
+	reader := bufio.NewReader(resp.Body)
+	require.Equal(t, []string{"id: 1", "event: job", "data: started 0"}, readSSE(t, reader))
+	require.Equal(t, []string{": heartbeat"}, readSSE(t, reader))
+
+	// The handler stops when the client goes away
+	cancel()
+	select {
+	case err = <-streamErr:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not stop after the client disconnected")
+	}
+}
+
+// TestSSEStream_StreamClosed tests that closing the channel ends the stream
+func TestSSEStream_StreamClosed(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/events", nil)
+	rr := httptest.NewRecorder()
+	stream, err := NewSSEStream(rr, req, SSEOptions{Heartbeat: -1})
+	require.NoError(t, err)
+
+	events := make(chan SSEEvent, 2)
+	events <- SSEEvent{Data: "a"}
+	events <- SSEEvent{Data: "b"}
+	close(events)
+
+	require.NoError(t, stream.Stream(events))
+	require.Equal(t, "data: a\n\ndata: b\n\n", rr.Body.String())
+}
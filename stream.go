@@ -0,0 +1,195 @@
+package apirouter
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"iter"
+	"net/http"
+	"time"
+)
+
+// Streaming response content types and defaults
+const (
+	ndjsonContentType          string = "application/x-ndjson"
+	defaultStreamFlushEvery           = 100
+	defaultStreamFlushInterval        = time.Second
+	streamBufferSize                  = 32 * 1024
+)
+
+// StreamFormat is the format of a streamed JSON response
+type StreamFormat int
+
+// Streaming formats
+const (
+	StreamNDJSON    StreamFormat = iota // One JSON object per line (application/x-ndjson)
+	StreamJSONArray                     // A single JSON array (application/json)
+)
+
+// StreamOptions is the configuration for StreamJSON() and StreamJSONChannel()
+type StreamOptions struct {
+	Allowed       []string      `json:"allowed" url:"allowed"`               // Allowed fields for each item, the same as JSONEncode (nil allows all)
+	FlushEvery    int           `json:"flush_every" url:"flush_every"`       // Flush after this many items (default 100)
+	FlushInterval time.Duration `json:"flush_interval" url:"flush_interval"` // Flush buffered items at least this often (default 1s)
+	Format        StreamFormat  `json:"format" url:"format"`                 // NDJSON (default) or a JSON array
+}
+
+// jsonStream writes the items of a streamed response
+type jsonStream struct {
+	allowed       *allowedSet
+	buffer        *bufio.Writer
+	controller    *http.ResponseController
+	count         int
+	flushEvery    int
+	flushInterval time.Duration
+	format        StreamFormat
+	lastFlush     time.Time
+	pending       int
+	scratch       bytes.Buffer
+}
+
+// StreamJSON writes each item from the iterator as it is produced, without holding the result set in memory.
+// Items are flushed to the client periodically, and the stream stops if the client disconnects.
+// It returns nil when the iterator is exhausted, or the context error if the client went away.
+//
+// The headers are sent before the first item, so errors after that point can only end the response early.
+func StreamJSON[T any](w http.ResponseWriter, req *http.Request, status int, items iter.Seq[T], options StreamOptions) error {
+	s := newJSONStream(w, status, options)
+	if err := s.start(); err != nil {
+		return err
+	}
+
+	ctx := req.Context()
+	for item := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.write(item); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.finish()
+}
+
+// StreamJSONChannel writes each item received from the channel until it is closed.
+// Buffered items are flushed while waiting for the channel, and the stream stops if the client disconnects.
+// It returns nil once the channel is closed, or the context error if the client went away.
+func StreamJSONChannel[T any](w http.ResponseWriter, req *http.Request, status int, items <-chan T, options StreamOptions) error {
+	s := newJSONStream(w, status, options)
+	if err := s.start(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	ctx := req.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case item, ok := <-items:
+			if !ok {
+				return s.finish()
+			}
+			if err := s.write(item); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if s.pending > 0 {
+				if err := s.flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// newJSONStream sets the headers and status for the streamed response
+func newJSONStream(w http.ResponseWriter, status int, options StreamOptions) *jsonStream {
+	s := &jsonStream{
+		buffer:        bufio.NewWriterSize(w, streamBufferSize),
+		controller:    http.NewResponseController(w),
+		flushEvery:    options.FlushEvery,
+		flushInterval: options.FlushInterval,
+		format:        options.Format,
+		lastFlush:     time.Now(),
+	}
+	if options.Allowed != nil {
+		s.allowed = newAllowedSet(options.Allowed)
+	}
+	if s.flushEvery <= 0 {
+		s.flushEvery = defaultStreamFlushEvery
+	}
+	if s.flushInterval <= 0 {
+		s.flushInterval = defaultStreamFlushInterval
+	}
+
+	header := w.Header()
+	if s.format == StreamJSONArray {
+		header.Set(contentTypeHeader, "application/json; charset=utf-8")
+	} else {
+		header.Set(contentTypeHeader, ndjsonContentType)
+	}
+	header.Del(contentLengthHeader)
+	w.WriteHeader(status)
+	return s
+}
+
+// start sends the headers (and the opening bracket for an array) so the client knows the stream has started
+func (s *jsonStream) start() error {
+	if s.format == StreamJSONArray {
+		if err := s.buffer.WriteByte('['); err != nil {
+			return err
+		}
+	}
+	return s.flush()
+}
+
+// write encodes the allowed fields of the item and flushes if enough items or time has passed
+func (s *jsonStream) write(item interface{}) error {
+	s.scratch.Reset()
+	if err := writeAllowedJSON(&s.scratch, item, s.allowed, jsonEncodeMode, nil); err != nil {
+		return err
+	}
+
+	if s.format == StreamJSONArray && s.count > 0 {
+		_ = s.buffer.WriteByte(',')
+	}
+	_, _ = s.buffer.Write(s.scratch.Bytes())
+	if s.format == StreamNDJSON {
+		_ = s.buffer.WriteByte('\n')
+	}
+	s.count++
+	s.pending++
+
+	if s.pending >= s.flushEvery || time.Since(s.lastFlush) >= s.flushInterval {
+		return s.flush()
+	}
+	return nil
+}
+
+// finish closes the array and flushes the remaining items
+func (s *jsonStream) finish() error {
+	if s.format == StreamJSONArray {
+		_, _ = s.buffer.WriteString("]\n")
+	}
+	return s.flush()
+}
+
+// flush sends the buffered items to the client
+func (s *jsonStream) flush() error {
+	s.pending = 0
+	s.lastFlush = time.Now()
+	if err := s.buffer.Flush(); err != nil {
+		return err
+	}
+	if err := s.controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
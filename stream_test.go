@@ -0,0 +1,171 @@
+package apirouter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+// streamUser is a test model for streaming responses
+type streamUser struct {
+	Email    string
+	Name     string
+	Password string
+}
+
+// testStreamUsers returns users for streaming
+func testStreamUsers(count int) []*streamUser {
+	users := make([]*streamUser, 0, count)
+	for i := 0; i < count; i++ {
+		users = append(users, &streamUser{Email: "user@example.com", Name: "user", Password: "secret"})
+	}
+	return users
+}
+
+// TestStreamJSON tests streaming an iterator as NDJSON and as a JSON array
+func TestStreamJSON(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ndjson with allowed fields", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/export", nil)
+		rr := httptest.NewRecorder()
+
+		err := StreamJSON(rr, req, http.StatusOK, slices.Values(testStreamUsers(3)), StreamOptions{
+			Allowed: []string{"email", "name"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, ndjsonContentType, rr.Header().Get(contentTypeHeader))
+		require.True(t, rr.Flushed)
+
+		lines := strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n")
+		require.Len(t, lines, 3)
+		for _, line := range lines {
+			require.JSONEq(t, `{"email":"user@example.com","name":"user"}`, line)
+		}
+	})
+
+	t.Run("json array", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/export", nil)
+		rr := httptest.NewRecorder()
+
+		err := StreamJSON(rr, req, http.StatusOK, slices.Values(testStreamUsers(250)), StreamOptions{
+			Allowed:    []string{"name"},
+			FlushEvery: 10,
+			Format:     StreamJSONArray,
+		})
+		require.NoError(t, err)
+		require.Equal(t, "application/json; charset=utf-8", rr.Header().Get(contentTypeHeader))
+
+		var decoded []map[string]interface{}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &decoded))
+		require.Len(t, decoded, 250)
+		require.Equal(t, map[string]interface{}{"name": "user"}, decoded[0])
+	})
+
+	t.Run("empty json array", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/export", nil)
+		rr := httptest.NewRecorder()
+
+		err := StreamJSON(rr, req, http.StatusOK, slices.Values([]streamUser{}), StreamOptions{Format: StreamJSONArray})
+		require.NoError(t, err)
+		require.Equal(t, "[]\n", rr.Body.String())
+	})
+
+	t.Run("no filtering without allowed fields", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/export", nil)
+		rr := httptest.NewRecorder()
+
+		err := StreamJSON(rr, req, http.StatusOK, slices.Values([]map[string]int{{"a": 1}, {"b": 2}}), StreamOptions{})
+		require.NoError(t, err)
+		require.Equal(t, "{\"a\":1}\n{\"b\":2}\n", rr.Body.String())
+	})
+
+	t.Run("stops when the client disconnects", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/export", nil)
+		rr := httptest.NewRecorder()
+
+		produced := 0
+		items := func(yield func(int) bool) {
+			for i := 0; ; i++ {
+				produced++
+				if i == 5 {
+					cancel()
+				}
+				if !yield(i) {
+					return
+				}
+			}
+		}
+
+		err := StreamJSON(rr, req, http.StatusOK, items, StreamOptions{})
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, 6, produced)
+	})
+}
+
+// TestStreamJSONChannel tests streaming from a channel through the Router
+func TestStreamJSONChannel(t *testing.T) {
+	t.Parallel()
+
+	t.Run("flushes while waiting for items", func(t *testing.T) {
+		items := make(chan *streamUser)
+		router := New()
+		router.HTTPRouter.GET("/export", router.Request(func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+			_ = StreamJSONChannel(w, req, http.StatusOK, items, StreamOptions{
+				Allowed:       []string{"name"},
+				FlushInterval: 10 * time.Millisecond,
+			})
+		}))
+		server := httptest.NewServer(router.HTTPRouter)
+		defer server.Close()
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+"/export", nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		// Each item arrives before the channel is closed
+		reader := bufio.NewReader(resp.Body)
+		for i := 0; i < 2; i++ {
+			items <- &streamUser{Name: "user", Password: "secret"}
+			line, readErr := reader.ReadString('\n')
+			require.NoError(t, readErr)
+			require.JSONEq(t, `{"name":"user"}`, line)
+		}
+		close(items)
+	})
+
+	t.Run("stops when the client disconnects", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/export", nil)
+		items := make(chan int)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- StreamJSONChannel(httptest.NewRecorder(), req, http.StatusOK, items, StreamOptions{Format: StreamJSONArray})
+		}()
+		items <- 1
+		cancel()
+
+		select {
+		case err := <-done:
+			require.ErrorIs(t, err, context.Canceled)
+		case <-time.After(5 * time.Second):
+			t.Fatal("stream did not stop after the client disconnected")
+		}
+	})
+}
@@ -0,0 +1,432 @@
+package apirouter
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Validation rules of the validate struct tag
+const (
+	RuleDive  string = "dive"
+	RuleEmail string = "email"
+	RuleLen   string = "len"
+	RuleMax   string = "max"
+	RuleMin   string = "min"
+	RuleRegex string = "regex"
+	RuleUUID  string = "uuid"
+)
+
+// validateTag is the struct tag with the validation rules
+const validateTag = "validate"
+
+// uuidPattern matches a UUID in the canonical (hyphenated) form
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ValidationRule checks a field value, where param is the rule's parameter (IE: "3" for min=3)
+type ValidationRule func(value reflect.Value, param string) bool
+
+// customRule is a registered validation rule and its message
+type customRule struct {
+	check   ValidationRule
+	message string
+}
+
+// validateRule is a compiled rule of a field
+type validateRule struct {
+	check   func(v reflect.Value) bool
+	message string
+	meta    map[string]interface{}
+	name    string
+}
+
+// validateField is a struct field with its compiled rules
+type validateField struct {
+	dive         bool
+	diveRequired bool
+	diveRules    []validateRule
+	index        []int
+	name         string
+	required     bool
+	rules        []validateRule
+}
+
+// Registered rules and the compiled plans of each struct type
+var (
+	validationRules   = make(map[string]customRule)
+	validationRulesMu sync.RWMutex
+	validatePlanCache sync.Map // map[reflect.Type][]validateField
+)
+
+// RegisterValidationRule adds a rule for the validate struct tag (IE: validate:"slug" or validate:"divisible=5").
+// The message can use {param} for the rule's parameter. Rules should be registered before validating
+// any struct that uses them, as the rules of each type are compiled once.
+func RegisterValidationRule(name, message string, rule ValidationRule) {
+	validationRulesMu.Lock()
+	defer validationRulesMu.Unlock()
+	validationRules[name] = customRule{check: rule, message: message}
+}
+
+// Validate checks the struct (or pointer to a struct) using the validate field tags:
+//
+//	type CreateUser struct {
+//		Email string   `json:"email" validate:"required,email"`
+//		Name  string   `json:"name" validate:"required,min=2,max=50"`
+//		Role  string   `json:"role" validate:"oneof=admin user"`
+//		Tags  []string `json:"tags" validate:"max=5,dive,min=1,max=20"`
+//		Zip   string   `json:"zip" validate:"regex=^[0-9]{5}$"`
+//	}
+//
+// The rules are required, min, max, len (lengths for strings, slices and maps, values for numbers), oneof
+// (space separated), email, uuid, regex (must be last, the rest of the tag is the pattern) and any registered rule.
+// The rules after dive apply to each element of a slice or map. Nested structs are always validated.
+// Empty strings, slices and maps and nil pointers skip the rules unless they are required.
+// Zero values are missing for required (IE: 0, false or an empty struct), use a pointer to accept them.
+//
+// It returns a *ValidationError with a JSON pointer to each invalid field (using the json names), or nil.
+func Validate(v interface{}) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return ErrInvalidValidateTarget
+	}
+
+	validation := &ValidationError{}
+	if err := validateStruct(value, "", validation); err != nil {
+		return err
+	}
+	return validation.Err()
+}
+
+// validateStruct checks the fields of the struct
+func validateStruct(v reflect.Value, pointer string, validation *ValidationError) error {
+	fields, err := validatePlan(v.Type())
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		fieldValue, err := v.FieldByIndexErr(field.index)
+		if err != nil {
+			continue // Nil embedded pointer
+		}
+		fieldPointer := pointer + FieldPointer(field.name)
+		if err = validateValue(fieldValue, fieldPointer, field.required, field.rules, validation); err != nil {
+			return err
+		}
+		if err = validateElements(fieldValue, fieldPointer, &field, validation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateValue checks a single value and validates it if it is a struct
+func validateValue(v reflect.Value, pointer string, required bool, rules []validateRule, validation *ValidationError) error {
+	if required && isMissingValue(v) {
+		validation.Add(pointer, RuleRequired, "is required", nil)
+		return nil
+	}
+	v = indirectValue(v)
+	if isEmptyValidateValue(v) {
+		return nil
+	}
+
+	for _, rule := range rules {
+		if !rule.check(v) {
+			validation.Add(pointer, rule.name, rule.message, rule.meta)
+			break // Only the first failure of each field
+		}
+	}
+
+	if v.Kind() == reflect.Struct {
+		return validateStruct(v, pointer, validation)
+	}
+	return nil
+}
+
+// validateElements checks the elements of a slice or map with the dive rules (and validates struct elements)
+func validateElements(v reflect.Value, pointer string, field *validateField, validation *ValidationError) error {
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if !field.dive && indirectType(v.Type().Elem()).Kind() != reflect.Struct {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := validateValue(v.Index(i), pointer+FieldPointer(strconv.Itoa(i)), field.diveRequired, field.diveRules, validation); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if !field.dive && indirectType(v.Type().Elem()).Kind() != reflect.Struct {
+			return nil
+		}
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+		})
+		for _, key := range keys {
+			if err := validateValue(v.MapIndex(key), pointer+FieldPointer(fmt.Sprint(key.Interface())), field.diveRequired, field.diveRules, validation); err != nil {
+				return err
+			}
+		}
+	default:
+	}
+	return nil
+}
+
+// validatePlan returns the compiled rules of the struct type
+func validatePlan(t reflect.Type) ([]validateField, error) {
+	if cached, ok := validatePlanCache.Load(t); ok {
+		return cached.([]validateField), nil
+	}
+
+	jsonNames := jsonFields(t)
+	fields := make([]validateField, 0, t.NumField())
+	for _, structField := range reflect.VisibleFields(t) {
+		if !structField.IsExported() || structField.Anonymous {
+			continue
+		}
+
+		tag, hasTag := structField.Tag.Lookup(validateTag)
+		fieldType := indirectType(structField.Type)
+		nested := fieldType.Kind() == reflect.Struct
+		if fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array || fieldType.Kind() == reflect.Map {
+			nested = indirectType(fieldType.Elem()).Kind() == reflect.Struct
+		}
+		if (!hasTag || tag == "-") && !nested {
+			continue
+		}
+
+		field := validateField{index: structField.Index, name: validateFieldName(structField, jsonNames)}
+		if hasTag && tag != "-" {
+			if err := compileValidateTag(&field, tag, fieldType); err != nil {
+				return nil, fmt.Errorf("field %s: %w", structField.Name, err)
+			}
+		}
+		fields = append(fields, field)
+	}
+
+	validatePlanCache.Store(t, fields)
+	return fields, nil
+}
+
+// compileValidateTag parses the rules of the tag for the field type
+func compileValidateTag(field *validateField, tag string, t reflect.Type) error {
+	parts := strings.Split(tag, ",")
+	for i := 0; i < len(parts); i++ {
+		name, param, _ := strings.Cut(strings.TrimSpace(parts[i]), "=")
+		if name == RuleRegex { // The pattern can contain commas
+			_, param, _ = strings.Cut(strings.Join(parts[i:], ","), "=")
+			i = len(parts)
+		}
+
+		switch {
+		case len(name) == 0:
+			continue
+		case name == RuleDive:
+			if field.dive || (t.Kind() != reflect.Slice && t.Kind() != reflect.Array && t.Kind() != reflect.Map) {
+				return fmt.Errorf("%w: %s", ErrInvalidValidationRule, tag)
+			}
+			field.dive = true
+			t = indirectType(t.Elem())
+		case name == RuleRequired:
+			if field.dive {
+				field.diveRequired = true
+			} else {
+				field.required = true
+			}
+		default:
+			rule, err := compileValidateRule(name, param, t)
+			if err != nil {
+				return err
+			}
+			if field.dive {
+				field.diveRules = append(field.diveRules, rule)
+			} else {
+				field.rules = append(field.rules, rule)
+			}
+		}
+	}
+	return nil
+}
+
+// compileValidateRule compiles a rule for the (dereferenced) type
+func compileValidateRule(name, param string, t reflect.Type) (validateRule, error) {
+	rule := validateRule{name: name}
+	switch name {
+	case RuleMin, RuleMax, RuleLen:
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return rule, fmt.Errorf("%w: %s=%s", ErrInvalidValidationRule, name, param)
+		}
+		rule.meta = map[string]interface{}{name: limit}
+		rule.message = sizeMessage(name, param, t)
+		rule.check = func(v reflect.Value) bool {
+			size, ok := validateSize(v)
+			switch {
+			case !ok:
+				return false
+			case name == RuleMin:
+				return size >= limit
+			case name == RuleMax:
+				return size <= limit
+			default:
+				return size == limit
+			}
+		}
+	case RuleOneOf:
+		options := strings.Fields(param)
+		rule.meta = map[string]interface{}{"options": options}
+		rule.message = "must be one of: " + strings.Join(options, ", ")
+		rule.check = func(v reflect.Value) bool {
+			return slices.Contains(options, fmt.Sprint(v.Interface()))
+		}
+	case RuleEmail:
+		rule.message = "must be a valid email address"
+		rule.check = func(v reflect.Value) bool {
+			if v.Kind() != reflect.String {
+				return false
+			}
+			address, err := mail.ParseAddress(v.String())
+			return err == nil && address.Address == v.String()
+		}
+	case RuleUUID:
+		rule.message = "must be a valid UUID"
+		rule.check = func(v reflect.Value) bool {
+			return v.Kind() == reflect.String && uuidPattern.MatchString(v.String())
+		}
+	case RuleRegex:
+		pattern, err := regexp.Compile(param)
+		if err != nil {
+			return rule, fmt.Errorf("%w: %s=%s", ErrInvalidValidationRule, name, param)
+		}
+		rule.message = "has an invalid format"
+		rule.check = func(v reflect.Value) bool {
+			return v.Kind() == reflect.String && pattern.MatchString(v.String())
+		}
+	default:
+		validationRulesMu.RLock()
+		custom, ok := validationRules[name]
+		validationRulesMu.RUnlock()
+		if !ok {
+			return rule, fmt.Errorf("%w: %s", ErrUnknownValidationRule, name)
+		}
+		if len(param) > 0 {
+			rule.meta = map[string]interface{}{name: param}
+		}
+		rule.message = interpolateMessage(custom.message, map[string]string{"param": param})
+		rule.check = func(v reflect.Value) bool {
+			return custom.check(v, param)
+		}
+	}
+	return rule, nil
+}
+
+// validateSize returns the length of strings, slices and maps, or the value of numbers
+func validateSize(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// sizeMessage returns the message for a min, max or len rule of the type
+func sizeMessage(name, param string, t reflect.Type) string {
+	var unit string
+	switch t.Kind() {
+	case reflect.String:
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " items"
+	default:
+	}
+
+	switch name {
+	case RuleMin:
+		return "must be at least " + param + unit
+	case RuleMax:
+		return "must be at most " + param + unit
+	default:
+		return "must be exactly " + param + unit
+	}
+}
+
+// validateFieldName returns the name used in the JSON pointer: the json name, a binding tag name or the field name
+func validateFieldName(field reflect.StructField, jsonNames []jsonField) string {
+	if tag := field.Tag.Get(bindBody); len(tag) > 0 && tag != "-" {
+		if i := slices.IndexFunc(jsonNames, func(f jsonField) bool { return slices.Equal(f.index, field.Index) }); i >= 0 {
+			return jsonNames[i].name
+		}
+	}
+	for _, in := range []string{bindQuery, bindPath, bindHeader} {
+		if name, _, _ := strings.Cut(field.Tag.Get(in), ","); len(name) > 0 && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// isMissingValue checks if a required value is missing (nil, an empty string, slice or map, or the zero value of a non-pointer)
+func isMissingValue(v reflect.Value) bool {
+	direct := v.IsValid() && v.Kind() != reflect.Pointer && v.Kind() != reflect.Interface
+	v = indirectValue(v)
+	return isEmptyValidateValue(v) || (direct && v.IsZero())
+}
+
+// isEmptyValidateValue checks if an optional value skips the rules (nil, or an empty string, slice or map)
+func isEmptyValidateValue(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return false
+	}
+}
+
+// indirectValue dereferences pointers and interfaces (invalid if nil)
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// indirectType dereferences pointer types
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
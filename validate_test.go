@@ -0,0 +1,220 @@
+package apirouter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testValidateAddress is a nested struct for validation tests
+type testValidateAddress struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip" validate:"regex=^[0-9]{5}(-[0-9]{4})?$"`
+}
+
+// testValidateUser is the struct used for validation tests
+type testValidateUser struct {
+	Address  testValidateAddress            `json:"address"`
+	Age      int                            `json:"age" validate:"min=18,max=130"`
+	Contacts map[string]testValidateAddress `json:"contacts"`
+	Email    string                         `json:"email" validate:"required,email"`
+	Emails   []string                       `json:"emails" validate:"max=2,dive,email"`
+	ID       string                         `json:"id" validate:"uuid"`
+	Nickname *string                        `json:"nickname" validate:"min=3"`
+	Others   []*testValidateAddress         `json:"others"`
+	PIN      string                         `json:"pin" validate:"len=4"`
+	Role     string                         `json:"role" validate:"oneof=admin user"`
+	Scores   map[string]int                 `json:"scores" validate:"dive,max=100"`
+	Team     string                         `query:"team" validate:"required"`
+}
+
+// validateFieldErrors returns the field errors of Validate()
+func validateFieldErrors(t *testing.T, v interface{}) []FieldError {
+	t.Helper()
+
+	err := Validate(v)
+	if err == nil {
+		return nil
+	}
+	var validation *ValidationError
+	require.ErrorAs(t, err, &validation)
+	return validation.Fields
+}
+
+// TestValidate tests the built-in rules
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	nickname := "al"
+	user := &testValidateUser{
+		Address:  testValidateAddress{Zip: "1234"},
+		Age:      12,
+		Contacts: map[string]testValidateAddress{"home": {City: "Paris"}, "work": {}},
+		Email:    "not an email",
+		Emails:   []string{"a@b.com", "bad"},
+		ID:       "123",
+		Nickname: &nickname,
+		Others:   []*testValidateAddress{nil, {}},
+		PIN:      "12345",
+		Role:     "root",
+		Scores:   map[string]int{"math": 101, "art": 90},
+	}
+
+	require.Equal(t, []FieldError{
+		{Field: "/address/city", Message: "is required", Rule: RuleRequired},
+		{Field: "/address/zip", Message: "has an invalid format", Rule: RuleRegex},
+		{Field: "/age", Message: "must be at least 18", Meta: map[string]interface{}{"min": float64(18)}, Rule: RuleMin},
+		{Field: "/contacts/work/city", Message: "is required", Rule: RuleRequired},
+		{Field: "/email", Message: "must be a valid email address", Rule: RuleEmail},
+		{Field: "/emails/1", Message: "must be a valid email address", Rule: RuleEmail},
+		{Field: "/id", Message: "must be a valid UUID", Rule: RuleUUID},
+		{Field: "/nickname", Message: "must be at least 3 characters", Meta: map[string]interface{}{"min": float64(3)}, Rule: RuleMin},
+		{Field: "/others/1/city", Message: "is required", Rule: RuleRequired},
+		{Field: "/pin", Message: "must be exactly 4 characters", Meta: map[string]interface{}{"len": float64(4)}, Rule: RuleLen},
+		{Field: "/role", Message: "must be one of: admin, user", Meta: map[string]interface{}{"options": []string{"admin", "user"}}, Rule: RuleOneOf},
+		{Field: "/scores/math", Message: "must be at most 100", Meta: map[string]interface{}{"max": float64(100)}, Rule: RuleMax},
+		{Field: "/team", Message: "is required", Rule: RuleRequired},
+	}, validateFieldErrors(t, user))
+
+	t.Run("valid", func(t *testing.T) {
+		valid := &testValidateUser{
+			Address: testValidateAddress{City: "Rome", Zip: "12345-6789"},
+			Age:     30,
+			Email:   "a@b.com",
+			Emails:  []string{"c@d.com"},
+			ID:      "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+			PIN:     "1234",
+			Role:    "admin",
+			Team:    "blue",
+		}
+		require.NoError(t, Validate(valid))
+		require.NoError(t, Validate(*valid))
+	})
+
+	t.Run("slice length before dive", func(t *testing.T) {
+		fields := validateFieldErrors(t, &testValidateUser{
+			Address: testValidateAddress{City: "Rome"}, Age: 20, Email: "a@b.com", Team: "x",
+			Emails: []string{"a@b.com", "c@d.com", "e@f.com"},
+		})
+		require.Equal(t, []FieldError{
+			{Field: "/emails", Message: "must be at most 2 items", Meta: map[string]interface{}{"max": float64(2)}, Rule: RuleMax},
+		}, fields)
+	})
+
+	t.Run("required zero values", func(t *testing.T) {
+		type settings struct {
+			Address testValidateAddress `json:"address" validate:"required"`
+			Count   int                 `json:"count" validate:"required"`
+			Enabled bool                `json:"enabled" validate:"required"`
+			Limit   *int                `json:"limit" validate:"required"`
+			Ratios  []float64           `json:"ratios" validate:"dive,required"`
+		}
+		require.Equal(t, []FieldError{
+			{Field: "/address", Message: "is required", Rule: RuleRequired},
+			{Field: "/count", Message: "is required", Rule: RuleRequired},
+			{Field: "/enabled", Message: "is required", Rule: RuleRequired},
+			{Field: "/limit", Message: "is required", Rule: RuleRequired},
+			{Field: "/ratios/1", Message: "is required", Rule: RuleRequired},
+		}, validateFieldErrors(t, &settings{Ratios: []float64{0.5, 0}}))
+
+		// A pointer accepts the zero value
+		zero := 0
+		require.NoError(t, Validate(&settings{Address: testValidateAddress{City: "Rome"}, Count: 1, Enabled: true, Limit: &zero}))
+	})
+
+	t.Run("invalid targets", func(t *testing.T) {
+		require.ErrorIs(t, Validate("string"), ErrInvalidValidateTarget)
+		require.NoError(t, Validate((*testValidateUser)(nil)))
+	})
+
+	t.Run("invalid tags", func(t *testing.T) {
+		require.ErrorIs(t, Validate(struct {
+			Name string `validate:"min=abc"`
+		}{}), ErrInvalidValidationRule)
+		require.ErrorIs(t, Validate(struct {
+			Name string `validate:"dive"`
+		}{}), ErrInvalidValidationRule)
+		require.ErrorIs(t, Validate(struct {
+			Name string `validate:"regex=("`
+		}{}), ErrInvalidValidationRule)
+		require.ErrorIs(t, Validate(struct {
+			Name string `validate:"not_registered"`
+		}{}), ErrUnknownValidationRule)
+	})
+}
+
+// TestRegisterValidationRule tests custom rules
+func TestRegisterValidationRule(t *testing.T) {
+	t.Parallel()
+
+	RegisterValidationRule("test_divisible", "must be divisible by {param}", func(value reflect.Value, param string) bool {
+		divisor, err := strconv.ParseInt(param, 10, 64)
+		return err == nil && value.CanInt() && value.Int()%divisor == 0
+	})
+	RegisterValidationRule("test_lower", "must be lower case", func(value reflect.Value, _ string) bool {
+		return value.String() == strings.ToLower(value.String())
+	})
+
+	type testCustom struct {
+		Count int    `json:"count" validate:"test_divisible=5"`
+		Slug  string `json:"slug" validate:"required,test_lower"`
+	}
+
+	require.Equal(t, []FieldError{
+		{Field: "/count", Message: "must be divisible by 5", Meta: map[string]interface{}{"test_divisible": "5"}, Rule: "test_divisible"},
+		{Field: "/slug", Message: "must be lower case", Rule: "test_lower"},
+	}, validateFieldErrors(t, testCustom{Count: 7, Slug: "Hello"}))
+	require.NoError(t, Validate(testCustom{Count: 10, Slug: "hello"}))
+}
+
+// TestBind_Validate tests that Bind() validates the bound struct
+func TestBind_Validate(t *testing.T) {
+	t.Parallel()
+
+	type testBindValidate struct {
+		Email string `json:"email,required" validate:"required,email"`
+		Limit int    `query:"limit" default:"10" validate:"min=1,max=100"`
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/?limit=500", strings.NewReader(`{}`))
+		req.Header.Set(contentTypeHeader, "application/json")
+
+		var dst testBindValidate
+		require.Equal(t, []FieldError{
+			{Field: "/email", Message: "is required", Rule: RuleRequired},
+			{Field: "/limit", Message: "must be at most 100", Meta: map[string]interface{}{"max": float64(100)}, Rule: RuleMax},
+		}, bindFieldErrors(t, Bind(req, &dst)))
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/", strings.NewReader(`{"email":"a@b.com"}`))
+		req.Header.Set(contentTypeHeader, "application/json")
+
+		var dst testBindValidate
+		require.NoError(t, Bind(req, &dst))
+		require.Equal(t, 10, dst.Limit)
+	})
+}
+
+// BenchmarkValidate benchmarks validating with a cached plan
+func BenchmarkValidate(b *testing.B) {
+	user := &testValidateUser{
+		Address: testValidateAddress{City: "Rome", Zip: "12345"},
+		Age:     30,
+		Email:   "a@b.com",
+		Emails:  []string{"c@d.com"},
+		Role:    "admin",
+		Team:    "blue",
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Validate(user)
+	}
+}
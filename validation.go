@@ -0,0 +1,225 @@
+package apirouter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mrz1836/go-parameters"
+)
+
+// Validation rules used by ParamsValidator
+const (
+	RuleCursor   string = "cursor"
+	RuleLength   string = "length"
+	RuleMatch    string = "match"
+	RuleOneOf    string = "oneof"
+	RuleRange    string = "range"
+	RuleRequired string = "required"
+	RuleType     string = "type"
+)
+
+// validationFieldsJSONField is the JSON field name of the field errors in a response
+const validationFieldsJSONField = "fields"
+
+// validationMessage is the public message for validation errors
+const validationMessage = "the request has invalid fields"
+
+// pointerEscaper escapes a JSON pointer segment (RFC 6901)
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// FieldError is a single invalid field.
+// Meta holds the rule parameters (IE: min and max), never the rejected value.
+type FieldError struct {
+	Field   string                 `json:"field" url:"field"`         // JSON pointer to the field (IE: /user/email)
+	Message string                 `json:"message" url:"message"`     // Public message for the field
+	Meta    map[string]interface{} `json:"meta,omitempty" url:"meta"` // Rule parameters (IE: {"min": 3})
+	Rule    string                 `json:"rule" url:"rule"`           // Rule that failed (IE: required)
+}
+
+// ValidationError is a list of invalid fields, written by RespondWith with a 422 (Unprocessable Entity) status
+type ValidationError struct {
+	Fields []FieldError `json:"fields" url:"fields"`
+}
+
+// ParamsValidator accumulates the field errors while validating parameters.Params
+//
+//	v := NewParamsValidator(params)
+//	v.Required("email", "name")
+//	v.Length("name", 2, 50)
+//	if err := v.Err(); err != nil {
+//		RespondWith(w, req, http.StatusUnprocessableEntity, err)
+//		return
+//	}
+type ParamsValidator struct {
+	params     *parameters.Params
+	validation *ValidationError
+}
+
+// NewParamsValidator creates a validator for the params
+func NewParamsValidator(params *parameters.Params) *ParamsValidator {
+	return &ParamsValidator{params: params, validation: &ValidationError{}}
+}
+
+// Check adds a field error for the key if ok is false (for custom rules)
+func (v *ParamsValidator) Check(key, rule, message string, ok bool) *ParamsValidator {
+	if !ok {
+		v.validation.Add(paramPointer(key), rule, message, nil)
+	}
+	return v
+}
+
+// Err returns the ValidationError, or nil if all the params are valid
+func (v *ParamsValidator) Err() error {
+	return v.validation.Err()
+}
+
+// Length checks the number of characters of the key (if present), where max <= 0 is no maximum
+func (v *ParamsValidator) Length(key string, minLength, maxLength int) *ParamsValidator {
+	value, ok := v.value(key)
+	if !ok {
+		return v
+	}
+	length := utf8.RuneCountInString(value)
+	if length < minLength || (maxLength > 0 && length > maxLength) {
+		message := "must be at least " + strconv.Itoa(minLength) + " characters"
+		if maxLength > 0 {
+			message = "must be between " + strconv.Itoa(minLength) + " and " + strconv.Itoa(maxLength) + " characters"
+		}
+		v.validation.Add(paramPointer(key), RuleLength, message, map[string]interface{}{"max": maxLength, "min": minLength})
+	}
+	return v
+}
+
+// Match checks that the key (if present) matches the pattern
+func (v *ParamsValidator) Match(key string, pattern *regexp.Regexp) *ParamsValidator {
+	if value, ok := v.value(key); ok && !pattern.MatchString(value) {
+		v.validation.Add(paramPointer(key), RuleMatch, "has an invalid format", nil)
+	}
+	return v
+}
+
+// OneOf checks that the key (if present) is one of the options
+func (v *ParamsValidator) OneOf(key string, options ...string) *ParamsValidator {
+	if value, ok := v.value(key); ok && !slices.Contains(options, value) {
+		v.validation.Add(paramPointer(key), RuleOneOf, "must be one of: "+strings.Join(options, ", "), map[string]interface{}{"options": options})
+	}
+	return v
+}
+
+// Range checks that the key (if present) is a number between min and max
+func (v *ParamsValidator) Range(key string, minValue, maxValue float64) *ParamsValidator {
+	value, ok := v.value(key)
+	if !ok {
+		return v
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		v.validation.Add(paramPointer(key), RuleType, "must be a number", nil)
+		return v
+	}
+	if number < minValue || number > maxValue {
+		v.validation.Add(
+			paramPointer(key), RuleRange,
+			"must be between "+strconv.FormatFloat(minValue, 'f', -1, 64)+" and "+strconv.FormatFloat(maxValue, 'f', -1, 64),
+			map[string]interface{}{"max": maxValue, "min": minValue},
+		)
+	}
+	return v
+}
+
+// Required checks that the keys are present and not empty
+func (v *ParamsValidator) Required(keys ...string) *ParamsValidator {
+	for _, key := range keys {
+		if _, ok := v.value(key); !ok {
+			v.validation.Add(paramPointer(key), RuleRequired, "is required", nil)
+		}
+	}
+	return v
+}
+
+// value returns the param as a string, or false if it is missing or empty (dotted keys are nested params, IE: user.email)
+func (v *ParamsValidator) value(key string) (string, bool) {
+	if v.params == nil {
+		return "", false
+	}
+	param, ok := v.params.Get(key)
+	if !ok || param == nil {
+		return "", false
+	}
+
+	var value string
+	switch typed := param.(type) {
+	case string:
+		value = typed
+	case []byte:
+		value = string(typed)
+	case []string:
+		if len(typed) > 0 {
+			value = typed[0]
+		}
+	default:
+		value = fmt.Sprint(typed)
+	}
+	value = strings.TrimSpace(value)
+	return value, len(value) > 0
+}
+
+// Add adds a field error
+func (e *ValidationError) Add(field, rule, message string, meta map[string]interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message, Meta: meta, Rule: rule})
+}
+
+// Err returns the ValidationError, or nil if there are no field errors
+func (e *ValidationError) Err() error {
+	if e == nil || len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error returns the public message
+func (e *ValidationError) Error() string {
+	return validationMessage
+}
+
+// FieldPointer returns the JSON pointer (RFC 6901) for the path segments, IE: FieldPointer("user", "email") is /user/email
+func FieldPointer(segments ...string) string {
+	var b strings.Builder
+	for _, segment := range segments {
+		b.WriteString("/")
+		b.WriteString(pointerEscaper.Replace(segment))
+	}
+	return b.String()
+}
+
+// paramPointer returns the JSON pointer for a param key (dotted keys are nested, IE: user.email is /user/email)
+func paramPointer(key string) string {
+	return FieldPointer(strings.Split(key, ".")...)
+}
+
+// validationError returns the ValidationError in the data (if any)
+func validationError(data interface{}) (*ValidationError, bool) {
+	err, ok := data.(error)
+	if !ok {
+		return nil, false
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) && validationErr != nil {
+		return validationErr, true
+	}
+	return nil, false
+}
+
+// validationStatus returns 422 (Unprocessable Entity) for validation errors, or the status
+func validationStatus(status int, data interface{}) int {
+	if _, ok := validationError(data); ok {
+		return http.StatusUnprocessableEntity
+	}
+	return status
+}
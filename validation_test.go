@@ -0,0 +1,127 @@
+package apirouter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/mrz1836/go-parameters"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParamsValidator tests accumulating field errors from params
+func TestParamsValidator(t *testing.T) {
+	t.Parallel()
+
+	params := &parameters.Params{Values: map[string]interface{}{
+		"age":   float64(17),
+		"email": "not-an-email",
+		"name":  "  a ",
+		"role":  "root",
+		"user":  map[string]interface{}{"nick": "x"},
+		"size":  "large",
+	}}
+
+	err := NewParamsValidator(params).
+		Required("email", "password", "user.nick", "user.bio").
+		Length("name", 2, 10).
+		Length("password", 8, 0).
+		Match("email", regexp.MustCompile(`^[^@]+@[^@]+$`)).
+		OneOf("role", "admin", "user").
+		Range("age", 18, 130).
+		Range("size", 1, 10).
+		Check("user.nick", "custom", "is taken", false).
+		Err()
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, []FieldError{
+		{Field: "/password", Message: "is required", Rule: RuleRequired},
+		{Field: "/user/bio", Message: "is required", Rule: RuleRequired},
+		{Field: "/name", Message: "must be between 2 and 10 characters", Meta: map[string]interface{}{"max": 10, "min": 2}, Rule: RuleLength},
+		{Field: "/email", Message: "has an invalid format", Rule: RuleMatch},
+		{Field: "/role", Message: "must be one of: admin, user", Meta: map[string]interface{}{"options": []string{"admin", "user"}}, Rule: RuleOneOf},
+		{Field: "/age", Message: "must be between 18 and 130", Meta: map[string]interface{}{"max": float64(130), "min": float64(18)}, Rule: RuleRange},
+		{Field: "/size", Message: "must be a number", Rule: RuleType},
+		{Field: "/user/nick", Message: "is taken", Rule: "custom"},
+	}, validationErr.Fields)
+
+	t.Run("valid params", func(t *testing.T) {
+		require.NoError(t, NewParamsValidator(params).Required("email", "age").Range("age", 1, 20).Err())
+	})
+
+	t.Run("nil params", func(t *testing.T) {
+		err := NewParamsValidator(nil).Required("email").Err()
+		require.Error(t, err)
+	})
+
+	t.Run("no field errors is a nil error", func(t *testing.T) {
+		validation := &ValidationError{}
+		require.NoError(t, validation.Err())
+	})
+}
+
+// TestFieldPointer tests the JSON pointer escaping
+func TestFieldPointer(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "/user/email", FieldPointer("user", "email"))
+	require.Equal(t, "/a~1b/c~0d/0", FieldPointer("a/b", "c~d", "0"))
+	require.Empty(t, FieldPointer())
+}
+
+// TestRespondWith_ValidationError tests rendering the field errors
+func TestRespondWith_ValidationError(t *testing.T) {
+	t.Parallel()
+
+	validation := &ValidationError{}
+	validation.Add(FieldPointer("email"), RuleRequired, "is required", nil)
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/users", nil)
+
+	t.Run("validation error", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		RespondWith(w, req, http.StatusBadRequest, validation)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		require.JSONEq(t, `{"error":"the request has invalid fields","fields":[{"field":"/email","message":"is required","rule":"required"}]}`, w.Body.String())
+	})
+
+	t.Run("wrapped validation error", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		RespondWith(w, req, http.StatusBadRequest, fmt.Errorf("create user: %w", validation))
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		require.Contains(t, w.Body.String(), `"field":"/email"`)
+	})
+
+	t.Run("api error with a validation cause", func(t *testing.T) {
+		apiErr := NewAPIError(req, validation)
+		require.Equal(t, ErrCodeValidation, apiErr.Code)
+		require.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+		require.Equal(t, validation.Fields, apiErr.Data)
+
+		w := httptest.NewRecorder()
+		RespondWith(w, req, apiErr.StatusCode, apiErr)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		require.Contains(t, w.Body.String(), `"field":"/email"`)
+	})
+
+	t.Run("problem details", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		RespondProblem(w, req, http.StatusUnprocessableEntity, validation)
+
+		var problem map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		require.Equal(t, "the request has invalid fields", problem["detail"])
+		require.Len(t, problem["fields"], 1)
+	})
+
+	t.Run("negotiated", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		RespondNegotiated(w, req, http.StatusBadRequest, validation)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		require.Contains(t, w.Body.String(), `"rule":"required"`)
+	})
+}
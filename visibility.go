@@ -0,0 +1,163 @@
+package apirouter
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// RolePublic is the role every caller has for the visible struct tag (IE: `visible:"public,owner,admin"`)
+const RolePublic = "public"
+
+// Caches of the compiled role sets and the visible fields of each type
+var (
+	roleSetCache       = newJSONLRU(maxJSONCacheEntries) // string -> *roleSet
+	visibleFieldsCache = newJSONLRU(maxJSONCacheEntries) // visibleFieldsKey -> []string
+)
+
+// visibleFieldsKey identifies the cached visible fields of a struct type
+type visibleFieldsKey struct {
+	roles string
+	t     reflect.Type
+}
+
+// roleSet is the caller's roles (always including RolePublic) for the visible struct tags
+type roleSet struct {
+	id    string // The sorted roles, used to cache the plans
+	names []string
+}
+
+// newRoleSet compiles the caller's roles
+func newRoleSet(roles []string) *roleSet {
+	cacheKey := strings.Join(roles, ",")
+	if cached, ok := roleSetCache.get(cacheKey); ok {
+		return cached.(*roleSet)
+	}
+
+	names := append([]string{RolePublic}, roles...)
+	slices.Sort(names)
+	names = slices.Compact(names)
+	set := &roleSet{id: strings.Join(names, ","), names: names}
+
+	roleSetCache.add(cacheKey, set)
+	return set
+}
+
+// JSONEncodeVisible is JSONEncode() for the fields visible to the caller's roles (nil allowed fields allows all the visible fields)
+//
+// A field with a visible tag is only written for the listed roles, and fields without one are visible to everyone:
+//
+//	type User struct {
+//		Email string `json:"email" visible:"owner,admin"`
+//		ID    string `json:"id"`
+//		Name  string `json:"name" visible:"public"`
+//	}
+//
+// Every caller has RolePublic, plus the given roles (IE: the Claims roles, and "owner" when the user is the caller).
+// The visible fields are compiled once for each type and set of roles, and the tags apply to nested structs too.
+func JSONEncodeVisible(e *json.Encoder, objects interface{}, roles, allowed []string) error {
+	var set *allowedSet
+	if allowed != nil {
+		set = newAllowedSet(allowed)
+	}
+	return jsonEncode(e, objects, set, newRoleSet(roles))
+}
+
+// VisibleFields returns the json names of the fields of the struct (or a pointer or slice of structs) visible to the roles,
+// for use as the allowed fields of SparseFields() and JSONEncodeVisible()
+//
+// A nested struct that hides fields from the roles is listed by the paths of its visible fields (IE: "profile.bio"), so the restricted
+// fields are not written when the result is used with JSONEncode(). A field that repeats one of the structs it is nested in
+// (IE: Friends []*User) is left out, as its paths never end; JSONEncodeVisible() writes it with the visible fields.
+func VisibleFields(v interface{}, roles []string) []string {
+	t := visibleElemType(reflect.TypeOf(v))
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	set := newRoleSet(roles)
+	key := visibleFieldsKey{roles: set.id, t: t}
+	if cached, ok := visibleFieldsCache.get(key); ok {
+		return slices.Clone(cached.([]string))
+	}
+
+	names := visiblePaths(t, set, "", map[reflect.Type]bool{})
+	visibleFieldsCache.add(key, names)
+	return slices.Clone(names)
+}
+
+// visiblePaths returns the paths of the fields visible to the roles, expanding the nested structs that hide fields
+func visiblePaths(t reflect.Type, roles *roleSet, prefix string, expanding map[reflect.Type]bool) []string {
+	expanding[t] = true
+	defer delete(expanding, t)
+
+	plan := cachedJSONPlan(t, nil, jsonSnakeCase, roles)
+	names := make([]string, 0, len(plan))
+	for _, field := range plan {
+		elem := visibleElemType(t.FieldByIndex(field.index).Type)
+		if !hidesFields(elem, roles, map[reflect.Type]bool{}) {
+			names = append(names, prefix+field.name)
+		} else if !expanding[elem] {
+			names = append(names, visiblePaths(elem, roles, prefix+field.name+".", expanding)...)
+		}
+	}
+	return names
+}
+
+// hidesFields checks if the struct type (or any struct nested in it) has fields that are not visible to the roles
+func hidesFields(t reflect.Type, roles *roleSet, seen map[reflect.Type]bool) bool {
+	if t.Kind() != reflect.Struct || seen[t] || hasCustomJSONType(t) {
+		return false
+	}
+	seen[t] = true
+
+	for _, field := range cachedJSONFields(t, true) {
+		if !roles.canSee(field) || hidesFields(visibleElemType(t.FieldByIndex(field.index).Type), roles, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleElemType returns the element type of pointers, slices and arrays
+func visibleElemType(t reflect.Type) reflect.Type {
+	for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	return t
+}
+
+// hasCustomJSONType checks if the type (or a pointer to it) implements json.Marshaler or encoding.TextMarshaler
+func hasCustomJSONType(t reflect.Type) bool {
+	p := reflect.PointerTo(t)
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+		p.Implements(jsonMarshalerType) || p.Implements(textMarshalerType)
+}
+
+// canSee checks if the field is visible to the roles (every field is visible to a nil set)
+func (r *roleSet) canSee(field jsonField) bool {
+	if r == nil || field.visible == nil {
+		return true
+	}
+	for _, role := range field.visible {
+		if _, found := slices.BinarySearch(r.names, role); found {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleRoles returns the roles of the visible tag (nil without a tag, so the field is visible to everyone)
+func visibleRoles(tag reflect.StructTag) []string {
+	value, ok := tag.Lookup("visible")
+	if !ok {
+		return nil
+	}
+
+	roles := strings.Split(value, ",")
+	for i, role := range roles {
+		roles[i] = strings.TrimSpace(role)
+	}
+	return roles
+}
@@ -0,0 +1,159 @@
+package apirouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// testVisibleProfile is a nested struct for the visibility tests
+type testVisibleProfile struct {
+	Bio   string `json:"bio"`
+	Phone string `json:"phone" visible:"owner"`
+}
+
+// testVisibleUser is the struct for the visibility tests
+type testVisibleUser struct {
+	Email    string              `json:"email" visible:"owner, admin"`
+	ID       string              `json:"id"`
+	Internal string              `json:"internal" visible:""`
+	Name     string              `json:"name" visible:"public,owner,admin"`
+	Notes    string              `json:"notes" visible:"admin"`
+	Profile  *testVisibleProfile `json:"profile"`
+}
+
+// TestJSONEncodeVisible tests encoding the fields visible to the roles
+func TestJSONEncodeVisible(t *testing.T) {
+	t.Parallel()
+
+	users := []testVisibleUser{{
+		Email:    "a@example.com",
+		ID:       "1",
+		Internal: "never",
+		Name:     "Alice",
+		Notes:    "vip",
+		Profile:  &testVisibleProfile{Bio: "hello", Phone: "555"},
+	}}
+	encode := func(t *testing.T, roles, allowed []string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		require.NoError(t, JSONEncodeVisible(json.NewEncoder(&buf), users, roles, allowed))
+		return buf.String()
+	}
+
+	t.Run("public", func(t *testing.T) {
+		require.JSONEq(t, `[{"id":"1","name":"Alice","profile":{"bio":"hello"}}]`, encode(t, nil, nil))
+	})
+
+	t.Run("owner", func(t *testing.T) {
+		require.JSONEq(t,
+			`[{"email":"a@example.com","id":"1","name":"Alice","profile":{"bio":"hello","phone":"555"}}]`,
+			encode(t, []string{"owner"}, nil),
+		)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		require.JSONEq(t,
+			`[{"email":"a@example.com","id":"1","name":"Alice","notes":"vip","profile":{"bio":"hello"}}]`,
+			encode(t, []string{"admin"}, nil),
+		)
+	})
+
+	t.Run("with allowed fields", func(t *testing.T) {
+		require.JSONEq(t, `[{"id":"1","profile":{"bio":"hello"}}]`, encode(t, []string{"admin"}, []string{"id", "notes2", "profile.phone", "profile.bio"}))
+		require.JSONEq(t, `[{"id":"1"}]`, encode(t, nil, []string{"id", "email", "internal"}))
+	})
+}
+
+// TestVisibleFields tests listing the visible fields and the role set cache
+func TestVisibleFields(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, []string{"id", "name", "profile.bio"}, VisibleFields(&testVisibleUser{}, nil))
+	require.Equal(t, []string{"email", "id", "name", "notes", "profile"}, VisibleFields([]*testVisibleUser{}, []string{"admin", "owner"}))
+	require.Equal(t, []string{"email", "id", "name", "notes", "profile.bio"}, VisibleFields([]*testVisibleUser{}, []string{"admin"}))
+	require.Equal(t, []string{"id", "name", "profile.bio"}, VisibleFields(testVisibleUser{}, []string{RolePublic}))
+	require.Nil(t, VisibleFields("string", nil))
+	require.Nil(t, VisibleFields(nil, nil))
+
+	// The role sets are compiled once and do not depend on the order of the roles
+	require.Same(t, newRoleSet([]string{"owner", "admin"}), newRoleSet([]string{"owner", "admin"}))
+	require.Equal(t, newRoleSet([]string{"owner", "admin", "owner"}).id, newRoleSet([]string{"admin", "owner"}).id)
+	require.Equal(t, "admin,owner,public", newRoleSet([]string{"owner", "admin"}).id)
+
+	userType := reflect.TypeFor[testVisibleUser]()
+	plan := cachedJSONPlan(userType, nil, jsonSnakeCase, newRoleSet([]string{"admin", "owner"}))
+	require.Equal(t, &plan[0], &cachedJSONPlan(userType, nil, jsonSnakeCase, newRoleSet([]string{"owner", "admin"}))[0])
+
+	// With sparse fieldsets
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/users?fields=id,notes", nil)
+	_, err := SparseFields(req, VisibleFields(testVisibleUser{}, nil))
+	require.ErrorIs(t, err, ErrUnknownField)
+	fields, err := SparseFields(req, VisibleFields(testVisibleUser{}, []string{"admin"}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "notes"}, fields.Fields)
+}
+
+// testVisibleNode is a recursive struct with visible tags
+type testVisibleNode struct {
+	Children []*testVisibleNode `json:"children"`
+	Created  time.Time          `json:"created"`
+	Name     string             `json:"name"`
+	Secret   string             `json:"secret" visible:"admin"`
+}
+
+// TestVisibleFields_Nested tests that the restricted fields of nested structs are not written with JSONEncode()
+func TestVisibleFields_Nested(t *testing.T) {
+	t.Parallel()
+
+	user := &testVisibleUser{ID: "1", Profile: &testVisibleProfile{Bio: "hello", Phone: "555"}}
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/users?fields=id,profile", nil)
+	fields, err := SparseFields(req, VisibleFields(user, nil))
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "profile.bio"}, fields.Fields)
+
+	var buf bytes.Buffer
+	require.NoError(t, fields.JSONEncode(json.NewEncoder(&buf), user))
+	require.JSONEq(t, `{"id":"1","profile":{"bio":"hello"}}`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, JSONEncode(json.NewEncoder(&buf), user, VisibleFields(user, []string{"owner"})))
+	require.JSONEq(t, `{"email":"","id":"1","name":"","profile":{"bio":"hello","phone":"555"}}`, buf.String())
+
+	// Recursive structs are left out, and structs with custom JSON are written whole
+	require.Equal(t, []string{"created", "name"}, VisibleFields(testVisibleNode{}, nil))
+	require.Equal(t, []string{"children", "created", "name", "secret"}, VisibleFields(testVisibleNode{}, []string{"admin"}))
+}
+
+// TestClaims_Roles tests that the roles are kept in the token and when it is refreshed
+func TestClaims_Roles(t *testing.T) {
+	t.Parallel()
+
+	claims := Claims{Roles: []string{"admin"}, UserID: testUserID123}
+	claims.Issuer, claims.ID = "issuer", "session"
+	token, err := claims.CreateToken(time.Minute, "secret")
+	require.NoError(t, err)
+
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil)
+	req.Header.Set(AuthorizationHeader, AuthorizationBearer+" "+token)
+	w := httptest.NewRecorder()
+	authenticated, req, err := Check(w, req, "secret", "issuer", time.Minute)
+	require.NoError(t, err)
+	require.True(t, authenticated)
+	require.Equal(t, []string{"admin"}, GetClaims(req).Roles)
+
+	refreshed := &Claims{}
+	_, err = jwt.ParseWithClaims(GetTokenFromHeader(w), refreshed, func(*jwt.Token) (interface{}, error) {
+		return []byte("secret"), nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"admin"}, refreshed.Roles)
+}
@@ -0,0 +1,587 @@
+package apirouter
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1" //nolint:gosec // required by the WebSocket handshake (RFC 6455)
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// WebSocket handshake headers and defaults (RFC 6455)
+const (
+	secWebSocketAccept             string = "Sec-WebSocket-Accept"
+	secWebSocketKey                string = "Sec-WebSocket-Key"
+	secWebSocketProtocol           string = "Sec-WebSocket-Protocol"
+	secWebSocketVersion            string = "Sec-WebSocket-Version"
+	upgradeHeader                  string = "Upgrade"
+	webSocketAcceptGUID            string = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	webSocketToken                 string = "websocket"
+	webSocketVersion               string = "13"
+	defaultWebSocketMaxMessageSize int64  = 1 << 20
+	defaultWebSocketPingInterval          = 30 * time.Second
+	defaultWebSocketWriteTimeout          = 10 * time.Second
+	maxControlPayload                     = 125
+)
+
+// WebSocket frame opcodes
+const (
+	opContinuation byte = 0x0
+	opText         byte = 0x1
+	opBinary       byte = 0x2
+	opClose        byte = 0x8
+	opPing         byte = 0x9
+	opPong         byte = 0xA
+)
+
+// WebSocket close codes (RFC 6455 section 7.4.1)
+const (
+	WebSocketCloseNormal          int = 1000
+	WebSocketCloseGoingAway       int = 1001
+	WebSocketCloseProtocolError   int = 1002
+	WebSocketCloseUnsupportedData int = 1003
+	WebSocketCloseNoStatus        int = 1005 // Never sent, the peer closed without a code
+	WebSocketCloseAbnormal        int = 1006 // Never sent, the connection was lost without a close frame
+	WebSocketCloseInvalidPayload  int = 1007
+	WebSocketClosePolicyViolation int = 1008
+	WebSocketCloseMessageTooBig   int = 1009
+	WebSocketCloseInternalError   int = 1011
+)
+
+// WebSocketMessageType is the type of data message (text or binary)
+type WebSocketMessageType int
+
+// WebSocket data message types
+const (
+	WebSocketTextMessage   = WebSocketMessageType(opText)
+	WebSocketBinaryMessage = WebSocketMessageType(opBinary)
+)
+
+// WebSocketHandler handles an upgraded WebSocket connection, the connection is closed once it returns
+type WebSocketHandler func(conn *WebSocketConn, req *http.Request, ps httprouter.Params)
+
+// WebSocketOptions is the configuration for Router.WebSocket()
+type WebSocketOptions struct {
+	CheckOrigin    func(req *http.Request) bool `json:"-" url:"-"`                               // Overrides the same host and CrossOriginAllowOrigin check
+	IdleTimeout    time.Duration                `json:"idle_timeout" url:"idle_timeout"`         // Close if nothing is received, including pongs (default 2x PingInterval, negative disables)
+	MaxMessageSize int64                        `json:"max_message_size" url:"max_message_size"` // Maximum size of a message in bytes (default 1MB, negative is unlimited)
+	PingInterval   time.Duration                `json:"ping_interval" url:"ping_interval"`       // Interval for keep-alive pings (default 30s, negative disables)
+	Subprotocols   []string                     `json:"subprotocols" url:"subprotocols"`         // Supported subprotocols in order of preference
+	WriteTimeout   time.Duration                `json:"write_timeout" url:"write_timeout"`       // Timeout for writing a frame (default 10s, negative disables)
+}
+
+// WebSocketCloseError is returned when the connection has been closed, with the close code and reason
+type WebSocketCloseError struct {
+	Code   int    `json:"code" url:"code"`
+	Reason string `json:"reason" url:"reason"`
+}
+
+// Error returns the close code and reason
+func (e *WebSocketCloseError) Error() string {
+	return "websocket closed: code=" + strconv.Itoa(e.Code) + " reason=" + e.Reason
+}
+
+// WebSocketConn is an upgraded WebSocket connection.
+// One goroutine may read while others write, writes are serialized.
+// Control frames (ping, pong and close) are handled while reading with ReadMessage().
+type WebSocketConn struct {
+	closeCode       int
+	closeOnce       sync.Once
+	closeSent       bool
+	closed          chan struct{}
+	conn            net.Conn
+	idleTimeout     time.Duration
+	maxMessageSize  int64
+	messagesRead    atomic.Int64
+	messagesWritten atomic.Int64
+	reader          *bufio.Reader
+	subprotocol     string
+	writeMu         sync.Mutex
+	writeTimeout    time.Duration
+}
+
+// webSocketFrame is a single frame read from the client
+type webSocketFrame struct {
+	fin     bool
+	opcode  byte
+	payload []byte
+}
+
+// WebSocket upgrades the request to a WebSocket connection and calls the handler.
+// Wrap it with Request() (and any middleware such as Check) so the handshake only happens after they pass.
+// Browsers must be on the same host or the router's explicit CrossOriginAllowOrigin, unless CheckOrigin is set.
+func (r *Router) WebSocket(h WebSocketHandler, options WebSocketOptions) httprouter.Handle {
+	if options.MaxMessageSize == 0 {
+		options.MaxMessageSize = defaultWebSocketMaxMessageSize
+	}
+	if options.PingInterval == 0 {
+		options.PingInterval = defaultWebSocketPingInterval
+	}
+	if options.IdleTimeout == 0 && options.PingInterval > 0 {
+		options.IdleTimeout = 2 * options.PingInterval
+	}
+	if options.WriteTimeout == 0 {
+		options.WriteTimeout = defaultWebSocketWriteTimeout
+	}
+
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		// Validate the handshake
+		if status, err := r.checkWebSocketHandshake(req, options); err != nil {
+			if errors.Is(err, ErrWebSocketVersion) {
+				w.Header().Set(secWebSocketVersion, webSocketVersion)
+			}
+			RespondWith(w, req, status, ErrorFromRequest(
+				req, "websocket handshake rejected: "+err.Error(), err.Error(), ErrCodeWebSocketUpgrade, status, nil,
+			))
+			return
+		}
+
+		// Take over the connection
+		netConn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			RespondWith(w, req, http.StatusInternalServerError, ErrorFromRequest(
+				req, "websocket hijack failed: "+err.Error(), "unable to upgrade the connection", ErrCodeWebSocketUpgrade, http.StatusInternalServerError, nil,
+			))
+			return
+		}
+
+		// Remove any deadlines set by the server
+		_ = netConn.SetDeadline(time.Time{})
+
+		conn := &WebSocketConn{
+			closed:         make(chan struct{}),
+			conn:           netConn,
+			idleTimeout:    max(options.IdleTimeout, 0),
+			maxMessageSize: options.MaxMessageSize,
+			reader:         rw.Reader,
+			subprotocol:    selectSubprotocol(req, options.Subprotocols),
+			writeTimeout:   max(options.WriteTimeout, 0),
+		}
+		if err = conn.writeHandshake(w.Header(), req.Header.Get(secWebSocketKey)); err != nil {
+			_ = netConn.Close()
+			return
+		}
+
+		// Log the connection once it closes
+		start := time.Now()
+		defer func() {
+			_ = conn.Close(WebSocketCloseNormal, "")
+			if r.Logger != nil {
+				id, _ := GetRequestID(req)
+				ip, _ := GetIPFromRequest(req)
+				r.Logger.Printf(
+					LogWebSocketFormat, id, req.URL.Path, ip, int64(time.Since(start)/time.Millisecond),
+					conn.messagesRead.Load(), conn.messagesWritten.Load(), conn.closeCode,
+				)
+			}
+		}()
+
+		if options.PingInterval > 0 {
+			go conn.keepAlive(options.PingInterval)
+		}
+
+		h(conn, req, ps)
+	}
+}
+
+// checkWebSocketHandshake validates the upgrade request and returns the status to use if it is rejected
+func (r *Router) checkWebSocketHandshake(req *http.Request, options WebSocketOptions) (int, error) {
+	if req.Method != http.MethodGet ||
+		!headerContainsToken(req.Header, connectionHeader, "upgrade") ||
+		!headerContainsToken(req.Header, upgradeHeader, webSocketToken) {
+		return http.StatusBadRequest, ErrNotWebSocketUpgrade
+	}
+
+	if req.Header.Get(secWebSocketVersion) != webSocketVersion {
+		return http.StatusUpgradeRequired, ErrWebSocketVersion
+	}
+
+	// The key must be a base64 encoded 16-byte value
+	if key, err := base64.StdEncoding.DecodeString(req.Header.Get(secWebSocketKey)); err != nil || len(key) != 16 {
+		return http.StatusBadRequest, ErrWebSocketKey
+	}
+
+	checkOrigin := options.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = r.allowWebSocketOrigin
+	}
+	if !checkOrigin(req) {
+		return http.StatusForbidden, ErrWebSocketOrigin
+	}
+
+	return 0, nil
+}
+
+// allowWebSocketOrigin allows the same host, or the explicit CrossOriginAllowOrigin.
+// Allowing all origins (or "*") does not apply to WebSockets: browsers send cookies with the upgrade,
+// so any site could use the user's session (cross-site WebSocket hijacking). Use CheckOrigin to allow more.
+func (r *Router) allowWebSocketOrigin(req *http.Request) bool {
+	originDomain := req.Header.Get(origin)
+	if len(originDomain) == 0 {
+		return true // Not a browser
+	}
+
+	if r.CrossOriginEnabled && r.CrossOriginAllowOrigin != "*" && len(r.CrossOriginAllowOrigin) > 0 &&
+		strings.EqualFold(originDomain, r.CrossOriginAllowOrigin) {
+		return true
+	}
+
+	originURL, err := url.Parse(originDomain)
+	return err == nil && strings.EqualFold(originURL.Host, req.Host)
+}
+
+// Subprotocol returns the subprotocol selected during the handshake (empty if none)
+func (c *WebSocketConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// Done returns a channel that is closed when the connection closes (IE: to stop writer goroutines)
+func (c *WebSocketConn) Done() <-chan struct{} {
+	return c.closed
+}
+
+// ReadMessage reads the next text or binary message, answering pings and close frames along the way.
+// A *WebSocketCloseError is returned once the connection is closed by either side.
+func (c *WebSocketConn) ReadMessage() (WebSocketMessageType, []byte, error) {
+	var messageType WebSocketMessageType
+	var message []byte
+
+	for {
+		remaining := int64(-1)
+		if c.maxMessageSize > 0 {
+			remaining = c.maxMessageSize - int64(len(message))
+		}
+
+		frame, err := c.readFrame(remaining)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frame.opcode {
+		case opPing:
+			if err = c.writeFrame(opPong, frame.payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue // The idle deadline was extended by reading it
+		case opClose:
+			return 0, nil, c.closeReceived(frame.payload)
+		case opText, opBinary:
+			if messageType != 0 {
+				return 0, nil, c.fail(WebSocketCloseProtocolError, "expected a continuation frame")
+			}
+			messageType = WebSocketMessageType(frame.opcode)
+			message = frame.payload
+		case opContinuation:
+			if messageType == 0 {
+				return 0, nil, c.fail(WebSocketCloseProtocolError, "unexpected continuation frame")
+			}
+			message = append(message, frame.payload...)
+		default:
+			return 0, nil, c.fail(WebSocketCloseProtocolError, "unknown opcode")
+		}
+
+		if !frame.fin {
+			continue
+		}
+		if messageType == WebSocketTextMessage && !utf8.Valid(message) {
+			return 0, nil, c.fail(WebSocketCloseInvalidPayload, "text message is not valid utf-8")
+		}
+		c.messagesRead.Add(1)
+		return messageType, message, nil
+	}
+}
+
+// ReadJSON reads the next message and decodes it as JSON into v
+func (c *WebSocketConn) ReadJSON(v interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WriteMessage sends a text or binary message
+func (c *WebSocketConn) WriteMessage(messageType WebSocketMessageType, data []byte) error {
+	if messageType != WebSocketTextMessage && messageType != WebSocketBinaryMessage {
+		return ErrInvalidMessageType
+	}
+	if err := c.writeFrame(byte(messageType), data); err != nil {
+		return err
+	}
+	c.messagesWritten.Add(1)
+	return nil
+}
+
+// WriteJSON sends the value encoded as JSON in a text message
+func (c *WebSocketConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(WebSocketTextMessage, data)
+}
+
+// Ping sends a ping, the client's pong is handled by ReadMessage()
+func (c *WebSocketConn) Ping(data []byte) error {
+	if len(data) > maxControlPayload {
+		return ErrControlFrameTooLarge
+	}
+	return c.writeFrame(opPing, data)
+}
+
+// Close sends a close frame with the code and reason, then closes the connection.
+// Closing more than once has no effect.
+func (c *WebSocketConn) Close(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code)) //nolint:gosec // close codes are 16-bit
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		return ErrControlFrameTooLarge
+	}
+	return c.shutdown(code, payload, true)
+}
+
+// readFrame reads and unmasks the next frame, data frames larger than remaining (unless negative) are rejected
+func (c *WebSocketConn) readFrame(remaining int64) (*webSocketFrame, error) {
+	if c.idleTimeout > 0 {
+		_ = c.conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+	}
+
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return nil, c.readError(err)
+	}
+
+	frame := &webSocketFrame{fin: header[0]&0x80 != 0, opcode: header[0] & 0x0F}
+	if header[0]&0x70 != 0 {
+		return nil, c.fail(WebSocketCloseProtocolError, "reserved bits are set")
+	}
+	if header[1]&0x80 == 0 {
+		return nil, c.fail(WebSocketCloseProtocolError, "client frames must be masked")
+	}
+
+	// Extended payload lengths
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return nil, c.readError(err)
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return nil, c.readError(err)
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+		if length&(1<<63) != 0 {
+			return nil, c.fail(WebSocketCloseProtocolError, "invalid payload length")
+		}
+	}
+
+	if frame.opcode >= opClose {
+		if !frame.fin || length > maxControlPayload {
+			return nil, c.fail(WebSocketCloseProtocolError, "invalid control frame")
+		}
+	} else if remaining >= 0 && length > uint64(remaining) {
+		return nil, c.fail(WebSocketCloseMessageTooBig, "message is too big")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return nil, c.readError(err)
+	}
+	frame.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, frame.payload); err != nil {
+		return nil, c.readError(err)
+	}
+	for i := range frame.payload {
+		frame.payload[i] ^= mask[i%4]
+	}
+	return frame, nil
+}
+
+// readError closes the connection after a failed read (IE: the client disconnected or went idle)
+func (c *WebSocketConn) readError(err error) error {
+	select {
+	case <-c.closed:
+		return ErrWebSocketClosed
+	default:
+	}
+
+	_ = c.shutdown(WebSocketCloseAbnormal, nil, false)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &WebSocketCloseError{Code: WebSocketCloseAbnormal, Reason: "unexpected EOF"}
+	}
+	return err
+}
+
+// closeReceived answers the client's close frame by echoing the code, then closes the connection
+func (c *WebSocketConn) closeReceived(payload []byte) error {
+	code, reason := WebSocketCloseNoStatus, ""
+	if len(payload) > 0 {
+		if len(payload) < 2 {
+			return c.fail(WebSocketCloseProtocolError, "invalid close frame")
+		}
+		code, reason = int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+		if !validCloseCode(code) || !utf8.ValidString(reason) {
+			return c.fail(WebSocketCloseProtocolError, "invalid close frame")
+		}
+	}
+
+	_ = c.shutdown(code, payload[:min(len(payload), 2)], true)
+	return &WebSocketCloseError{Code: code, Reason: reason}
+}
+
+// fail closes the connection because the client broke the protocol
+func (c *WebSocketConn) fail(code int, reason string) error {
+	_ = c.Close(code, reason)
+	return &WebSocketCloseError{Code: code, Reason: reason}
+}
+
+// shutdown sends the close frame (if requested) and closes the connection once
+func (c *WebSocketConn) shutdown(code int, payload []byte, sendFrame bool) error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		if sendFrame {
+			err = c.writeFrame(opClose, payload)
+		}
+		close(c.closed)
+		if closeErr := c.conn.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+// keepAlive sends pings until the connection closes
+func (c *WebSocketConn) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			if err := c.Ping(nil); err != nil {
+				_ = c.shutdown(WebSocketCloseAbnormal, nil, false)
+				return
+			}
+		}
+	}
+}
+
+// writeFrame sends a single unmasked frame, nothing can be sent after the close frame
+func (c *WebSocketConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return ErrWebSocketClosed
+	}
+	if opcode == opClose {
+		c.closeSent = true
+	}
+
+	length := len(payload)
+	frame := make([]byte, 0, length+10)
+	frame = append(frame, 0x80|opcode)
+	switch {
+	case length <= maxControlPayload:
+		frame = append(frame, byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	frame = append(frame, payload...)
+
+	if c.writeTimeout > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// writeHandshake sends the 101 response, including any headers set by the middleware (IE: a refreshed token)
+func (c *WebSocketConn) writeHandshake(responseHeader http.Header, key string) error {
+	header := responseHeader.Clone()
+	header.Del(contentEncodingHeader)
+	header.Del(contentLengthHeader)
+	header.Del(contentTypeHeader)
+	header.Set(upgradeHeader, webSocketToken)
+	header.Set(connectionHeader, "Upgrade")
+	header.Set(secWebSocketAccept, webSocketAcceptKey(key))
+	if len(c.subprotocol) > 0 {
+		header.Set(secWebSocketProtocol, c.subprotocol)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	_ = header.Write(&b)
+	b.WriteString("\r\n")
+
+	if c.writeTimeout > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	_, err := c.conn.Write(b.Bytes())
+	return err
+}
+
+// webSocketAcceptKey computes the Sec-WebSocket-Accept value for the client's key
+func webSocketAcceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + webSocketAcceptGUID)) //nolint:gosec // required by RFC 6455
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// selectSubprotocol picks the first supported subprotocol that the client requested
+func selectSubprotocol(req *http.Request, supported []string) string {
+	for _, protocol := range supported {
+		if headerContainsToken(req.Header, secWebSocketProtocol, protocol) {
+			return protocol
+		}
+	}
+	return ""
+}
+
+// headerContainsToken checks the comma separated header values for the token (case-insensitive)
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validCloseCode checks if the close code can be sent by the client
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	default:
+		return code >= 3000 && code <= 4999
+	}
+}
@@ -0,0 +1,422 @@
+package apirouter
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+)
+
+// testWebSocketKey is the sample key from RFC 6455
+const testWebSocketKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+// captureLogger stores the log lines for assertions
+type captureLogger struct {
+	lines []string
+	mu    sync.Mutex
+}
+
+// Printf stores the formatted line
+func (l *captureLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+// contains checks if any line contains the text
+func (l *captureLogger) contains(text string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// testWebSocketClient is a minimal client for testing the server side of the protocol
+type testWebSocketClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialTestWebSocket opens the connection and sends the handshake
+func dialTestWebSocket(t *testing.T, serverURL string, header http.Header) (*testWebSocketClient, *http.Response) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, serverURL+"/ws", nil)
+	require.NoError(t, err)
+	req.Header.Set(connectionHeader, "keep-alive, Upgrade")
+	req.Header.Set(upgradeHeader, "websocket")
+	req.Header.Set(secWebSocketVersion, webSocketVersion)
+	req.Header.Set(secWebSocketKey, testWebSocketKey)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	require.NoError(t, req.Write(conn))
+
+	client := &testWebSocketClient{conn: conn, reader: bufio.NewReader(conn)}
+	resp, err := http.ReadResponse(client.reader, req)
+	require.NoError(t, err)
+	return client, resp
+}
+
+// writeFrame sends a masked frame
+func (c *testWebSocketClient) writeFrame(t *testing.T, fin bool, opcode byte, payload []byte, masked bool) {
+	t.Helper()
+
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+
+	data := append([]byte{}, payload...)
+	if masked {
+		mask := []byte{0x12, 0x34, 0x56, 0x78}
+		frame = append(frame, mask...)
+		for i := range data {
+			data[i] ^= mask[i%4]
+		}
+	}
+	_, err := c.conn.Write(append(frame, data...))
+	require.NoError(t, err)
+}
+
+// readFrame reads an unmasked frame from the server
+func (c *testWebSocketClient) readFrame(t *testing.T) (byte, []byte) {
+	t.Helper()
+
+	require.NoError(t, c.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	header := make([]byte, 2)
+	_, err := io.ReadFull(c.reader, header)
+	require.NoError(t, err)
+	require.Zero(t, header[1]&0x80, "server frames must not be masked")
+
+	length := int(header[1] & 0x7F)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		_, err = io.ReadFull(c.reader, extended)
+		require.NoError(t, err)
+		length = int(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		_, err = io.ReadFull(c.reader, extended)
+		require.NoError(t, err)
+		length = int(binary.BigEndian.Uint64(extended)) //nolint:gosec // test frames are small
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.reader, payload)
+	require.NoError(t, err)
+	return header[0] & 0x0F, payload
+}
+
+// readClose reads frames until the close frame and returns the close code
+func (c *testWebSocketClient) readClose(t *testing.T) int {
+	t.Helper()
+	for {
+		opcode, payload := c.readFrame(t)
+		if opcode != opClose {
+			continue
+		}
+		if len(payload) < 2 {
+			return WebSocketCloseNoStatus
+		}
+		return int(binary.BigEndian.Uint16(payload))
+	}
+}
+
+// newWebSocketServer starts a server with the echo handler behind Request()
+func newWebSocketServer(t *testing.T, router *Router, options WebSocketOptions) *httptest.Server {
+	t.Helper()
+
+	router.HTTPRouter.GET("/ws", router.Request(router.WebSocket(func(conn *WebSocketConn, _ *http.Request, _ httprouter.Params) {
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(data) == "close" {
+				_ = conn.Close(WebSocketClosePolicyViolation, "bye")
+				return
+			}
+			if err = conn.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}, options)))
+
+	server := httptest.NewServer(router.HTTPRouter)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestRouter_WebSocket tests the handshake, messages and the close handshake
+func TestRouter_WebSocket(t *testing.T) {
+	t.Parallel()
+
+	logger := &captureLogger{}
+	router := New()
+	router.Logger = logger
+	router.CrossOriginAllowOrigin = "https://example.com"
+	server := newWebSocketServer(t, router, WebSocketOptions{Subprotocols: []string{"v2.chat", "v1.chat"}})
+
+	client, resp := dialTestWebSocket(t, server.URL, http.Header{
+		secWebSocketProtocol: {"v1.chat, v2.chat"},
+		origin:               {"https://example.com"},
+	})
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	require.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get(secWebSocketAccept))
+	require.Equal(t, "v2.chat", resp.Header.Get(secWebSocketProtocol))
+	require.Equal(t, "websocket", resp.Header.Get(upgradeHeader))
+	require.Equal(t, "https://example.com", resp.Header.Get(allowOriginHeader))
+
+	t.Run("echo a text message", func(t *testing.T) {
+		client.writeFrame(t, true, opText, []byte("hello"), true)
+		opcode, payload := client.readFrame(t)
+		require.Equal(t, opText, opcode)
+		require.Equal(t, "hello", string(payload))
+	})
+
+	t.Run("reassemble a fragmented binary message around a ping", func(t *testing.T) {
+		client.writeFrame(t, false, opBinary, []byte{1, 2}, true)
+		client.writeFrame(t, true, opPing, []byte("are you there"), true)
+		client.writeFrame(t, true, opContinuation, []byte{3}, true)
+
+		opcode, payload := client.readFrame(t)
+		require.Equal(t, opPong, opcode)
+		require.Equal(t, "are you there", string(payload))
+
+		opcode, payload = client.readFrame(t)
+		require.Equal(t, opBinary, opcode)
+		require.Equal(t, []byte{1, 2, 3}, payload)
+	})
+
+	t.Run("echo a large message", func(t *testing.T) {
+		large := strings.Repeat("a", 70000)
+		client.writeFrame(t, true, opText, []byte(large), true)
+		opcode, payload := client.readFrame(t)
+		require.Equal(t, opText, opcode)
+		require.Equal(t, large, string(payload))
+	})
+
+	t.Run("close handshake", func(t *testing.T) {
+		client.writeFrame(t, true, opClose, binary.BigEndian.AppendUint16(nil, uint16(WebSocketCloseGoingAway)), true)
+		require.Equal(t, WebSocketCloseGoingAway, client.readClose(t))
+		require.Eventually(t, func() bool {
+			return logger.contains(`type="websocket"`) && logger.contains("messages_read=3 messages_written=3 close_code=1001")
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+// TestRouter_WebSocketServerClose tests the handler closing the connection
+func TestRouter_WebSocketServerClose(t *testing.T) {
+	t.Parallel()
+
+	server := newWebSocketServer(t, New(), WebSocketOptions{})
+	client, resp := dialTestWebSocket(t, server.URL, nil)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	client.writeFrame(t, true, opText, []byte("close"), true)
+	opcode, payload := client.readFrame(t)
+	require.Equal(t, opClose, opcode)
+	require.Equal(t, WebSocketClosePolicyViolation, int(binary.BigEndian.Uint16(payload)))
+	require.Equal(t, "bye", string(payload[2:]))
+}
+
+// TestRouter_WebSocketProtocolErrors tests the close codes for invalid frames
+func TestRouter_WebSocketProtocolErrors(t *testing.T) {
+	t.Parallel()
+
+	server := newWebSocketServer(t, New(), WebSocketOptions{MaxMessageSize: 10})
+
+	tests := []struct {
+		name    string
+		send    func(t *testing.T, client *testWebSocketClient)
+		expects int
+	}{
+		{"unmasked frame", func(t *testing.T, client *testWebSocketClient) {
+			client.writeFrame(t, true, opText, []byte("hi"), false)
+		}, WebSocketCloseProtocolError},
+		{"message too big", func(t *testing.T, client *testWebSocketClient) {
+			client.writeFrame(t, true, opText, []byte("this is longer than ten bytes"), true)
+		}, WebSocketCloseMessageTooBig},
+		{"fragments over the limit", func(t *testing.T, client *testWebSocketClient) {
+			client.writeFrame(t, false, opText, []byte("123456"), true)
+			client.writeFrame(t, true, opContinuation, []byte("789012"), true)
+		}, WebSocketCloseMessageTooBig},
+		{"invalid utf-8", func(t *testing.T, client *testWebSocketClient) {
+			client.writeFrame(t, true, opText, []byte{0xff, 0xfe}, true)
+		}, WebSocketCloseInvalidPayload},
+		{"unexpected continuation", func(t *testing.T, client *testWebSocketClient) {
+			client.writeFrame(t, true, opContinuation, []byte("hi"), true)
+		}, WebSocketCloseProtocolError},
+		{"fragmented ping", func(t *testing.T, client *testWebSocketClient) {
+			client.writeFrame(t, false, opPing, nil, true)
+		}, WebSocketCloseProtocolError},
+		{"invalid close code", func(t *testing.T, client *testWebSocketClient) {
+			client.writeFrame(t, true, opClose, binary.BigEndian.AppendUint16(nil, 1006), true)
+		}, WebSocketCloseProtocolError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, resp := dialTestWebSocket(t, server.URL, nil)
+			require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+			test.send(t, client)
+			require.Equal(t, test.expects, client.readClose(t))
+		})
+	}
+}
+
+// TestRouter_WebSocketKeepAlive tests the server pings and the idle timeout
+func TestRouter_WebSocketKeepAlive(t *testing.T) {
+	t.Parallel()
+
+	logger := &captureLogger{}
+	router := New()
+	router.Logger = logger
+	server := newWebSocketServer(t, router, WebSocketOptions{PingInterval: 20 * time.Millisecond, IdleTimeout: 200 * time.Millisecond})
+
+	client, resp := dialTestWebSocket(t, server.URL, nil)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	opcode, _ := client.readFrame(t)
+	require.Equal(t, opPing, opcode)
+
+	// Never answering the pings closes the connection
+	require.Eventually(t, func() bool {
+		return logger.contains("close_code=1006")
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// TestRouter_WebSocketHandshakeErrors tests rejected upgrade requests
+func TestRouter_WebSocketHandshakeErrors(t *testing.T) {
+	t.Parallel()
+
+	router := New()
+	router.CrossOriginAllowOriginAll = false
+	router.CrossOriginAllowOrigin = "https://allowed.com"
+	handler := router.Request(router.WebSocket(func(_ *WebSocketConn, _ *http.Request, _ httprouter.Params) {
+		t.Error("handler should not be called")
+	}, WebSocketOptions{}))
+
+	newUpgradeRequest := func() *http.Request {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/ws", nil)
+		req.Header.Set(connectionHeader, "Upgrade")
+		req.Header.Set(upgradeHeader, "websocket")
+		req.Header.Set(secWebSocketVersion, webSocketVersion)
+		req.Header.Set(secWebSocketKey, testWebSocketKey)
+		return req
+	}
+
+	tests := []struct {
+		name   string
+		modify func(req *http.Request)
+		status int
+	}{
+		{"not an upgrade", func(req *http.Request) { req.Header.Del(upgradeHeader) }, http.StatusBadRequest},
+		{"wrong method", func(req *http.Request) { req.Method = http.MethodPost }, http.StatusBadRequest},
+		{"unsupported version", func(req *http.Request) { req.Header.Set(secWebSocketVersion, "8") }, http.StatusUpgradeRequired},
+		{"missing key", func(req *http.Request) { req.Header.Del(secWebSocketKey) }, http.StatusBadRequest},
+		{"invalid key", func(req *http.Request) { req.Header.Set(secWebSocketKey, "c2hvcnQ=") }, http.StatusBadRequest},
+		{"origin not allowed", func(req *http.Request) { req.Header.Set(origin, "https://evil.com") }, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := newUpgradeRequest()
+			test.modify(req)
+			rr := httptest.NewRecorder()
+			handler(rr, req, nil)
+			require.Equal(t, test.status, rr.Code)
+			require.Contains(t, rr.Body.String(), "error")
+		})
+	}
+
+	t.Run("version header on 426", func(t *testing.T) {
+		req := newUpgradeRequest()
+		req.Header.Set(secWebSocketVersion, "8")
+		rr := httptest.NewRecorder()
+		handler(rr, req, nil)
+		require.Equal(t, webSocketVersion, rr.Header().Get(secWebSocketVersion))
+	})
+
+	t.Run("hijacking not supported", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler(rr, newUpgradeRequest(), nil)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+// TestRouter_allowWebSocketOrigin tests the origin checks
+func TestRouter_allowWebSocketOrigin(t *testing.T) {
+	t.Parallel()
+
+	newRequest := func(originDomain string) *http.Request {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "http://api.example.com/ws", nil)
+		if len(originDomain) > 0 {
+			req.Header.Set(origin, originDomain)
+		}
+		return req
+	}
+
+	t.Run("allowing all origins is same host only", func(t *testing.T) {
+		router := New()
+		require.True(t, router.CrossOriginAllowOriginAll)
+		require.False(t, router.allowWebSocketOrigin(newRequest("https://anywhere.com")))
+		require.True(t, router.allowWebSocketOrigin(newRequest("https://api.example.com")))
+
+		router.CrossOriginAllowOriginAll = false
+		router.CrossOriginAllowOrigin = "*"
+		require.False(t, router.allowWebSocketOrigin(newRequest("https://anywhere.com")))
+	})
+
+	t.Run("configured origin", func(t *testing.T) {
+		router := New()
+		router.CrossOriginAllowOriginAll = false
+		router.CrossOriginAllowOrigin = "https://app.example.com"
+		require.True(t, router.allowWebSocketOrigin(newRequest("https://app.example.com")))
+		require.False(t, router.allowWebSocketOrigin(newRequest("https://evil.com")))
+		require.True(t, router.allowWebSocketOrigin(newRequest("")))
+	})
+
+	t.Run("same host when cross-origin is disabled", func(t *testing.T) {
+		router := New()
+		router.CrossOriginEnabled = false
+		require.True(t, router.allowWebSocketOrigin(newRequest("https://api.example.com")))
+		require.False(t, router.allowWebSocketOrigin(newRequest("https://app.example.com")))
+	})
+}